@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type snippet struct {
+	ID       int       `json:"id"`
+	Slug     string    `json:"slug"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// client talks to the JSON API exposed by cmd/web.
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(cfg *config) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &client{
+		server: strings.TrimRight(cfg.Server, "/"),
+		token:  cfg.Token,
+		http:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is returned for any non 2xx response from the server.
+type apiError struct {
+	Status int
+	// Message is either a string or, for validation failures, a map of field names to messages.
+	Message interface{} `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	switch msg := e.Message.(type) {
+	case string:
+		return fmt.Sprintf("%s (%d)", msg, e.Status)
+	case map[string]interface{}:
+		var parts []string
+		for field, errs := range msg {
+			parts = append(parts, fmt.Sprintf("%s: %v", field, errs))
+		}
+		return fmt.Sprintf("%s (%d)", strings.Join(parts, "; "), e.Status)
+	default:
+		return fmt.Sprintf("%s (%d)", http.StatusText(e.Status), e.Status)
+	}
+}
+
+func (c *client) do(method, path string, body, dst interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(method, c.server+path, rd)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		json.NewDecoder(resp.Body).Decode(apiErr)
+		return apiErr
+	}
+
+	if dst == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+// errTwoFactorRequired is the message the server answers logins with when the account has
+// two-factor authentication and no code was given.
+const errTwoFactorRequired = "two-factor code required"
+
+// login exchanges an email and password, and the two-factor code if the account has one, for
+// an API token.
+func (c *client) login(email, password, code string) (string, time.Time, error) {
+	var resp struct {
+		Token struct {
+			Token   string    `json:"token"`
+			Expires time.Time `json:"expires"`
+		} `json:"token"`
+	}
+
+	body := map[string]string{"email": email, "password": password}
+	if code != "" {
+		body["code"] = code
+	}
+
+	err := c.do(http.MethodPost, "/api/tokens", body, &resp)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return resp.Token.Token, resp.Token.Expires, nil
+}
+
+func (c *client) create(title, content, language, expires string) (*snippet, error) {
+	var resp struct {
+		Snippet *snippet `json:"snippet"`
+	}
+
+	body := map[string]string{
+		"title":    title,
+		"content":  content,
+		"language": language,
+		"expires":  expires,
+	}
+
+	if err := c.do(http.MethodPost, "/api/snippets", body, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Snippet, nil
+}
+
+func (c *client) list() ([]*snippet, error) {
+	var resp struct {
+		Snippets []*snippet `json:"snippets"`
+	}
+
+	if err := c.do(http.MethodGet, "/api/snippets", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Snippets, nil
+}
+
+// raw fetches the content of a snippet. ref is a numeric ID, a slug as shown by list or a
+// snippet URL as printed by create, e.g. https://localhost:4000/snippet/12.
+func (c *client) raw(ref string) ([]byte, error) {
+	ref, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Get(fmt.Sprintf("%s/snippet/%s/raw", c.server, ref))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &apiError{Status: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (c *client) snippetURL(id int) string {
+	return fmt.Sprintf("%s/snippet/%d", c.server, id)
+}
+
+var errInvalidRef = errors.New("snippet must be referenced by ID, slug or URL")
+
+// slugRX matches the slugs the server gives snippets: words and a random suffix, joined by
+// hyphens, so a slug is never a bare word like the create in /snippet/create.
+var slugRX = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)+$`)
+
+// parseRef returns the ID or slug of the snippet ref names, by ID, by slug or by the URL of the
+// snippet or its raw content.
+func parseRef(ref string) (string, error) {
+	if !strings.ContainsAny(ref, "/:") {
+		return checkRef(ref)
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", errInvalidRef
+	}
+
+	path := strings.TrimSuffix(strings.TrimSuffix(u.Path, "/raw"), "/")
+	idx := strings.LastIndex(path, "/snippet/")
+	if idx < 0 {
+		return "", errInvalidRef
+	}
+
+	return checkRef(path[idx+len("/snippet/"):])
+}
+
+// checkRef returns ref if it is a valid ID or slug.
+func checkRef(ref string) (string, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id < 1 {
+			return "", errInvalidRef
+		}
+		return strconv.Itoa(id), nil
+	}
+
+	if !slugRX.MatchString(ref) {
+		return "", errInvalidRef
+	}
+	return ref, nil
+}
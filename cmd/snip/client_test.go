@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		ref     string
+		wantRef string
+		wantErr error
+	}{
+		{"ID", "12", "12", nil},
+		{"Slug", "deploy-runbook-k3v9xq2m", "deploy-runbook-k3v9xq2m", nil},
+		{"URL", "https://localhost:4000/snippet/12", "12", nil},
+		{"Raw URL", "https://localhost:4000/snippet/12/raw", "12", nil},
+		{"Slug URL", "https://localhost:4000/snippet/deploy-runbook-k3v9xq2m/raw", "deploy-runbook-k3v9xq2m", nil},
+		{"Path", "/snippet/7", "7", nil},
+		{"Negative ID", "-1", "", errInvalidRef},
+		{"Bare word", "runbook", "", errInvalidRef},
+		{"Uppercase slug", "Deploy-Runbook", "", errInvalidRef},
+		{"Other URL", "https://localhost:4000/user/login", "", errInvalidRef},
+		{"Non numeric URL", "https://localhost:4000/snippet/create", "", errInvalidRef},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ref, err := parseRef(tt.ref)
+			if err != tt.wantErr {
+				t.Errorf("want %v; got %v", tt.wantErr, err)
+			}
+			if ref != tt.wantRef {
+				t.Errorf("want %q; got %q", tt.wantRef, ref)
+			}
+		})
+	}
+}
+
+// TestRun drives the command the way a user would, against a fake server which checks the
+// bearer token and echoes back what it was sent.
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	var created map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/snippet/hello-k3v9xq2m/raw":
+			w.Write([]byte("package main"))
+		case r.URL.Path == "/api/tokens":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"token":{"token":"secret","expires":"2030-01-01T00:00:00Z"}}`))
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid or missing authentication token"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/api/snippets":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"snippet":{"id":3,"title":"t"}}`))
+		case r.URL.Path == "/api/snippets":
+			w.Write([]byte(`{"snippets":[{"id":3,"slug":"hello-k3v9xq2m","title":"hello","language":"go","expires":"2030-01-01T00:00:00Z"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	base := []string{"-config", configPath, "-server", ts.URL}
+
+	var out bytes.Buffer
+	err := run(append(base, "create"), strings.NewReader("package main"), &out)
+	if err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Fatalf("want not logged in error; got %v", err)
+	}
+
+	out.Reset()
+	err = run(append(base, "login", "-email", "alice@example.com"), strings.NewReader("pa$$word\n"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Token != "secret" {
+		t.Errorf("want token %q saved; got %q", "secret", cfg.Token)
+	}
+
+	out.Reset()
+	err = run(append(base, "-title", "hello", "-lang", "go", "-expires", "week"), strings.NewReader("package main"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ts.URL + "/snippet/3\n"; out.String() != want {
+		t.Errorf("want %q; got %q", want, out.String())
+	}
+	want := map[string]string{"title": "hello", "content": "package main", "language": "go", "expires": "7"}
+	for k, v := range want {
+		if created[k] != v {
+			t.Errorf("want %s %q; got %q", k, v, created[k])
+		}
+	}
+
+	out.Reset()
+	if err := run(append(base, "list"), nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "hello-k3v9xq2m") {
+		t.Errorf("want list to contain the slug %q; got %q", "hello-k3v9xq2m", out.String())
+	}
+
+	out.Reset()
+	if err := run(append(base, "get", "hello-k3v9xq2m"), nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "package main" {
+		t.Errorf("want the raw content by slug; got %q", out.String())
+	}
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]string
+		json.NewDecoder(r.Body).Decode(&input)
+		if input["code"] != "123456" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"two-factor code required"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":{"token":"secret","expires":"2030-01-01T00:00:00Z"}}`))
+	}))
+	defer ts.Close()
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	args := []string{"-config", configPath, "-server", ts.URL, "login", "-email", "erin@example.com"}
+
+	var out bytes.Buffer
+	if err := run(args, strings.NewReader("pa$$word\n123456\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Two-factor code: ") {
+		t.Errorf("want a prompt for the code; got %q", out.String())
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Token != "secret" {
+		t.Errorf("want token %q saved; got %q", "secret", cfg.Token)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// config is persisted as JSON, by default in $XDG_CONFIG_HOME/snip/config.json.
+type config struct {
+	Server string `json:"server"`
+	Token  string `json:"token,omitempty"`
+	// Insecure skips TLS certificate verification, which is handy against the self signed certificate used in development.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+const defaultServer = "https://localhost:4000"
+
+func defaultConfigPath() (string, error) {
+	if path := os.Getenv("SNIP_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "snip", "config.json"), nil
+}
+
+// loadConfig reads the config file at path. A missing file is not an error, the defaults are returned instead.
+func loadConfig(path string) (*config, error) {
+	cfg := &config{Server: defaultServer}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// save writes the config with owner-only permissions since it holds the API token.
+func (c *config) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,264 @@
+// Command snip is a terminal client for snipshot.
+//
+//	cat main.go | snip -title main.go -lang go
+//	snip get 12
+//	snip get deploy-runbook-k3v9xq2m
+//	snip list
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+const usage = `usage: snip [-config path] [-server url] [command] [arguments]
+
+commands:
+  create [-title t] [-expires 1|7|365] [-lang l] [file ...]
+        create a snippet from each file, or from stdin (the default command)
+  get <id|slug|url>
+        print the raw content of a snippet
+  list
+        list your snippets
+  login [-email e] [-insecure]
+        exchange your email and password for an API token and save it
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "snip:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	defaultPath, err := defaultConfigPath()
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("snip", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	configPath := fs.String("config", defaultPath, "Path to the config file")
+	server := fs.String("server", "", "Server URL, overrides the config file")
+	// create is the default command, so its flags are accepted without naming it: cat f | snip -title f
+	opts := addCreateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *server != "" {
+		cfg.Server = *server
+	}
+	if token := os.Getenv("SNIP_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+
+	args = fs.Args()
+	command := ""
+	if len(args) > 0 {
+		switch args[0] {
+		case "create", "get", "list", "login":
+			command, args = args[0], args[1:]
+		}
+	}
+
+	switch command {
+	case "get":
+		return get(cfg, args, stdout)
+	case "list":
+		return list(cfg, stdout)
+	case "login":
+		return login(cfg, *configPath, args, stdin, stdout)
+	case "create":
+		fs := flag.NewFlagSet("create", flag.ContinueOnError)
+		opts := addCreateFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return create(cfg, opts, fs.Args(), stdin, stdout)
+	default:
+		return create(cfg, opts, args, stdin, stdout)
+	}
+}
+
+type createOptions struct {
+	title   *string
+	expires *string
+	lang    *string
+}
+
+func addCreateFlags(fs *flag.FlagSet) *createOptions {
+	return &createOptions{
+		title:   fs.String("title", "", "Snippet title, defaults to the file name"),
+		expires: fs.String("expires", "365", "Delete the snippet after 1, 7 or 365 days (or day, week, year)"),
+		lang:    fs.String("lang", "", "Language of the snippet, defaults to the file extension"),
+	}
+}
+
+func create(cfg *config, opts *createOptions, files []string, stdin io.Reader, stdout io.Writer) error {
+	title, expires, lang := opts.title, opts.expires, opts.lang
+	switch *expires {
+	case "day":
+		*expires = "1"
+	case "week":
+		*expires = "7"
+	case "year":
+		*expires = "365"
+	}
+
+	c := newClient(cfg)
+	if c.token == "" {
+		return errors.New("not logged in, run snip login first")
+	}
+
+	if len(files) == 0 {
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		return createOne(c, stdout, content, or(*title, "stdin"), *lang, *expires)
+	}
+
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		language := or(*lang, strings.TrimPrefix(filepath.Ext(path), "."))
+		if err := createOne(c, stdout, content, or(*title, filepath.Base(path)), language, *expires); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func createOne(c *client, stdout io.Writer, content []byte, title, lang, expires string) error {
+	s, err := c.create(title, string(content), lang, expires)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, c.snippetURL(s.ID))
+	return nil
+}
+
+func get(cfg *config, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: snip get <id|slug|url>")
+	}
+
+	content, err := newClient(cfg).raw(args[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = stdout.Write(content)
+	return err
+}
+
+func list(cfg *config, stdout io.Writer) error {
+	c := newClient(cfg)
+	if c.token == "" {
+		return errors.New("not logged in, run snip login first")
+	}
+
+	snippets, err := c.list()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSLUG\tTITLE\tLANGUAGE\tEXPIRES")
+	for _, s := range snippets {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", s.ID, s.Slug, s.Title, s.Language, s.Expires.Local().Format("2006-01-02"))
+	}
+
+	return tw.Flush()
+}
+
+func login(cfg *config, configPath string, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	email := fs.String("email", "", "Account email address")
+	insecure := fs.Bool("insecure", cfg.Insecure, "Skip TLS certificate verification")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg.Insecure = *insecure
+
+	in := bufio.NewReader(stdin)
+	if *email == "" {
+		fmt.Fprint(stdout, "Email: ")
+		line, err := in.ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		*email = strings.TrimSpace(line)
+	}
+
+	fmt.Fprint(stdout, "Password: ")
+	password, err := readPassword(stdin, in)
+	fmt.Fprintln(stdout)
+	if err != nil {
+		return err
+	}
+
+	c := newClient(cfg)
+	token, expires, err := c.login(*email, password, "")
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Message == errTwoFactorRequired {
+		fmt.Fprint(stdout, "Two-factor code: ")
+		line, readErr := in.ReadString('\n')
+		if readErr != nil && line == "" {
+			return readErr
+		}
+		token, expires, err = c.login(*email, password, strings.TrimSpace(line))
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg.Token = token
+	if err := cfg.save(configPath); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Logged in to %s, token valid until %s\n", cfg.Server, expires.Local().Format("2006-01-02"))
+	return nil
+}
+
+// readPassword reads without echo when stdin is a terminal and falls back to a plain line otherwise.
+func readPassword(stdin io.Reader, in *bufio.Reader) (string, error) {
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		password, err := term.ReadPassword(int(f.Fd()))
+		return string(password), err
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
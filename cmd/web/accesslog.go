@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// responseRecorder wraps the http.ResponseWriter handed down the middleware chain to remember the
+// status code and number of body bytes written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.status = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if !rw.wroteHeader {
+			rw.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// accessLogEntry is stored in the request context by logRequest so that middleware further down
+// the chain, which sees its own copy of the request, can fill in who made it.
+type accessLogEntry struct {
+	user string
+}
+
+var contextKeyAccessLog = contextKey("accessLog")
+
+// setAccessLogUser records the authenticated user for the access log line of the request.
+func setAccessLogUser(ctx context.Context, user *models.User) {
+	if entry, ok := ctx.Value(contextKeyAccessLog).(*accessLogEntry); ok {
+		entry.user = user.Email
+	}
+}
+
+// accessLogger writes one line per request in the Common or Combined Log Format, or as JSON.
+type accessLogger struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+	// sample is the fraction of requests logged, between 0 and 1. Server errors are always logged.
+	sample float64
+}
+
+func newAccessLogger(out io.Writer, format string, sample float64) (*accessLogger, error) {
+	switch format {
+	case "common", "combined", "json":
+	default:
+		return nil, fmt.Errorf("invalid access log format %q", format)
+	}
+
+	if sample < 0 || sample > 1 {
+		return nil, fmt.Errorf("access log sample rate must be between 0 and 1, got %v", sample)
+	}
+
+	return &accessLogger{out: out, format: format, sample: sample}, nil
+}
+
+func (l *accessLogger) log(r *http.Request, rw *responseRecorder, entry *accessLogEntry, start time.Time, duration time.Duration) {
+	if rw.status < 500 && l.sample < 1 && rand.Float64() >= l.sample {
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	uri, referer := redactURI(r.URL), r.Referer()
+	if u, err := url.Parse(referer); err == nil && hasSensitiveParams(u) {
+		referer = redactURI(u)
+		if u.IsAbs() {
+			referer = u.Scheme + "://" + u.Host + referer
+		}
+	}
+
+	var line []byte
+	switch l.format {
+	case "json":
+		requestID, _ := r.Context().Value(contextKeyRequestID).(string)
+		line, _ = json.Marshal(struct {
+			Time       time.Time `json:"time"`
+			RemoteAddr string    `json:"remote_addr"`
+			User       string    `json:"user,omitempty"`
+			Method     string    `json:"method"`
+			URI        string    `json:"uri"`
+			Proto      string    `json:"proto"`
+			Status     int       `json:"status"`
+			Size       int       `json:"size"`
+			DurationMS float64   `json:"duration_ms"`
+			Referer    string    `json:"referer,omitempty"`
+			UserAgent  string    `json:"user_agent,omitempty"`
+			RequestID  string    `json:"request_id,omitempty"`
+		}{start.UTC(), host, entry.user, r.Method, uri, r.Proto, rw.status, rw.size,
+			float64(duration.Microseconds()) / 1000, referer, r.UserAgent(), requestID})
+	default:
+		size := "-"
+		if rw.size > 0 {
+			size = strconv.Itoa(rw.size)
+		}
+		line = fmt.Appendf(nil, "%s - %s [%s] %q %d %s", host, or(entry.user, "-"), start.Format("02/Jan/2006:15:04:05 -0700"),
+			r.Method+" "+uri+" "+r.Proto, rw.status, size)
+		if l.format == "combined" {
+			line = fmt.Appendf(line, " %q %q", or(referer, "-"), or(r.UserAgent(), "-"))
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+// sensitiveParams are the query parameters whose values are left out of the logs: the token of
+// password reset, email verification and team invitation links, and the authorization code and
+// state single sign-on providers redirect back with. Anyone who can read the log shouldn't be
+// able to use them.
+var sensitiveParams = []string{"token", "code", "state"}
+
+func hasSensitiveParams(u *url.URL) bool {
+	q := u.Query()
+	for _, name := range sensitiveParams {
+		if q.Has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURI returns the path and query of u with the values of the sensitiveParams replaced.
+func redactURI(u *url.URL) string {
+	if !hasSensitiveParams(u) {
+		return u.RequestURI()
+	}
+
+	q := u.Query()
+	for _, name := range sensitiveParams {
+		if q.Has(name) {
+			q.Set(name, "REDACTED")
+		}
+	}
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+	return redacted.RequestURI()
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
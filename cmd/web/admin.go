@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// adminSnippetsShown is how many of the most recent snippets the admin area lists.
+const adminSnippetsShown = 100
+
+// listUsers shows every account to admins, with their role and whether they can log in.
+func (app *app) listUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := app.users.List(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "adminusers.page.tmpl", &templateData{Users: users, Roles: models.Roles})
+}
+
+// setUserActive deactivates an account, or activates it again. A deactivated user is logged out
+// everywhere and can't log in until an admin activates them again.
+func (app *app) setUserActive(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	active := r.PostForm.Get("active") == "true"
+	if err := app.users.SetActive(r.Context(), id, active); err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if active {
+		app.session.Put(r, "flash", "The account has been activated")
+	} else {
+		// authenticate would turn the sessions away anyway, this gets them off the sessions table too
+		if err := app.session.Store.DeleteForUser(r.Context(), id); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.session.Put(r, "flash", "The account has been deactivated")
+	}
+
+	app.logger.InfoContext(r.Context(), "account active changed", "user", id, "active", active, "by", app.authenticatedUser(r).ID)
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// setUserRole changes what a user is allowed to do. It takes effect on their next request, as
+// authenticate loads the user afresh every time.
+func (app *app) setUserRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.adminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("role")
+	form.PermittedValues("role", models.Roles...)
+	if !form.Valid() {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	if err := app.users.SetRole(r.Context(), id, form.Get("role")); err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.InfoContext(r.Context(), "account role changed", "user", id, "role", form.Get("role"), "by", app.authenticatedUser(r).ID)
+	app.session.Put(r, "flash", "The role has been changed")
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// adminTarget parses the form of an action on the user in its id field. Admins can't act on
+// themselves, so there's always someone left who can undo a change. When it returns false a
+// response has been written already.
+func (app *app) adminTarget(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return 0, false
+	}
+
+	if id == app.authenticatedUser(r).ID {
+		app.session.Put(r, "flash", "You can't change your own account from here")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return 0, false
+	}
+
+	return id, true
+}
+
+// listAllSnippets shows the most recent snippets of everyone to moderators.
+func (app *app) listAllSnippets(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.Recent(r.Context(), adminSnippetsShown)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "adminsnippets.page.tmpl", &templateData{Snippets: snippets})
+}
+
+// removeSnippet deletes a snippet which shouldn't be up, which deals with its reports as well.
+func (app *app) removeSnippet(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.snippetTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.snippets.Delete(r.Context(), id); err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.reports.Resolve(r.Context(), id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.InfoContext(r.Context(), "snippet removed", "snippet", id, "by", app.authenticatedUser(r).ID)
+	app.session.Put(r, "flash", "The snippet has been removed")
+	http.Redirect(w, r, moderationReturn(r), http.StatusSeeOther)
+}
+
+// snippetTarget parses the form of an action on the snippet in its id field. When it returns
+// false a response has been written already.
+func (app *app) snippetTarget(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		email        string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Anonymous", "", "/admin/snippets", http.StatusFound, "/user/login"},
+		{"User", "alice@example.com", "/admin/snippets", http.StatusForbidden, ""},
+		{"Moderator", "mia@example.com", "/admin/snippets", http.StatusOK, ""},
+		{"Moderator on users", "mia@example.com", "/admin/users", http.StatusForbidden, ""},
+		{"Admin on snippets", "grace@example.com", "/admin/snippets", http.StatusOK, ""},
+		{"Admin on users", "grace@example.com", "/admin/users", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			if tt.email != "" {
+				ts.login(t, tt.email)
+			}
+
+			code, header, _ := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+}
+
+func TestSetUserActive(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	alice := newTestServer(app.setupRoutes())
+	defer alice.Close()
+	admin := newTestServer(app.setupRoutes())
+	defer admin.Close()
+
+	alice.login(t, "alice@example.com")
+	csrfToken := admin.login(t, "grace@example.com")
+
+	tests := []struct {
+		name         string
+		id           string
+		wantCode     int
+		wantLocation string
+	}{
+		{"Unknown user", "99", http.StatusNotFound, ""},
+		{"Invalid ID", "x", http.StatusNotFound, ""},
+		{"Deactivate", "1", http.StatusSeeOther, "/admin/users"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"id": {tt.id}, "active": {"false"}, "csrf_token": {csrfToken}}
+			code, header, _ := admin.postForm(t, "/admin/users/active", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+
+	if loggedIn(t, alice) {
+		t.Error("want alice logged out once deactivated")
+	}
+
+	// admins can't lock themselves out
+	admin.postForm(t, "/admin/users/active", url.Values{"id": {"8"}, "active": {"false"}, "csrf_token": {csrfToken}})
+	code, _, body := admin.get(t, "/admin/users")
+	if code != http.StatusOK || !bytes.Contains(body, []byte("You can&#39;t change your own account from here")) {
+		t.Errorf("want the admin still in with a flash for acting on themselves; got %d %q", code, body)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "grace@example.com")
+
+	tests := []struct {
+		name     string
+		id       string
+		role     string
+		wantCode int
+	}{
+		{"Moderator", "1", "moderator", http.StatusSeeOther},
+		{"Unknown role", "1", "owner", http.StatusBadRequest},
+		{"No role", "1", "", http.StatusBadRequest},
+		{"Unknown user", "99", "admin", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"id": {tt.id}, "role": {tt.role}, "csrf_token": {csrfToken}}
+			if code, _, _ := ts.postForm(t, "/admin/users/role", form); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestRemoveSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		id       string
+		wantCode int
+	}{
+		{"User", "alice@example.com", "1", http.StatusForbidden},
+		{"Moderator", "mia@example.com", "1", http.StatusSeeOther},
+		{"Unknown snippet", "mia@example.com", "2", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			csrfToken := ts.login(t, tt.email)
+
+			form := url.Values{"id": {tt.id}, "csrf_token": {csrfToken}}
+			if code, _, _ := ts.postForm(t, "/admin/snippets/remove", form); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestDeactivatedUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{"email": {"frank@example.com"}, "password": {"validPa$$word"}, "csrf_token": {extractCSRFToken(t, body)}}
+	code, _, body := ts.postForm(t, "/user/login", form)
+	if code != http.StatusOK || !bytes.Contains(body, []byte("This account has been deactivated")) {
+		t.Errorf("want the login refused as deactivated; got %d %q", code, body)
+	}
+
+	// the token frank made before being deactivated stopped working
+	if code, _, _ := ts.do(t, http.MethodGet, "/api/snippets", "FRANKFRANKFRANKFRANKFRANK", ""); code != http.StatusUnauthorized {
+		t.Errorf("want %d for the token; got %d", http.StatusUnauthorized, code)
+	}
+}
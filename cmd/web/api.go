@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/models/mysql"
+)
+
+// apiTokenTTL is how long a token handed out by createToken stays valid.
+const apiTokenTTL = 90 * 24 * time.Hour
+
+// envelope wraps every JSON response so that the payload always sits under a named key.
+type envelope map[string]interface{}
+
+func (app *app) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+// readJSON decodes a request body of at most 1MB into dst, rejecting unknown fields and trailing data.
+func (app *app) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// isAPIRequest tells apart API requests in middleware shared with the web pages, which answer
+// them with a JSON error rather than a page or a redirect.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+func (app *app) apiError(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
+	app.writeJSON(w, r, status, envelope{"error": message})
+}
+
+// authenticateToken is the API counterpart of authenticate. It reads a bearer token from the
+// Authorization header and, if it is valid, adds the owning user to the request context.
+func (app *app) authenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			app.apiError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+			return
+		}
+
+		userID, err := app.tokens.Authenticate(r.Context(), token)
+		if err == models.ErrInvalidCredenetials {
+			app.apiError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+			return
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// tokens of deactivated users stop working along with their sessions
+		user, err := app.users.Get(r.Context(), userID)
+		if err == models.ErrRecordNotFound || (err == nil && !user.Active) {
+			app.apiError(w, r, http.StatusUnauthorized, "invalid or missing authentication token")
+			return
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		setAccessLogUser(ctx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *app) requireTokenUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.authenticatedUser(r) == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			app.apiError(w, r, http.StatusUnauthorized, "you must be authenticated to access this resource")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// createToken exchanges an email and password for a new API token.
+func (app *app) createToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		// Code is the two-factor code, for users who have it enabled.
+		Code string `json:"code"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := app.authenticator.Authenticate(r.Context(), input.Email, input.Password)
+	app.recordLoginAttempt(r, input.Email, err)
+	if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked {
+		app.metrics.loginFailures.Inc()
+		app.apiError(w, r, http.StatusUnauthorized, "Email or Password is incorrect")
+		return
+	} else if err == models.ErrAccountInactive {
+		app.apiError(w, r, http.StatusForbidden, "this account has been deactivated")
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user.TOTPEnabled {
+		if input.Code == "" {
+			app.apiError(w, r, http.StatusUnauthorized, "two-factor code required")
+			return
+		}
+
+		err := app.checkSecondFactor(r.Context(), id, input.Code)
+		if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked {
+			app.metrics.loginFailures.Inc()
+			app.recordSecondFactorAttempt(r, input.Email, err)
+			app.apiError(w, r, http.StatusUnauthorized, "two-factor code is incorrect")
+			return
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	token, err := app.tokens.New(r.Context(), id, apiTokenTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusCreated, envelope{"token": token})
+}
+
+func (app *app) listSnippetsAPI(w http.ResponseWriter, r *http.Request) {
+	snippets, err := app.snippets.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if snippets == nil {
+		snippets = []*models.Snippet{}
+	}
+
+	app.writeJSON(w, r, http.StatusOK, envelope{"snippets": snippets})
+}
+
+// createSnippetAPI runs the same validation as the createSnippet form handler against a JSON body.
+func (app *app) createSnippetAPI(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title    string `json:"title"`
+		Content  string `json:"content"`
+		Language string `json:"language"`
+		Expires  string `json:"expires"`
+	}
+
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := forms.New(url.Values{
+		"title":    {input.Title},
+		"content":  {input.Content},
+		"language": {input.Language},
+		"expires":  {input.Expires},
+	})
+	form.Required("title", "expires", "content")
+	form.PermittedValues("expires", "365", "7", "1")
+	form.MaxLength("title", 100)
+	form.MaxLength("language", 50)
+
+	if !form.Valid() {
+		app.apiError(w, r, http.StatusUnprocessableEntity, form.Errors)
+		return
+	}
+
+	check := app.checkSecrets(r.Context(), form.Get("title"), form.Get("content"), models.VisibilityPublic)
+	if check.blocked {
+		form.Errors.Add(check.field, check.message)
+		app.apiError(w, r, http.StatusUnprocessableEntity, form.Errors)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	id, err := app.snippets.Insert(r.Context(), user.ID, 0, check.title, check.content, form.Get("language"), check.visibility, form.Get("expires"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.metrics.snippetsCreated.Inc()
+
+	snippet, err := app.snippets.Get(mysql.ReadFromPrimary(r.Context()), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := envelope{"snippet": snippet}
+	if check.message != "" {
+		data["warning"] = check.message
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/snippet/%d", id))
+	app.writeJSON(w, r, http.StatusCreated, data)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// do sends a JSON request to the test server, with a bearer token when one is given.
+func (ts *testServer) do(t *testing.T, method, urlPath, token, body string) (int, http.Header, []byte) {
+	req, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, rs.Header, respBody
+}
+
+func TestCreateToken(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid credentials", `{"email":"alice@example.com","password":"validPa$$word"}`, http.StatusCreated, []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZ")},
+		{"Invalid credentials", `{"email":"bob@example.com","password":"validPa$$word"}`, http.StatusUnauthorized, []byte("Email or Password is incorrect")},
+		{"Unknown field", `{"username":"alice"}`, http.StatusBadRequest, nil},
+		{"Malformed JSON", `{"email":`, http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.do(t, http.MethodPost, "/api/tokens", "", tt.body)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestCreateSnippetAPI(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	app.snippets = &insertRecorder{}
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	const token = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	tests := []struct {
+		name     string
+		token    string
+		body     string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid submission", token, `{"title":"t","content":"c","expires":"7"}`, http.StatusCreated, []byte(`"snippet"`)},
+		{"Missing token", "", `{"title":"t","content":"c","expires":"7"}`, http.StatusUnauthorized, nil},
+		{"Invalid token", "wrong", `{"title":"t","content":"c","expires":"7"}`, http.StatusUnauthorized, nil},
+		{"Empty title", token, `{"title":"","content":"c","expires":"7"}`, http.StatusUnprocessableEntity, []byte("This field cannot be blank")},
+		{"Invalid expires", token, `{"title":"t","content":"c","expires":"2"}`, http.StatusUnprocessableEntity, []byte("This field is invalid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.do(t, http.MethodPost, "/api/snippets", tt.token, tt.body)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestRawSnippet(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	code, header, body := ts.get(t, "/snippet/1/raw")
+	if code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+	if ct := header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("want text/plain content type; got %q", ct)
+	}
+	if string(body) != "Ao Kabhi Haveli Pe..." {
+		t.Errorf("want raw snippet content; got %q", body)
+	}
+
+	code, _, body = ts.get(t, "/snippet/ao-kabhi-haveli-pe-k3v9xq2m/raw")
+	if code != http.StatusOK || string(body) != "Ao Kabhi Haveli Pe..." {
+		t.Errorf("want the raw content by slug; got %d %q", code, body)
+	}
+
+	code, _, _ = ts.get(t, "/snippet/2/raw")
+	if code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+
+	// team snippets aren't served raw, by slug either
+	code, _, _ = ts.get(t, "/snippet/deploy-runbook-p7m2x4qa/raw")
+	if code != http.StatusNotFound {
+		t.Errorf("want %d for a team snippet; got %d", http.StatusNotFound, code)
+	}
+}
@@ -1,18 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/vandit1604/snipshot/pkg/forms"
 	"github.com/vandit1604/snipshot/pkg/models"
 )
 
 func (app *app) home(w http.ResponseWriter, r *http.Request) {
-	snippets, err := app.snippets.Latest()
+	snippets, err := app.snippets.Latest(r.Context())
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -25,26 +27,74 @@ func (app *app) home(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *app) showSnippet(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.Atoi(r.URL.Query().Get(":id"))
-	if err != nil || id < 1 {
-		app.notFound(w)
+	snippet, ok := app.snippetFromURL(w, r)
+	if !ok {
 		return
 	}
 
-	snippet, err := app.snippets.Get(id)
+	app.renderSnippet(w, r, snippet, forms.New(nil))
+}
+
+// renderSnippet shows a snippet, form being the one to report it with.
+func (app *app) renderSnippet(w http.ResponseWriter, r *http.Request, snippet *models.Snippet, form *forms.Form) {
+	templateData := templateData{
+		Snippet: snippet,
+		Form:    form,
+		Reasons: models.ReportReasons,
+	}
+	app.render(w, r, "show.page.tmpl", &templateData)
+}
+
+// getSnippet looks up the snippet a URL names, either by its ID or by its slug. Slugs always
+// contain a letter, so they can't be mistaken for an ID.
+func (app *app) getSnippet(ctx context.Context, ref string) (*models.Snippet, error) {
+	if id, err := strconv.Atoi(ref); err == nil {
+		if id < 1 {
+			return nil, models.ErrRecordNotFound
+		}
+		return app.snippets.Get(ctx, id)
+	}
+	return app.snippets.GetBySlug(ctx, ref)
+}
 
+// snippetFromURL loads the snippet in the :id of the URL, an ID or a slug, if the user may see it.
+// When it returns false a response has been written already.
+func (app *app) snippetFromURL(w http.ResponseWriter, r *http.Request) (*models.Snippet, bool) {
+	snippet, err := app.getSnippet(r.Context(), r.URL.Query().Get(":id"))
 	if err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return nil, false
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	}
+
+	// to outsiders a team only snippet doesn't exist
+	if ok, err := app.canView(r, snippet); err != nil {
+		app.serverError(w, r, err)
+		return nil, false
+	} else if !ok {
+		app.notFound(w)
+		return nil, false
+	}
+
+	return snippet, true
+}
+
+// rawSnippet serves just the snippet content as plain text, for curl and the snip client. It
+// runs without the session, so only public snippets are served here.
+func (app *app) rawSnippet(w http.ResponseWriter, r *http.Request) {
+	snippet, err := app.getSnippet(r.Context(), r.URL.Query().Get(":id"))
+	if err == models.ErrRecordNotFound || (err == nil && snippet.Visibility != models.VisibilityPublic) {
 		app.notFound(w)
 		return
 	} else if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
-	templateData := templateData{
-		Snippet: snippet,
-	}
-	app.render(w, r, "show.page.tmpl", &templateData)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(snippet.Content))
 }
 
 func (app *app) createSnippet(w http.ResponseWriter, r *http.Request) {
@@ -57,30 +107,78 @@ func (app *app) createSnippet(w http.ResponseWriter, r *http.Request) {
 	form := forms.New(r.PostForm)
 	form.Required("title", "expires", "content")
 	form.PermittedValues("expires", "365", "7", "1")
+	form.PermittedValues("visibility", models.VisibilityPublic, models.VisibilityTeam)
 	form.MaxLength("title", 100)
+	form.MaxLength("language", 50)
+
+	// the snippet goes to one of the user's teams if they picked one
+	user := app.authenticatedUser(r)
+	var teamID int
+	if slug := form.Get("team"); slug != "" {
+		team, err := app.teams.Get(r.Context(), slug, user.ID)
+		if err == models.ErrRecordNotFound {
+			form.Errors.Add("team", "You aren't a member of this team")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		} else {
+			teamID = team.ID
+		}
+	}
+	visibility := form.Get("visibility")
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	if visibility == models.VisibilityTeam && form.Get("team") == "" {
+		form.Errors.Add("visibility", "Only the snippets of a team can be kept to the team")
+	}
 
 	if !form.Valid() {
-		app.render(w, r, "create.page.tmpl", &templateData{Form: form})
+		app.renderCreateSnippet(w, r, form)
+		return
+	}
+
+	check := app.checkSecrets(r.Context(), form.Get("title"), form.Get("content"), visibility)
+	if check.blocked {
+		form.Errors.Add(check.field, check.message)
+		app.renderCreateSnippet(w, r, form)
 		return
 	}
 
-	id, err := app.snippets.Insert(form.Get("title"), form.Get("content"), form.Get("expires"))
+	id, err := app.snippets.Insert(r.Context(), user.ID, teamID, check.title, check.content, form.Get("language"), check.visibility, form.Get("expires"))
 	if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
 
+	app.metrics.snippetsCreated.Inc()
+
 	// cookie based session management
-	app.session.Put(r, "flash", "Snippet successfully created!")
+	flash := "Snippet successfully created!"
+	if check.message != "" {
+		flash = check.message
+	}
+	app.session.Put(r, "flash", flash)
+	// the redirect below reads the new snippet back, which a lagging replica might not have yet
+	app.session.Put(r, "readPrimaryUntil", time.Now().Add(app.readYourWritesWindow))
 
 	// Redirect the user to the relevant page for the snippet.
 	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", id), http.StatusSeeOther)
 }
 
 func (app *app) createSnippetForm(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "create.page.tmpl", &templateData{
-		Form: forms.New(nil),
-	})
+	app.renderCreateSnippet(w, r, forms.New(nil))
+}
+
+// renderCreateSnippet shows the form to create a snippet, which offers the user's teams to put it in.
+func (app *app) renderCreateSnippet(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	teams, err := app.teams.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "create.page.tmpl", &templateData{Form: form, Teams: teams})
 }
 
 func (app *app) loginUser(w http.ResponseWriter, r *http.Request) {
@@ -91,22 +189,57 @@ func (app *app) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	form := forms.New(r.PostForm)
-	id, err := app.users.Authenticate(form.Get("email"), form.Get("password"))
-	if err == models.ErrInvalidCredenetials {
+	id, err := app.authenticator.Authenticate(r.Context(), form.Get("email"), form.Get("password"))
+	app.recordLoginAttempt(r, form.Get("email"), err)
+	// a locked account gets the same answer as a wrong password, see login.page.tmpl
+	if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked {
+		app.metrics.loginFailures.Inc()
 		form.Errors.Add("generic", "Email or Password is incorrect")
 		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
 		return
+	} else if err == models.ErrAccountInactive {
+		form.Errors.Add("deactivated", "This account has been deactivated")
+		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
+		return
+	} else if err == models.ErrUnverifiedAccount {
+		// a directory login for an address somebody signed up with here but never verified
+		form.Errors.Add("unverified", "There is an unverified account for this address. Reset its password, which proves the address is yours, before logging in with your directory account.")
+		app.render(w, r, "login.page.tmpl", &templateData{Form: form})
+		return
 	} else if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
+		return
+	}
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// users with two-factor authentication aren't logged in until they've entered their code as well
+	if user.TOTPEnabled {
+		app.awaitSecondFactor(r, id, form.Get("remember") != "")
+		http.Redirect(w, r, "/user/login/2fa", http.StatusSeeOther)
 		return
 	}
 
-	// good idea to never specify what the id is
-	app.session.Put(r, "userID", id)
-	app.session.Put(r, "flash", "You have been logged in successfully")
+	app.logIn(r, id, form.Get("remember") != "")
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// loginActivity lists the recent login attempts on the user's account, so they can spot logins
+// that weren't them.
+func (app *app) loginActivity(w http.ResponseWriter, r *http.Request) {
+	attempts, err := app.loginAttempts.ForUser(r.Context(), app.authenticatedUser(r).ID, 50)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "activity.page.tmpl", &templateData{LoginAttempts: attempts})
+}
+
 func (app *app) loginUserForm(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "login.page.tmpl", &templateData{Form: forms.New(nil)})
 }
@@ -132,18 +265,25 @@ func (app *app) signupUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. add user in db if it doesn't exist
-	err = app.users.Insert(form.Get("name"), form.Get("email"), form.Get("password"))
+	err = app.users.Insert(r.Context(), form.Get("name"), form.Get("email"), form.Get("password"))
 	if err == models.ErrDuplicateEmail {
 		form.Errors.Add("email", "Address is already in use")
 		app.render(w, r, "signup.page.tmpl", &templateData{Form: form})
 		return
 	} else if err != nil {
-		app.serverError(w, err)
+		app.serverError(w, r, err)
 		return
 	}
+	app.metrics.signups.Inc()
+
+	// the account exists either way, if the email can't be sent the user can ask for another one once logged in
+	if err := app.sendVerificationEmail(r, form.Get("email")); err != nil {
+		app.logger.ErrorContext(r.Context(), "sending verification email failed", "err", err)
+	}
+
 	// Otherwise add a confirmation flash message to the session confirming tha
 	// their signup worked and asking them to log in.
-	app.session.Put(r, "flash", "Your signup was successful. Please log in.")
+	app.session.Put(r, "flash", "Your signup was successful. Check your email for a link to verify your address, then please log in.")
 	// And redirect the user to the login page.
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
@@ -155,11 +295,15 @@ func (app *app) signupUserForm(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *app) logoutUser(w http.ResponseWriter, r *http.Request) {
-	app.session.Remove(r, "userID")
+	// the session is deleted on the server, a copy of the cookie is no good afterwards either
+	app.session.Destroy(r)
 	app.session.Put(r, "flash", "You have been logged out successfully")
 	http.Redirect(w, r, "/", 303)
 }
 
+// ping is the liveness probe, served on /livez and the older /healthcheck. It only tells whether the
+// process is up and serving HTTP and deliberately checks nothing else: restarting the pod won't
+// fix a database outage. Dependencies are checked by readyz.
 func ping(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
@@ -2,9 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"net/url"
 	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/auth"
+	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/models/mock"
 )
 
 // here we were testing if the server is working fine but to automate this process i have wrote another function
@@ -114,6 +120,8 @@ func TestShowSnippet(t *testing.T) {
 		{"Negative ID", "/snippet/-1", http.StatusNotFound, nil},
 		{"Decimal ID", "/snippet/1.23", http.StatusNotFound, nil},
 		{"String ID", "/snippet/foo", http.StatusNotFound, nil},
+		{"Slug", "/snippet/ao-kabhi-haveli-pe-k3v9xq2m", http.StatusOK, []byte("Ao Kabhi Haveli Pe...")},
+		{"Non-existent slug", "/snippet/ao-kabhi-haveli-pe-aaaaaaaa", http.StatusNotFound, nil},
 		{"Empty ID", "/snippet/", http.StatusNotFound, nil},
 		{"Trailing slash", "/snippet/1/", http.StatusNotFound, nil},
 	}
@@ -208,3 +216,201 @@ func TestSignupUser(t *testing.T) {
 		})
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	ts.get(t, "/snippet/1")
+	ts.get(t, "/snippet/2")
+	ts.do(t, http.MethodPost, "/api/tokens", "", `{"email":"bob@example.com","password":"validPa$$word"}`)
+
+	code, _, body := ts.get(t, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+
+	for _, want := range []string{
+		`snipshot_http_requests_total{code="200",method="get",route="/snippet/:id"} 1`,
+		`snipshot_http_requests_total{code="404",method="get",route="/snippet/:id"} 1`,
+		`snipshot_http_request_duration_seconds_count{method="get",route="/snippet/:id"} 2`,
+		`snipshot_login_failures_total 1`,
+		`snipshot_template_render_errors_total 0`,
+	} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("want metrics to contain %q", want)
+		}
+	}
+
+	// with an admin listener configured /metrics moves off the public mux
+	app.adminAddr = "localhost:0"
+	public := newTestServer(app.setupRoutes())
+	defer public.Close()
+
+	if code, _, _ := public.get(t, "/metrics"); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/readyz")
+	if code != http.StatusOK || !bytes.Contains(body, []byte(`"templates":{"status":"ok"}`)) {
+		t.Errorf("want %d with passing template check; got %d: %s", http.StatusOK, code, body)
+	}
+
+	app.readinessChecks = map[string]readinessCheck{
+		"database": func(ctx context.Context) error { return nil },
+		"migrations": func(ctx context.Context) error {
+			return errors.New("migration 0003_create_tokens.sql has not been applied")
+		},
+	}
+	code, _, body = ts.get(t, "/readyz")
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("want %d; got %d", http.StatusServiceUnavailable, code)
+	}
+	for _, want := range []string{`"status":"not ready"`, `"database":{"status":"ok"}`, `"migrations":{"status":"error","error":"migration 0003_create_tokens.sql has not been applied"}`} {
+		if !bytes.Contains(body, []byte(want)) {
+			t.Errorf("want body to contain %q; got %s", want, body)
+		}
+	}
+
+	app.readinessChecks = nil
+	app.shuttingDown.Store(true)
+	code, _, body = ts.get(t, "/readyz")
+	if code != http.StatusServiceUnavailable || !bytes.Contains(body, []byte(`"shutdown":{"status":"error"`)) {
+		t.Errorf("want %d while shutting down; got %d: %s", http.StatusServiceUnavailable, code, body)
+	}
+
+	// liveness doesn't care about any of this
+	if code, _, _ := ts.get(t, "/livez"); code != http.StatusOK {
+		t.Errorf("want %d; got %d", http.StatusOK, code)
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name      string
+		userEmail string
+		wantCode  int
+		wantBody  []byte
+	}{
+		{"Wrong password", "bob@example.com", http.StatusOK, []byte("Email or Password is incorrect")},
+		// a locked account must look the same as a wrong password
+		{"Locked account", "locked@example.com", http.StatusOK, []byte("Email or Password is incorrect")},
+		{"Valid credentials", "alice@example.com", http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			form.Add("email", tt.userEmail)
+			form.Add("password", "validPa$$word")
+			form.Add("csrf_token", csrfToken)
+
+			code, _, body := ts.postForm(t, "/user/login", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	// logged in as alice by the last case
+	code, _, body := ts.get(t, "/user/activity")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("192.0.2.1")) {
+		t.Errorf("want body to list the recorded login attempts, but got %q", body)
+	}
+	if !bytes.Contains(body, []byte("Right password, wrong two-factor code")) || !bytes.Contains(body, []byte("Wrong password")) {
+		t.Errorf("want wrong codes told apart from wrong passwords, but got %q", body)
+	}
+}
+
+// directoryAuthenticator stands in for a directory like LDAP, where carol logs in by username.
+// mallory's address belongs to a local account which was never verified.
+type directoryAuthenticator struct{}
+
+func (directoryAuthenticator) Authenticate(ctx context.Context, login, password string) (int, error) {
+	if login == "carol" && password == "directoryPa55" {
+		return 2, nil
+	}
+	if login == "mallory" && password == "directoryPa55" {
+		return 0, models.ErrUnverifiedAccount
+	}
+	return 0, models.ErrInvalidCredenetials
+}
+
+func TestLoginUserAuthenticatorChain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		login     string
+		password  string
+		wantCode  int
+		wantBody  []byte
+		wantLogin string
+	}{
+		{"Directory user", "carol", "directoryPa55", http.StatusSeeOther, nil, "carol@example.com"},
+		{"Directory user, wrong password", "carol", "validPa$$word", http.StatusOK, []byte("Email or Password is incorrect"), ""},
+		{"Directory user, unverified local account", "mallory", "directoryPa55", http.StatusOK, []byte("Reset its password, which proves the address is yours"), ""},
+		{"Local user", "alice@example.com", "validPa$$word", http.StatusSeeOther, nil, "mail@mail.mail"},
+		{"Locked local user", "locked@example.com", "validPa$$word", http.StatusOK, []byte("Email or Password is incorrect"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.authenticator = auth.Chain{directoryAuthenticator{}, &mock.UserModel{}}
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+			form := url.Values{}
+			form.Add("email", tt.login)
+			form.Add("password", tt.password)
+			form.Add("csrf_token", extractCSRFToken(t, body))
+
+			code, _, body := ts.postForm(t, "/user/login", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+
+			code, _, body = ts.get(t, "/user/profile")
+			if tt.wantLogin == "" {
+				if code != http.StatusFound {
+					t.Errorf("want %d for the profile when not logged in; got %d", http.StatusFound, code)
+				}
+				return
+			}
+			if code != http.StatusOK || !bytes.Contains(body, []byte(tt.wantLogin)) {
+				t.Errorf("want to be logged in as %s; got %d", tt.wantLogin, code)
+			}
+		})
+	}
+}
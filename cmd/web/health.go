@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessCheck reports why the app can't serve traffic, or nil if the dependency it checks is fine.
+type readinessCheck func(context.Context) error
+
+// readinessTimeout bounds each check, a probe that hangs is as bad as one that fails.
+const readinessTimeout = 2 * time.Second
+
+// readyz runs every readiness check and returns 503 unless all of them pass, with the outcome of
+// each check in the body. It always fails once shutdown has started, so that load balancers
+// stop sending requests while the in-flight ones finish.
+func (app *app) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]readinessCheck{"templates": app.checkTemplates}
+	for name, check := range app.readinessChecks {
+		checks[name] = check
+	}
+
+	type result struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]result{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check readinessCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			defer cancel()
+
+			res := result{Status: "ok"}
+			if err := check(ctx); err != nil {
+				res = result{Status: "error", Error: err.Error()}
+			}
+
+			mu.Lock()
+			results[name] = res
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if app.shuttingDown.Load() {
+		results["shutdown"] = result{Status: "error", Error: "server is shutting down"}
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, res := range results {
+		if res.Status != "ok" {
+			status, code = "not ready", http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	app.writeJSON(w, r, code, envelope{"status": status, "checks": results})
+}
+
+func (app *app) checkTemplates(ctx context.Context) error {
+	if len(app.templateCache) == 0 {
+		return errors.New("template cache is empty")
+	}
+	return nil
+}
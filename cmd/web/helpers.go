@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime/debug"
@@ -11,10 +12,15 @@ import (
 	"github.com/vandit1604/snipshot/pkg/models"
 )
 
-func (app *app) serverError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.errorLog.Output(2, trace)
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+func (app *app) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.ErrorContext(r.Context(), err.Error(), "method", r.Method, "uri", redactURI(r.URL), "trace", string(debug.Stack()))
+
+	// the request ID lets a user reporting the error point us at the matching log line
+	message := http.StatusText(http.StatusInternalServerError)
+	if id, ok := r.Context().Value(contextKeyRequestID).(string); ok {
+		message = fmt.Sprintf("%s (request ID %s)", message, id)
+	}
+	http.Error(w, message, http.StatusInternalServerError)
 }
 
 func (app *app) clientError(w http.ResponseWriter, status int) {
@@ -28,7 +34,8 @@ func (app *app) notFound(w http.ResponseWriter) {
 func (app *app) render(w http.ResponseWriter, r *http.Request, pageName string, data *templateData) {
 	ts, ok := app.templateCache[pageName]
 	if !ok {
-		app.serverError(w, fmt.Errorf("template set not found in cache with name %s", pageName))
+		app.metrics.renderErrors.Inc()
+		app.serverError(w, r, fmt.Errorf("template set not found in cache with name %s", pageName))
 		return
 	}
 
@@ -38,9 +45,12 @@ func (app *app) render(w http.ResponseWriter, r *http.Request, pageName string,
 	// init a buffer
 	buf := new(bytes.Buffer)
 
+	span := app.startRenderSpan(r.Context(), pageName)
 	err := ts.Execute(buf, data)
+	span.End()
 	if err != nil {
-		app.serverError(w, err)
+		app.metrics.renderErrors.Inc()
+		app.serverError(w, r, err)
 		return
 	}
 
@@ -56,6 +66,9 @@ func (app *app) addDefaultData(td *templateData, r *http.Request) *templateData
 	td.CSRFToken = nosurf.Token(r)
 	td.AuthenticatedUser = app.authenticatedUser(r)
 	td.CurrentYear = time.Now().Year()
+	if app.oidc != nil {
+		td.SSO = app.oidc.name
+	}
 	// Add the flash message to the template data, if one exists.
 	td.Flash = app.session.PopString(r, "flash")
 	return td
@@ -69,3 +82,51 @@ func (app *app) authenticatedUser(r *http.Request) *models.User {
 	}
 	return user
 }
+
+// logIn makes the session of r the user's, once they've proven who they are one way or another.
+// The session gets a new token, so one planted before in the user's browser isn't logged in with
+// them. If remember is set it lasts past the browser being closed.
+func (app *app) logIn(r *http.Request, id int, remember bool) {
+	app.session.RememberMe(r, remember)
+	// good idea to never specify what the id is
+	app.session.Put(r, "userID", id)
+	// authenticate compares this with the time the password last changed, to log out sessions from before a reset
+	app.session.Put(r, "authTime", time.Now())
+	app.session.Put(r, "flash", "You have been logged in successfully")
+}
+
+// recordLoginAttempt audits a login with the outcome of Authenticate. Other errors aren't
+// recorded as the credentials never got checked, and failing to write the record doesn't fail
+// the login.
+func (app *app) recordLoginAttempt(r *http.Request, email string, err error) {
+	outcome := models.LoginSucceeded
+	switch {
+	case errors.Is(err, models.ErrInvalidCredenetials):
+		outcome = models.LoginFailed
+	case errors.Is(err, models.ErrAccountLocked):
+		outcome = models.LoginLocked
+	case errors.Is(err, models.ErrAccountInactive):
+		outcome = models.LoginDeactivated
+	case err != nil:
+		return
+	}
+
+	app.insertLoginAttempt(r, email, outcome)
+}
+
+// recordSecondFactorAttempt audits the second step of a login with the outcome of
+// checkSecondFactor. A wrong code is told apart from a wrong password, as whoever entered it knows
+// the password.
+func (app *app) recordSecondFactorAttempt(r *http.Request, email string, err error) {
+	if errors.Is(err, models.ErrInvalidCredenetials) {
+		app.insertLoginAttempt(r, email, models.LoginSecondFactorFailed)
+		return
+	}
+	app.recordLoginAttempt(r, email, err)
+}
+
+func (app *app) insertLoginAttempt(r *http.Request, email, outcome string) {
+	if err := app.loginAttempts.Insert(r.Context(), email, clientIP(r), r.UserAgent(), outcome); err != nil {
+		app.logger.ErrorContext(r.Context(), "recording login attempt failed", "err", err)
+	}
+}
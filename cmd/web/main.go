@@ -1,85 +1,494 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
 	"database/sql"
+	"encoding/gob"
+	"errors"
 	"flag"
+	"fmt"
 	"html/template"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/golangcollege/sessions"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/redis/go-redis/v9"
+	"github.com/vandit1604/snipshot/pkg/auth"
+	"github.com/vandit1604/snipshot/pkg/mailer"
 	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/models/cache"
 	"github.com/vandit1604/snipshot/pkg/models/mysql"
+	"github.com/vandit1604/snipshot/pkg/ratelimit"
+	"github.com/vandit1604/snipshot/pkg/secrets"
+	"github.com/vandit1604/snipshot/pkg/session"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
+// the session cookie is gob encoded and has to know every concrete type stored in it, we store
+// times under "authTime", "pendingUntil" and "readPrimaryUntil"
+func init() {
+	gob.Register(time.Time{})
+}
+
 type contextKey string
 
 var contextKeyUser = contextKey("user")
+var contextKeyRequestID = contextKey("requestID")
+var contextKeyTeam = contextKey("team")
 
 type app struct {
-	errorLog      *log.Logger
-	infoLog       *log.Logger
-	session       *sessions.Session
+	logger  *slog.Logger
+	metrics *metrics
+	tracer  trace.Tracer
+	// readinessChecks are run by /readyz on top of the template check, keyed by the name reported for them.
+	readinessChecks map[string]readinessCheck
+	// shuttingDown is set once graceful shutdown starts and makes /readyz fail.
+	shuttingDown atomic.Bool
+	// adminAddr is the address of the admin listener serving /metrics. When empty /metrics is served by the main mux.
+	adminAddr string
+	// accessLog is nil when access logging is turned off.
+	accessLog     *accessLogger
+	session       *session.Manager
 	templateCache map[string]*template.Template
+	rateLimits    rateLimits
+	mailer        mailer.Mailer
+	// verificationKey signs the tokens in verification emails.
+	verificationKey []byte
+	// webauthn runs the passkey registration and login ceremonies.
+	webauthn *webauthn.WebAuthn
+	// authenticator checks passwords at login, the users table itself unless -auth says otherwise.
+	authenticator auth.Authenticator
+	// oidc is nil unless single sign-on through an OpenID Connect provider is configured.
+	oidc *oidcProvider
+	// baseURL is where the app is reached from outside, for links in emails. When empty the Host of the request is used.
+	baseURL string
+	// readYourWritesWindow is how long reads are pinned to the primary database after a user writes, to hide replication lag.
+	readYourWritesWindow time.Duration
+	// secrets scans new snippets for credentials, secretsAction says what happens to those it finds one in.
+	secrets       *secrets.Scanner
+	secretsAction secrets.Action
 	// during testing this will complain when creating a mock for the mock app instance. That's why we created this as a interface which contains both the functions which are defined in mock package.
-	snippets interface {
-		Insert(string, string, string) (int, error)
-		Get(int) (*models.Snippet, error)
-		Latest() ([]*models.Snippet, error)
+	snippets snippetModel
+	users    interface {
+		Insert(context.Context, string, string, string) error
+		Get(context.Context, int) (*models.User, error)
+		Verify(context.Context, string) error
+		UpdateProfile(context.Context, int, string, string) error
+		ChangePassword(context.Context, int, string, string) error
+		EnableTOTP(context.Context, int, string, []string) error
+		DisableTOTP(context.Context, int) error
+		TOTPSecret(context.Context, int) (string, error)
+		UseTOTPStep(context.Context, int, int64) error
+		UseRecoveryCode(context.Context, int, string) error
+		SecondFactorFailed(context.Context, int) error
+		ExternalLogin(context.Context, string, string, string, string, bool) (int, error)
+		List(context.Context) ([]*models.User, error)
+		SetActive(context.Context, int, bool) error
+		SetRole(context.Context, int, string) error
+	}
+	tokens interface {
+		New(context.Context, int, time.Duration) (*models.Token, error)
+		Authenticate(context.Context, string) (int, error)
+		DeleteForUser(context.Context, int) error
+	}
+	passwordResets interface {
+		New(context.Context, string, time.Duration) (*models.Token, error)
+		Reset(context.Context, string, string) error
+	}
+	passkeys interface {
+		Insert(context.Context, *models.Passkey) error
+		ForUser(context.Context, int) ([]*models.Passkey, error)
+		Use(context.Context, []byte, uint32, bool) error
+		Delete(context.Context, int, []byte) error
 	}
-	users interface {
-		Insert(string, string, string) error
-		Authenticate(string, string) (int, error)
-		Get(int) (*models.User, error)
+	loginAttempts interface {
+		Insert(context.Context, string, string, string, string) error
+		ForUser(context.Context, int, int) ([]*models.LoginAttempt, error)
+	}
+	teams interface {
+		Insert(context.Context, int, string, string) (int, error)
+		Get(context.Context, string, int) (*models.Team, error)
+		Role(context.Context, int, int) (string, error)
+		ForUser(context.Context, int) ([]*models.Team, error)
+		Members(context.Context, int) ([]*models.Member, error)
+		RemoveMember(context.Context, int, int) error
+		Invite(context.Context, int, string, string, time.Duration) (*models.Token, error)
+		Accept(context.Context, string, int, string) (*models.Team, error)
+	}
+	reports interface {
+		Insert(context.Context, int, int, string, string) (int, error)
+		Queue(context.Context) ([]*models.ReportedSnippet, error)
+		Resolve(context.Context, int) error
 	}
 }
 
+// snippetModel is implemented by mysql.SnippetModel, the cache.SnippetModel wrapping it and mock.SnippetModel.
+type snippetModel interface {
+	Insert(context.Context, int, int, string, string, string, string, string) (int, error)
+	Get(context.Context, int) (*models.Snippet, error)
+	GetBySlug(context.Context, string) (*models.Snippet, error)
+	Latest(context.Context) ([]*models.Snippet, error)
+	ForUser(context.Context, int) ([]*models.Snippet, error)
+	ForTeam(context.Context, int) ([]*models.Snippet, error)
+	Recent(context.Context, int) ([]*models.Snippet, error)
+	Delete(context.Context, int) error
+	Find(context.Context, int) (*models.Snippet, error)
+	SetHidden(context.Context, int, bool) error
+}
+
 func main() {
 	// cli flags
 	addr := flag.String("addr", ":4000", "Host Port")
 	dsn := flag.String("dsn", "web:qwe@/snippetbox?parseTime=true", "Connection string for MySQL Database")
-	secret := flag.String("secret", "s6Ndh+pPbnzHbS*+9Pk8qGWhTzbpa@ge", "JWT secret key")
+	dbTimeout := flag.Duration("db-timeout", 3*time.Second, "Deadline for each database query, 0 to only rely on the request context")
+	var pool dbPool
+	flag.IntVar(&pool.maxOpenConns, "db-max-open-conns", 25, "Maximum number of open MySQL connections, 0 for unlimited")
+	flag.IntVar(&pool.maxIdleConns, "db-max-idle-conns", 25, "Maximum number of idle MySQL connections")
+	flag.DurationVar(&pool.connMaxLifetime, "db-conn-max-lifetime", time.Hour, "Maximum time a MySQL connection may be reused, 0 for no limit")
+	flag.DurationVar(&pool.connMaxIdleTime, "db-conn-max-idle-time", 15*time.Minute, "Maximum time a MySQL connection may sit idle, 0 for no limit")
+	var replicaDSNs []string
+	flag.Func("replica-dsn", "Connection string for a MySQL read replica, may be repeated", func(dsn string) error {
+		replicaDSNs = append(replicaDSNs, dsn)
+		return nil
+	})
+	replicaCheck := flag.Duration("replica-check-interval", 5*time.Second, "How often read replicas are health checked")
+	cacheSize := flag.Int("cache-size", 1000, "Number of snippet cache entries kept in process, 0 disables the cache")
+	cacheTTL := flag.Duration("cache-ttl", 30*time.Second, "How long cached snippets and listings are served before going back to MySQL")
+	cacheRedis := flag.String("cache-redis", "", "Address of a Redis compatible server to use as a shared snippet cache instead of the in-process one")
+	readYourWrites := flag.Duration("read-your-writes", 5*time.Second, "How long a user's reads go to the primary after they write")
+	logFormat := flag.String("log-format", "text", "Log output format, text or json")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	accessLogPath := flag.String("access-log", "-", "File the access log is appended to, - for stdout or empty to disable it")
+	accessLogFormat := flag.String("access-log-format", "combined", "Access log format: common, combined or json")
+	accessLogSample := flag.Float64("access-log-sample", 1, "Fraction of requests written to the access log, server errors are always logged")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "host:port of an OTLP/HTTP collector to export traces to, empty disables tracing")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "Export traces over plain HTTP instead of HTTPS")
+	traceSample := flag.Float64("trace-sample", 1, "Fraction of new traces sampled, requests continuing a trace follow the caller's decision")
+	loginLimit := flag.String("rate-limit-login", "10/m", "Login attempts allowed per client IP, as requests/unit[:burst] with unit s, m or h, 0 to disable")
+	signupLimit := flag.String("rate-limit-signup", "5/h", "Signups, and separately password reset requests, allowed per client IP, 0 to disable")
+	createLimit := flag.String("rate-limit-create", "30/m:10", "Snippets a user may create, 0 to disable")
+	reportLimit := flag.String("rate-limit-report", "10/h", "Snippet reports allowed per user, or client IP for visitors, 0 to disable")
+	secretsAction := flag.String("secrets", "block", "What to do with a new snippet containing a credential: block it, make it private, redact the credential, or off to not scan")
+	secretsEntropy := flag.Float64("secrets-entropy", 4.5, "Bits per character from which a long random looking string counts as a credential, 0 to only look for known formats")
+	lockout := mysql.Lockout{}
+	flag.IntVar(&lockout.Threshold, "lockout-threshold", 5, "Failed logins in a row after which an account is locked, 0 to never lock")
+	flag.DurationVar(&lockout.Duration, "lockout-duration", time.Minute, "How long an account is first locked, doubling with every further failed login")
+	flag.DurationVar(&lockout.MaxDuration, "lockout-max-duration", time.Hour, "Longest an account is locked for")
+	rateLimitRedis := flag.String("rate-limit-redis", "", "Address of a Redis compatible server to keep rate limits in, so they are shared between instances")
+	baseURL := flag.String("base-url", "", "URL the app is reached at, e.g. https://snippets.example.com, for links in emails; defaults to the Host of the request")
+	passkeyOrigin := flag.String("passkey-origin", "", "Origin passkeys are registered for, e.g. https://snippets.example.com; defaults to -base-url, or https://localhost:4000 without it")
+	oidcIssuer := flag.String("oidc-issuer", "", "URL of an OpenID Connect provider to offer single sign-on with, e.g. https://accounts.example.com; empty disables it")
+	oidcName := flag.String("oidc-name", "SSO", "Name of the OpenID Connect provider shown on the login page")
+	oidcClientID := flag.String("oidc-client-id", "", "Client ID registered with the OpenID Connect provider")
+	oidcClientSecret := flag.String("oidc-client-secret", "", "Client secret registered with the OpenID Connect provider")
+	oidcDomains := flag.String("oidc-allowed-domains", "", "Comma separated email domains allowed to log in with single sign-on, empty allows any")
+	oidcProvision := flag.Bool("oidc-auto-provision", true, "Create accounts for single sign-on users who don't have one yet")
+	authBackends := flag.String("auth", "local", "Comma separated password backends tried in order at login: local for the users table, ldap for the directory of -ldap-url")
+	ldapURL := flag.String("ldap-url", "", "URL of the LDAP server, ldap://host:389 or ldaps://host:636")
+	ldapStartTLS := flag.Bool("ldap-start-tls", false, "Upgrade ldap:// connections with StartTLS")
+	ldapBindDN := flag.String("ldap-bind-dn", "", "DN of the service account searching the directory for users, empty to search anonymously")
+	ldapBindPassword := flag.String("ldap-bind-password", "", "Password of the LDAP service account")
+	ldapBaseDN := flag.String("ldap-base-dn", "", "DN under which users are searched for, e.g. ou=people,dc=example,dc=com")
+	ldapFilter := flag.String("ldap-filter", "(&(objectClass=inetOrgPerson)(|(uid=%s)(mail=%s)))", "LDAP filter finding the user logging in, %s stands for what they typed")
+	ldapEmailAttr := flag.String("ldap-email-attr", "mail", "LDAP attribute with the user's email address, which links them to their account")
+	ldapNameAttr := flag.String("ldap-name-attr", "cn", "LDAP attribute with the user's name")
+	ldapProvision := flag.Bool("ldap-auto-provision", true, "Create accounts for directory users who don't have one yet")
+	sessionStore := flag.String("session-store", "mysql", "Where sessions are kept: mysql, shared by every instance, or memory, lost on restart")
+	sessionLifetime := flag.Duration("session-lifetime", 12*time.Hour, "How long a session lasts from logging in, however active it is")
+	sessionIdleTimeout := flag.Duration("session-idle-timeout", 30*time.Minute, "How long a session lasts without being used, 0 to only rely on -session-lifetime")
+	sessionRemember := flag.Duration("session-remember", 30*24*time.Hour, "How long a session lasts when \"Remember me\" was ticked at login; those don't time out when idle")
+	smtpAddr := flag.String("smtp-addr", "", "host:port of the SMTP server to send email through")
+	smtpUsername := flag.String("smtp-username", "", "Username for the SMTP server")
+	smtpPassword := flag.String("smtp-password", "", "Password for the SMTP server")
+	mailFrom := flag.String("mail-from", "Snippetbox <no-reply@snippetbox.local>", "Sender address of outgoing email")
+	mailDir := flag.String("mail-dir", "", "Write outgoing email to files in this directory instead of sending it, for development")
+	mailLog := flag.Bool("mail-log", false, "Write outgoing email to the log instead of sending it, for development only: the log then holds the verification and reset links")
+	migrate := flag.Bool("migrate", false, "Apply pending database migrations before starting")
+	shutdownDelay := flag.Duration("shutdown-delay", 5*time.Second, "How long /readyz reports not ready before the listener closes on shutdown")
+	adminAddr := flag.String("admin-addr", "", "Address of a separate plain HTTP listener for /metrics, empty to serve it on -addr")
+	secret := flag.String("secret", "", "Key signing email verification links, at least 32 characters, e.g. from openssl rand -base64 32 (required)")
 	flag.Parse()
 
-	// loggers
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	// logger
+	logger, err := newLogger(os.Stdout, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fatal := func(err error) {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// a default key would be in the source for anyone to sign verification links with
+	if len(*secret) < 32 {
+		fatal(errors.New("-secret must be set to a random key of at least 32 characters"))
+	}
+
+	// email carries the verification, reset and invitation links, it doesn't fall back to the log
+	if *smtpAddr == "" && *mailDir == "" && !*mailLog {
+		fatal(errors.New("no mailer configured: set -smtp-addr, or -mail-dir or -mail-log for development"))
+	}
+
+	var accessLog *accessLogger
+	if *accessLogPath != "" {
+		out := io.Writer(os.Stdout)
+		if *accessLogPath != "-" {
+			f, err := os.OpenFile(*accessLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		accessLog, err = newAccessLogger(out, *accessLogFormat, *accessLogSample)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	tracerProvider := trace.TracerProvider(noop.NewTracerProvider())
+	if *otlpEndpoint != "" {
+		tp, err := newTracerProvider(context.Background(), *otlpEndpoint, *otlpInsecure, *traceSample)
+		if err != nil {
+			fatal(err)
+		}
+		// flush the spans still buffered on the way out
+		defer tp.Shutdown(context.Background())
+		tracerProvider = tp
+	}
 
 	// DB
-	db, err := OpenDB(dsn)
+	db, err := OpenDB(dsn, pool)
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal(err)
 	}
 
 	defer db.Close()
 
+	if *migrate {
+		if err := mysql.Migrate(context.Background(), db); err != nil {
+			fatal(err)
+		}
+	}
+
+	// a replica that is down doesn't stop the start, it's out of rotation until a health check passes
+	var replicas []*sql.DB
+	for _, dsn := range replicaDSNs {
+		replica, err := openPool(dsn, pool)
+		if err != nil {
+			fatal(err)
+		}
+		defer replica.Close()
+		replicas = append(replicas, replica)
+	}
+	cluster := mysql.NewCluster(db, replicas...)
+	cluster.Check(context.Background(), *dbTimeout)
+	for i, r := range cluster.Replicas {
+		if !r.Healthy() {
+			logger.Warn("read replica unreachable, starting without it", "replica", i)
+		}
+	}
+
+	healthCtx, stopHealthChecks := context.WithCancel(context.Background())
+	defer stopHealthChecks()
+	go cluster.CheckHealth(healthCtx, *replicaCheck, *dbTimeout)
+
+	// the snippet statements are prepared once here and closed on shutdown, before the pool itself is closed
+	snippets, err := mysql.NewSnippetModel(cluster, *dbTimeout)
+	if err != nil {
+		fatal(err)
+	}
+
+	defer snippets.Close()
+
+	metrics := newMetrics()
+	metrics.registry.MustRegister(collectors.NewDBStatsCollector(db, "primary"))
+	for i, replica := range replicas {
+		metrics.registry.MustRegister(collectors.NewDBStatsCollector(replica, fmt.Sprintf("replica-%d", i)))
+	}
+
+	var snippetModel snippetModel = snippets
+	var snippetCache *cache.SnippetModel
+	switch {
+	case *cacheRedis != "":
+		client := redis.NewClient(&redis.Options{Addr: *cacheRedis})
+		defer client.Close()
+		snippetCache = &cache.SnippetModel{Model: snippets, Backend: &cache.Redis{Client: client, Prefix: "snipshot:"}, TTL: *cacheTTL}
+	case *cacheSize > 0:
+		snippetCache = &cache.SnippetModel{Model: snippets, Backend: cache.NewLRU(*cacheSize), TTL: *cacheTTL}
+	}
+	if snippetCache != nil {
+		snippetModel = snippetCache
+		metrics.registerCache(snippetCache)
+	}
+
+	limits := rateLimits{store: ratelimit.NewMemory()}
+	for _, l := range []struct {
+		policy *ratelimit.Policy
+		spec   string
+	}{{&limits.login, *loginLimit}, {&limits.signup, *signupLimit}, {&limits.createSnippet, *createLimit}, {&limits.report, *reportLimit}} {
+		if *l.policy, err = ratelimit.ParsePolicy(l.spec); err != nil {
+			fatal(err)
+		}
+	}
+	secretsPolicy, err := secrets.ParseAction(*secretsAction)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *rateLimitRedis != "" {
+		client := redis.NewClient(&redis.Options{Addr: *rateLimitRedis})
+		defer client.Close()
+		limits.store = &ratelimit.Redis{Client: client, Prefix: "snipshot:ratelimit:"}
+	}
+
+	var mail mailer.Mailer
+	switch {
+	case *smtpAddr != "":
+		mail = &mailer.SMTP{Addr: *smtpAddr, Username: *smtpUsername, Password: *smtpPassword, From: *mailFrom}
+	case *mailDir != "":
+		mail = &mailer.File{Dir: *mailDir, From: *mailFrom}
+	default:
+		logger.Warn("-mail-log is set: outgoing email is written to the log, links and tokens included. Never use it in production")
+		mail = &mailer.Log{Logger: logger}
+	}
+
+	// the verification tokens get a key of their own, derived from the secret, so they can't be confused with anything else signed with it
+	verificationKey := hmac.New(sha256.New, []byte(*secret))
+	verificationKey.Write([]byte("snipshot email verification"))
+
+	// passkeys are bound to the host name they were created on, so the origin has to be known up front rather than taken from requests
+	origin := *passkeyOrigin
+	if origin == "" {
+		origin = *baseURL
+	}
+	if origin == "" {
+		origin = "https://localhost:4000"
+	}
+	webAuthn, err := newWebAuthn(origin)
+	if err != nil {
+		fatal(err)
+	}
+
+	var sso *oidcProvider
+	if *oidcIssuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		sso, err = newOIDCProvider(ctx, *oidcName, *oidcIssuer, *oidcClientID, *oidcClientSecret, strings.Split(*oidcDomains, ","), *oidcProvision)
+		cancel()
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	users := &mysql.UserModel{DB: db, Timeout: *dbTimeout, Lockout: lockout}
+	var authenticator auth.Chain
+	for _, backend := range strings.Split(*authBackends, ",") {
+		switch strings.TrimSpace(backend) {
+		case "local":
+			authenticator = append(authenticator, users)
+		case "ldap":
+			if *ldapURL == "" {
+				fatal(errors.New("-auth ldap needs -ldap-url"))
+			}
+			authenticator = append(authenticator, &auth.LDAP{
+				URL:            *ldapURL,
+				StartTLS:       *ldapStartTLS,
+				BindDN:         *ldapBindDN,
+				BindPassword:   *ldapBindPassword,
+				BaseDN:         *ldapBaseDN,
+				Filter:         *ldapFilter,
+				EmailAttribute: *ldapEmailAttr,
+				NameAttribute:  *ldapNameAttr,
+				Timeout:        5 * time.Second,
+				Users:          users,
+				Provision:      *ldapProvision,
+			})
+		default:
+			fatal(fmt.Errorf("unknown -auth backend %q", backend))
+		}
+	}
+
 	// templateSet cache
-	cache, err := NewTemplateCache("./ui/html")
+	templateCache, err := NewTemplateCache("./ui/html")
 	if err != nil {
-		errorLog.Fatal(err)
+		fatal(err)
 	}
 
-	// session // here i have passed the pointer deference which gives the value
-	session := sessions.New([]byte(*secret))
-	session.Lifetime = 12 * time.Hour
-	session.Secure = true
+	// sessions are kept on the server, the cookie only holds a random token
+	var store session.Store
+	switch *sessionStore {
+	case "mysql":
+		store = &mysql.SessionModel{DB: db, Timeout: *dbTimeout}
+	case "memory":
+		store = session.NewMemory()
+	default:
+		fatal(fmt.Errorf("unknown -session-store %q", *sessionStore))
+	}
+	sessionManager := session.New(store)
+	sessionManager.Lifetime = *sessionLifetime
+	sessionManager.IdleTimeout = *sessionIdleTimeout
+	sessionManager.RememberLifetime = *sessionRemember
+	sessionManager.Secure = true
 	// to mitigate csrf attacks
-	session.SameSite = http.SameSiteStrictMode
+	sessionManager.SameSite = http.SameSiteStrictMode
+	sessionManager.ClientIP = clientIP
+
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go sessionManager.Cleanup(cleanupCtx, 10*time.Minute)
 
 	// SnippetModel
 	app := &app{
-		errorLog:      errorLog,
-		infoLog:       infoLog,
-		snippets:      &mysql.SnippetModel{DB: db},
-		users:         &mysql.UserModel{DB: db},
-		templateCache: cache,
-		session:       session,
+		logger:    logger,
+		accessLog: accessLog,
+		metrics:   metrics,
+		tracer:    tracerProvider.Tracer(tracerName),
+		readinessChecks: map[string]readinessCheck{
+			"database": db.PingContext,
+			"migrations": func(ctx context.Context) error {
+				return mysql.CheckMigrations(ctx, db)
+			},
+		},
+		adminAddr:            *adminAddr,
+		snippets:             snippetModel,
+		users:                users,
+		authenticator:        authenticator,
+		tokens:               &mysql.TokenModel{DB: db, Timeout: *dbTimeout},
+		passkeys:             &mysql.PasskeyModel{DB: db, Timeout: *dbTimeout},
+		loginAttempts:        &mysql.LoginAttemptModel{DB: db, Timeout: *dbTimeout},
+		passwordResets:       &mysql.PasswordResetModel{DB: db, Timeout: *dbTimeout},
+		teams:                &mysql.TeamModel{DB: db, Timeout: *dbTimeout},
+		reports:              &mysql.ReportModel{DB: db, Timeout: *dbTimeout},
+		templateCache:        templateCache,
+		session:              sessionManager,
+		rateLimits:           limits,
+		mailer:               mail,
+		verificationKey:      verificationKey.Sum(nil),
+		webauthn:             webAuthn,
+		oidc:                 sso,
+		baseURL:              *baseURL,
+		readYourWritesWindow: *readYourWrites,
+		secrets:              &secrets.Scanner{MinEntropy: *secretsEntropy},
+		secretsAction:        secretsPolicy,
 	}
 
+	sessionManager.ErrorHandler = app.serverError
+
 	mux := app.setupRoutes()
 
 	// tls config
@@ -99,29 +508,101 @@ func main() {
 	srv := http.Server{
 		Addr:         *addr,
 		Handler:      mux,
-		ErrorLog:     errorLog,
+		ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
 		TLSConfig:    tlsConfig,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 	}
 
-	infoLog.Printf("Starting server on %s", *addr)
+	var adminSrv *http.Server
+	if *adminAddr != "" {
+		adminSrv = &http.Server{
+			Addr:         *adminAddr,
+			Handler:      app.adminRoutes(),
+			ErrorLog:     slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+	}
+
+	// on SIGINT/SIGTERM stop accepting connections and give in-flight requests time to finish, so the deferred cleanup above gets to run
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+
+		// keep serving while /readyz fails, giving load balancers time to take us out of rotation
+		app.shuttingDown.Store(true)
+		logger.Info("shutting down server", "delay", *shutdownDelay)
+		time.Sleep(*shutdownDelay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		if adminSrv != nil {
+			adminSrv.Shutdown(ctx)
+		}
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	if adminSrv != nil {
+		go func() {
+			logger.Info("starting admin server", "addr", *adminAddr)
+			if err := adminSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				fatal(err)
+			}
+		}()
+	}
+
+	logger.Info("starting server", "addr", *addr)
 	err = srv.ListenAndServeTLS("./tls/cert.pem", "./tls/key.pem")
+	if !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
 
-	errorLog.Fatal(err)
+	if err := <-shutdownErr; err != nil {
+		logger.Error(err.Error())
+	}
+
+	logger.Info("server stopped")
 }
 
-func OpenDB(dsn *string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", *dsn)
+// dbPool holds the connection pool settings applied by OpenDB.
+type dbPool struct {
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+}
+
+func OpenDB(dsn *string, pool dbPool) (*sql.DB, error) {
+	db, err := openPool(*dsn, pool)
 	if err != nil {
 		return nil, err
 	}
 
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// openPool sets up a connection pool for dsn without connecting yet.
+func openPool(dsn string, pool dbPool) (*sql.DB, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(pool.maxOpenConns)
+	db.SetMaxIdleConns(pool.maxIdleConns)
+	db.SetConnMaxLifetime(pool.connMaxLifetime)
+	db.SetConnMaxIdleTime(pool.connMaxIdleTime)
+
+	return db, nil
+}
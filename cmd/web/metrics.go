@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vandit1604/snipshot/pkg/models/cache"
+)
+
+// metrics holds the Prometheus collectors of the app. Each app gets its own registry, so tests
+// running in parallel don't share counters.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	snippetsCreated prometheus.Counter
+	signups         prometheus.Counter
+	loginFailures   prometheus.Counter
+	renderErrors    prometheus.Counter
+	rateLimited     *prometheus.CounterVec
+	secretsFound    *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snipshot_http_requests_total",
+			Help: "HTTP requests by route pattern, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snipshot_http_request_duration_seconds",
+			Help:    "HTTP request latency by route pattern and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		snippetsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snipshot_snippets_created_total",
+			Help: "Snippets created through the web form or the API.",
+		}),
+		signups: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snipshot_signups_total",
+			Help: "Successful user signups.",
+		}),
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snipshot_login_failures_total",
+			Help: "Logins and API token requests rejected because of invalid credentials.",
+		}),
+		renderErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snipshot_template_render_errors_total",
+			Help: "Pages which failed to render because of a missing or broken template.",
+		}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snipshot_rate_limited_requests_total",
+			Help: "Requests rejected with 429 by the rate limiter, by limited route.",
+		}, []string{"route"}),
+		secretsFound: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snipshot_snippet_secrets_found_total",
+			Help: "New snippets a secret was found in, by the action taken.",
+		}, []string{"action"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.snippetsCreated, m.signups, m.loginFailures, m.renderErrors, m.rateLimited, m.secretsFound,
+	)
+
+	return m
+}
+
+// route instruments the handler registered for pattern, labelling its requests with the pattern
+// rather than the request path so that IDs in URLs don't blow up the number of series.
+func (m *metrics) route(pattern string, h http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": pattern}
+	h = promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), h)
+	return promhttp.InstrumentHandlerDuration(m.requestDuration.MustCurryWith(labels), h)
+}
+
+// registerCache exports the hit, miss and error counters of the snippet cache.
+func (m *metrics) registerCache(c *cache.SnippetModel) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "snipshot_cache_hits_total",
+			Help: "Snippet cache lookups answered from the cache.",
+		}, func() float64 { return float64(c.Stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "snipshot_cache_misses_total",
+			Help: "Snippet cache lookups which went to the database.",
+		}, func() float64 { return float64(c.Stats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "snipshot_cache_errors_total",
+			Help: "Snippet cache backend and encoding errors.",
+		}, func() float64 { return float64(c.Stats().Errors) }),
+	)
+}
+
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"regexp"
+	"time"
 
 	"github.com/justinas/nosurf"
 	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/models/mysql"
 )
 
 type Middleware struct{}
@@ -31,10 +36,47 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// logRequest writes the access log. It wraps the response writer so that, once the rest of the
+// chain has run, it can report the status code, response size and latency.
 func (app *app) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		app.infoLog.Printf("%s - %s %s %s", r.RemoteAddr, r.Proto, r.Method, r.UserAgent())
-		next.ServeHTTP(w, r)
+		if app.accessLog == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rw := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		entry := &accessLogEntry{}
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyAccessLog, entry))
+
+		next.ServeHTTP(rw, r)
+
+		app.accessLog.log(r, rw, entry, start, time.Since(start))
+	})
+}
+
+// requestIDRX limits the request IDs accepted from clients or proxies to something that is safe to log and echo back.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID tags every request with an ID, reusing the X-Request-ID header set by a proxy in
+// front of us when there is one. The ID is echoed in the response and stored in the request
+// context, where the logger picks it up.
+func (app *app) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), contextKeyRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
@@ -44,7 +86,7 @@ func (app *app) recoverPanic(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				w.Header().Set("Connection", "close")
-				app.serverError(w, fmt.Errorf("%s", err))
+				app.serverError(w, r, fmt.Errorf("%s", err))
 			}
 		}()
 
@@ -62,6 +104,57 @@ func (app *app) requireAuthenticatedUser(next http.Handler) http.Handler {
 	})
 }
 
+// requireRole lets through users with the given role or a more privileged one. Everybody else
+// who is logged in gets a 403.
+func (app *app) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.authenticatedUser(r)
+			if user == nil {
+				http.Redirect(w, r, "/user/login", 302)
+				return
+			}
+			if !user.HasRole(role) {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireTeamRole loads the team named by the :slug of the route for the authenticated user and
+// puts it in the request context, see currentTeam. Users who aren't members get a 404, like for
+// a team that doesn't exist, and members without the given role a 403.
+func (app *app) requireTeamRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := app.authenticatedUser(r)
+			if user == nil {
+				http.Redirect(w, r, "/user/login", 302)
+				return
+			}
+
+			team, err := app.teams.Get(r.Context(), r.URL.Query().Get(":slug"), user.ID)
+			if err == models.ErrRecordNotFound {
+				app.notFound(w)
+				return
+			} else if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+
+			if role == models.TeamOwner && !team.IsOwner() {
+				app.clientError(w, http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), contextKeyTeam, team)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func (app *app) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Check if a userID value exists in the session. If this *isn't
@@ -75,13 +168,22 @@ func (app *app) authenticate(next http.Handler) http.Handler {
 		// Fetch the details of the current user from the database. If
 		// no matching record is found, remove the (invalid) userID from
 		// their session and call the next handler in the chain as normal.
-		user, err := app.users.Get(app.session.GetInt(r, "userID"))
+		user, err := app.users.Get(r.Context(), app.session.GetInt(r, "userID"))
 		if err == models.ErrRecordNotFound {
 			app.session.Remove(r, "userID")
 			next.ServeHTTP(w, r)
 			return
 		} else if err != nil {
-			app.serverError(w, err)
+			app.serverError(w, r, err)
+			return
+		}
+
+		// The password was reset after this session logged in, which may have been done because
+		// someone else got hold of it, or an admin deactivated the account. Either way the
+		// session is no longer valid.
+		if user.PasswordChanged.After(app.session.GetTime(r, "authTime")) || !user.Active {
+			app.session.Remove(r, "userID")
+			next.ServeHTTP(w, r)
 			return
 		}
 
@@ -91,11 +193,23 @@ func (app *app) authenticate(next http.Handler) http.Handler {
 		// call the next handler in the chain *using this new copy of the
 		// request*.
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		setAccessLogUser(ctx, user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// readYourWrites sends the reads of a user who has just written something to the primary
+// database, so they don't get served a replica that hasn't caught up with their write yet.
+func (app *app) readYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if time.Now().Before(app.session.GetTime(r, "readPrimaryUntil")) {
+			r = r.WithContext(mysql.ReadFromPrimary(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func noSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
 	csrfHandler.SetBaseCookie(http.Cookie{
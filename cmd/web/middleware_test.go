@@ -1,10 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/ratelimit"
 )
 
 func TestSecureHeaders(t *testing.T) {
@@ -66,3 +74,172 @@ func TestSecureHeaders(t *testing.T) {
 		t.Errorf("want body to equal %q", "OK")
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	logger, err := newLogger(&logs, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &app{logger: logger}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.logger.InfoContext(r.Context(), "handled")
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		wantID   *regexp.Regexp
+	}{
+		{"Propagated", "abc-123", regexp.MustCompile(`^abc-123$`)},
+		{"Generated", "", regexp.MustCompile(`^[0-9a-f]{32}$`)},
+		{"Unsafe header replaced", "bad id\nINFO forged", regexp.MustCompile(`^[0-9a-f]{32}$`)},
+	}
+
+	for _, tt := range tests {
+		logs.Reset()
+
+		rr := httptest.NewRecorder()
+		r, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.incoming != "" {
+			r.Header.Set("X-Request-ID", tt.incoming)
+		}
+
+		app.requestID(next).ServeHTTP(rr, r)
+
+		id := rr.Result().Header.Get("X-Request-ID")
+		if !tt.wantID.MatchString(id) {
+			t.Errorf("%s: want request ID matching %s; got %q", tt.name, tt.wantID, id)
+		}
+
+		var line struct {
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if line.RequestID != id {
+			t.Errorf("%s: want log line with request_id %q; got %q", tt.name, id, line.RequestID)
+		}
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	t.Parallel()
+
+	handler := func(status int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte("hello"))
+		})
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		sample float64
+		status int
+		// target and referer default to /snippet/1?x=y and https://example.com/
+		target   string
+		referer  string
+		wantLine *regexp.Regexp
+	}{
+		{"Common", "common", 1, http.StatusCreated, "", "",
+			regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /snippet/1\?x=y HTTP/1\.1" 201 5\n$`)},
+		{"Combined", "combined", 1, http.StatusOK, "", "",
+			regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /snippet/1\?x=y HTTP/1\.1" 200 5 "https://example\.com/" "test-agent"\n$`)},
+		{"JSON", "json", 1, http.StatusNotFound, "", "",
+			regexp.MustCompile(`^\{.*"method":"GET","uri":"/snippet/1\?x=y","proto":"HTTP/1\.1","status":404,"size":5,"duration_ms":[0-9.]+.*\}\n$`)},
+		{"Sampled out", "common", 0, http.StatusOK, "", "", regexp.MustCompile(`^$`)},
+		{"Token redacted", "combined", 1, http.StatusOK, "/user/password/reset?token=secret", "https://example.com/teams/join?token=secret",
+			regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /user/password/reset\?token=REDACTED HTTP/1\.1" 200 5 "https://example\.com/teams/join\?token=REDACTED" "test-agent"\n$`)},
+		{"Code and state redacted", "common", 1, http.StatusSeeOther, "/user/login/oidc/callback?state=secret&code=secret", "",
+			regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /user/login/oidc/callback\?code=REDACTED&state=REDACTED HTTP/1\.1" 303 5\n$`)},
+		{"Server errors always logged", "common", 0, http.StatusInternalServerError, "", "", regexp.MustCompile(` 500 5\n$`)},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		accessLog, err := newAccessLogger(&out, tt.format, tt.sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		app := &app{accessLog: accessLog}
+
+		target, referer := or(tt.target, "/snippet/1?x=y"), or(tt.referer, "https://example.com/")
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Referer", referer)
+		r.Header.Set("User-Agent", "test-agent")
+
+		app.logRequest(handler(tt.status)).ServeHTTP(httptest.NewRecorder(), r)
+
+		if !tt.wantLine.Match(out.Bytes()) {
+			t.Errorf("%s: want access log matching %s; got %q", tt.name, tt.wantLine, out.String())
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	app.rateLimits = rateLimits{store: ratelimit.NewMemory()}
+	policy := ratelimit.Policy{Rate: 1.0 / 60, Burst: 2}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	handler := app.rateLimit("login", policy)(next)
+
+	send := func(path, remoteAddr string, user *models.User) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.RemoteAddr = remoteAddr
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), contextKeyUser, user))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, r)
+		return rr.Result()
+	}
+
+	for i := 0; i < 2; i++ {
+		if rs := send("/user/login", "192.0.2.1:1234", nil); rs.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: want %d; got %d", i+1, http.StatusOK, rs.StatusCode)
+		}
+	}
+
+	// the port changes between connections, the bucket is per address
+	rs := send("/user/login", "192.0.2.1:5678", nil)
+	if rs.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("want %d; got %d", http.StatusTooManyRequests, rs.StatusCode)
+	}
+	if retry := rs.Header.Get("Retry-After"); retry != "60" {
+		t.Errorf("want Retry-After %q; got %q", "60", retry)
+	}
+
+	if rs := send("/user/login", "192.0.2.2:1234", nil); rs.StatusCode != http.StatusOK {
+		t.Errorf("want other clients allowed; got %d", rs.StatusCode)
+	}
+
+	// logged in users have their own bucket wherever they come from
+	user := &models.User{ID: 1}
+	send("/user/login", "192.0.2.3:1234", user)
+	send("/user/login", "192.0.2.4:1234", user)
+	if rs := send("/user/login", "192.0.2.5:1234", user); rs.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("want user limited across addresses; got %d", rs.StatusCode)
+	}
+
+	rs = send("/api/tokens", "192.0.2.1:1234", nil)
+	if ct := rs.Header.Get("Content-Type"); rs.StatusCode != http.StatusTooManyRequests || ct != "application/json" {
+		t.Errorf("want a JSON 429 from the API; got %d %q", rs.StatusCode, ct)
+	}
+
+	if got := testutil.ToFloat64(app.metrics.rateLimited.WithLabelValues("login")); got != 3 {
+		t.Errorf("want 3 rate limited requests counted; got %v", got)
+	}
+}
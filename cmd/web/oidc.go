@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/models"
+	"golang.org/x/oauth2"
+)
+
+// oidcFlowTTL is how long the user has at the identity provider before coming back.
+const oidcFlowTTL = 10 * time.Minute
+
+// oidcProvider logs users in through an OpenID Connect identity provider, using the
+// authorization code flow with PKCE.
+type oidcProvider struct {
+	// name is shown on the login button, e.g. "Acme SSO".
+	name     string
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	// allowedDomains limits logins to email addresses in these domains. Empty allows any.
+	allowedDomains []string
+	// autoProvision creates accounts for users logging in for the first time. Without it only
+	// users who already have an account with the same email address can log in.
+	autoProvision bool
+}
+
+// newOIDCProvider looks up the endpoints and signing keys of the issuer through its discovery
+// document.
+func newOIDCProvider(ctx context.Context, name, issuer, clientID, clientSecret string, allowedDomains []string, autoProvision bool) (*oidcProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []string{}
+	for _, d := range allowedDomains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, strings.TrimPrefix(d, "@"))
+		}
+	}
+
+	return &oidcProvider{
+		name: name,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier:       provider.Verifier(&oidc.Config{ClientID: clientID}),
+		allowedDomains: domains,
+		autoProvision:  autoProvision,
+	}, nil
+}
+
+func (p *oidcProvider) allowed(email string) bool {
+	if len(p.allowedDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range p.allowedDomains {
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcFlow is what the callback needs to finish a login, kept in a cookie of its own while the
+// user is away at the provider. The session cookie is SameSite=Strict and so isn't sent along
+// when the provider redirects back.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+const oidcCookie = "oidc_flow"
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// oidcLogin sends the user to the identity provider.
+func (app *app) oidcLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	flow := oidcFlow{Verifier: oauth2.GenerateVerifier()}
+	var err error
+	if flow.State, err = randomString(); err == nil {
+		flow.Nonce, err = randomString()
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	js, err := json.Marshal(flow)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(js),
+		Path:     "/user/login/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	config := app.oidc.config
+	config.RedirectURL = app.absoluteURL(r, "/user/login/oidc/callback")
+	http.Redirect(w, r, config.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier)), http.StatusFound)
+}
+
+// oidcCallback is where the identity provider sends the user back to, with a code to exchange
+// for their ID token.
+func (app *app) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.notFound(w)
+		return
+	}
+
+	// the flow can only be finished once
+	http.SetCookie(w, &http.Cookie{Name: oidcCookie, Path: "/user/login/oidc", MaxAge: -1, HttpOnly: true, Secure: true})
+
+	var flow oidcFlow
+	cookie, err := r.Cookie(oidcCookie)
+	if err == nil {
+		var js []byte
+		if js, err = base64.RawURLEncoding.DecodeString(cookie.Value); err == nil {
+			err = json.Unmarshal(js, &flow)
+		}
+	}
+	query := r.URL.Query()
+	if err != nil || flow.State == "" || query.Get("state") != flow.State {
+		app.oidcFailed(w, r, "That took too long, please try again", errors.New("missing or mismatched state"))
+		return
+	}
+	if e := query.Get("error"); e != "" {
+		app.oidcFailed(w, r, "Logging in with "+app.oidc.name+" was cancelled", errors.New(e+": "+query.Get("error_description")))
+		return
+	}
+
+	config := app.oidc.config
+	config.RedirectURL = app.absoluteURL(r, "/user/login/oidc/callback")
+	token, err := config.Exchange(r.Context(), query.Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		app.oidcFailed(w, r, "", err)
+		return
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		app.oidcFailed(w, r, "", errors.New("no id_token in token response"))
+		return
+	}
+	idToken, err := app.oidc.verifier.Verify(r.Context(), rawIDToken)
+	if err != nil {
+		app.oidcFailed(w, r, "", err)
+		return
+	}
+	if idToken.Nonce != flow.Nonce {
+		app.oidcFailed(w, r, "", errors.New("nonce mismatch"))
+		return
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		app.oidcFailed(w, r, "", err)
+		return
+	}
+
+	// accounts are matched by address, which is only safe if the provider checked it belongs to the user
+	if claims.Email == "" || !claims.EmailVerified {
+		app.oidcFailed(w, r, "Your "+app.oidc.name+" account has no verified email address", errors.New("email not verified"))
+		return
+	}
+	if !app.oidc.allowed(claims.Email) {
+		app.oidcFailed(w, r, claims.Email+" isn't allowed to log in here", errors.New("email domain not allowed"))
+		return
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email[:strings.LastIndex(claims.Email, "@")]
+	}
+
+	id, err := app.users.ExternalLogin(r.Context(), idToken.Issuer, idToken.Subject, name, claims.Email, app.oidc.autoProvision)
+	if err == models.ErrRecordNotFound {
+		app.oidcFailed(w, r, "There is no account for "+claims.Email+", please ask for one to be created", nil)
+		return
+	} else if err == models.ErrAccountInactive {
+		app.recordLoginAttempt(r, claims.Email, err)
+		app.oidcFailed(w, r, "Your account has been deactivated", nil)
+		return
+	} else if err == models.ErrUnverifiedAccount {
+		app.oidcFailed(w, r, "There is an unverified account for "+claims.Email+". Reset its password, which proves the address is yours, before logging in with "+app.oidc.name+".", nil)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordLoginAttempt(r, claims.Email, nil)
+
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// a redirect here would still count as coming from the provider, and the browser would hold
+	// back the SameSite=Strict session cookie we just set, so the page moves on by itself instead.
+	// Whatever the provider checked, users who turned on two-factor authentication here still
+	// enter their code, as they would after their password.
+	if user.TOTPEnabled {
+		app.awaitSecondFactor(r, id, false)
+		app.render(w, r, "oidc.page.tmpl", &templateData{Next: "/user/login/2fa"})
+		return
+	}
+
+	app.logIn(r, id, false)
+	app.render(w, r, "oidc.page.tmpl", nil)
+}
+
+// oidcFailed shows the login page with message, or a generic one if it's empty. err is logged,
+// there is not much else to do about a provider misbehaving. Like after a successful login the
+// session cookie didn't come along, so rather than redirecting the page is rendered right here.
+func (app *app) oidcFailed(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "single sign-on failed", "err", err)
+	}
+	app.metrics.loginFailures.Inc()
+
+	if message == "" {
+		message = "Logging in with " + app.oidc.name + " failed, please try again"
+	}
+	app.session.Put(r, "flash", message)
+	app.render(w, r, "login.page.tmpl", &templateData{Form: forms.New(nil)})
+}
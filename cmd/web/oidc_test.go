@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "snipshot"
+
+// mockOIDCProvider is a minimal OpenID Connect provider: it serves the discovery document and
+// signing keys, hands out codes without asking anyone to log in, and exchanges them for an ID
+// token carrying claims, checking the PKCE verifier.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	// claims go into the ID tokens on top of the standard ones
+	claims map[string]interface{}
+	// nonce replaces the nonce the client asked for when set
+	nonce string
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newMockOIDCProvider(t *testing.T, claims map[string]interface{}) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockOIDCProvider{key: key, claims: claims, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *mockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *mockOIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   b64(p.key.N.Bytes()),
+			"e":   b64(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize logs the user straight in and sends them back with a code.
+func (p *mockOIDCProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code, _ := randomString()
+
+	p.mu.Lock()
+	p.codes[code] = query
+	p.mu.Unlock()
+
+	redirect := query.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (p *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	p.mu.Lock()
+	authorization, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || authorization.Get("code_challenge_method") != "S256" || b64(challenge[:]) != authorization.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	nonce := authorization.Get("nonce")
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     p.sign(claims),
+	})
+}
+
+func (p *mockOIDCProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		claims        map[string]interface{}
+		nonce         string
+		autoProvision bool
+		// tamper changes the callback URL before the browser follows it
+		tamper      func(callback *url.URL)
+		wantBody    []byte
+		wantLoginAs string
+		// wantSecondFactor is set when the login waits for the user's two-factor code
+		wantSecondFactor bool
+	}{
+		{
+			name:        "Existing user",
+			claims:      map[string]interface{}{"email": "alice@example.com", "email_verified": true},
+			wantBody:    []byte("You have been logged in successfully"),
+			wantLoginAs: "mail@mail.mail",
+		},
+		{
+			name:          "New user",
+			claims:        map[string]interface{}{"email": "olivia@example.com", "email_verified": true, "name": "Olivia"},
+			autoProvision: true,
+			wantBody:      []byte("You have been logged in successfully"),
+			wantLoginAs:   "olivia@example.com",
+		},
+		{
+			name:     "New user without provisioning",
+			claims:   map[string]interface{}{"email": "olivia@example.com", "email_verified": true},
+			wantBody: []byte("There is no account for olivia@example.com"),
+		},
+		{
+			name:     "Unverified local account",
+			claims:   map[string]interface{}{"email": "carol@example.com", "email_verified": true},
+			wantBody: []byte("There is an unverified account for carol@example.com. Reset its password, which proves the address is yours"),
+		},
+		{
+			name:             "Two-factor user",
+			claims:           map[string]interface{}{"email": "erin@example.com", "email_verified": true},
+			wantBody:         []byte("url=/user/login/2fa"),
+			wantSecondFactor: true,
+		},
+		{
+			name:     "Unverified email",
+			claims:   map[string]interface{}{"email": "alice@example.com", "email_verified": false},
+			wantBody: []byte("no verified email address"),
+		},
+		{
+			name:     "Domain not allowed",
+			claims:   map[string]interface{}{"email": "mallory@example.org", "email_verified": true},
+			wantBody: []byte("mallory@example.org isn&#39;t allowed to log in here"),
+		},
+		{
+			name:     "Replayed nonce",
+			claims:   map[string]interface{}{"email": "alice@example.com", "email_verified": true},
+			nonce:    "someone-elses-nonce",
+			wantBody: []byte("Logging in with Acme SSO failed"),
+		},
+		{
+			name:   "Forged state",
+			claims: map[string]interface{}{"email": "alice@example.com", "email_verified": true},
+			tamper: func(callback *url.URL) {
+				q := callback.Query()
+				q.Set("state", "forged")
+				callback.RawQuery = q.Encode()
+			},
+			wantBody: []byte("That took too long"),
+		},
+		{
+			name:   "Cancelled at the provider",
+			claims: map[string]interface{}{"email": "alice@example.com", "email_verified": true},
+			tamper: func(callback *url.URL) {
+				q := callback.Query()
+				q.Del("code")
+				q.Set("error", "access_denied")
+				callback.RawQuery = q.Encode()
+			},
+			wantBody: []byte("Logging in with Acme SSO was cancelled"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockOIDCProvider(t, tt.claims)
+			provider.nonce = tt.nonce
+
+			app := newTestApplication(t)
+			var err error
+			app.oidc, err = newOIDCProvider(context.Background(), "Acme SSO", provider.URL, testClientID, "secret", []string{"example.com"}, tt.autoProvision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+			if !bytes.Contains(body, []byte("Log in with Acme SSO")) {
+				t.Errorf("want a single sign-on link on the login page, but got %q", body)
+			}
+
+			code, header, _ := ts.get(t, "/user/login/oidc")
+			if code != http.StatusFound || !strings.HasPrefix(header.Get("Location"), provider.URL+"/authorize") {
+				t.Fatalf("want a redirect to the provider; got %d to %q", code, header.Get("Location"))
+			}
+
+			// the provider sends the browser back to the callback straight away
+			resp, err := ts.Client().Get(header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			callback, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(callback)
+			}
+
+			code, _, body = ts.get(t, callback.RequestURI())
+			if code != http.StatusOK {
+				t.Errorf("want %d; got %d", http.StatusOK, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+
+			code, _, _ = ts.get(t, "/user/login/2fa")
+			if pending := code == http.StatusOK; pending != tt.wantSecondFactor {
+				t.Errorf("want a login waiting for the two-factor code to be %v; got %d for the code form", tt.wantSecondFactor, code)
+			}
+
+			code, _, body = ts.get(t, "/user/profile")
+			if tt.wantLoginAs == "" {
+				if code != http.StatusFound {
+					t.Errorf("want %d for the profile when not logged in; got %d", http.StatusFound, code)
+				}
+				return
+			}
+			if code != http.StatusOK || !bytes.Contains(body, []byte(tt.wantLoginAs)) {
+				t.Errorf("want to be logged in as %s; got %d", tt.wantLoginAs, code)
+			}
+
+			// the code and state are used up
+			if _, _, body := ts.get(t, callback.RequestURI()); !bytes.Contains(body, []byte("That took too long")) {
+				t.Errorf("want the callback to fail when replayed, but got %q", body)
+			}
+		})
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	if code, _, _ := ts.get(t, "/user/login/oidc"); code != http.StatusNotFound {
+		t.Errorf("want %d; got %d", http.StatusNotFound, code)
+	}
+	if _, _, body := ts.get(t, "/user/login"); bytes.Contains(body, []byte("/user/login/oidc")) {
+		t.Error("want no single sign-on link on the login page")
+	}
+}
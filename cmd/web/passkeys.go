@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// passkeyCeremonyTimeout is how long the browser, and the user, get to answer a registration or
+// login challenge.
+const passkeyCeremonyTimeout = 5 * time.Minute
+
+// newWebAuthn configures the passkey ceremonies for the site at origin, e.g.
+// https://snippets.example.com. Passkeys are bound to the host name, so changing it later makes
+// the existing ones unusable.
+func newWebAuthn(origin string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyTimeout, TimeoutUVD: passkeyCeremonyTimeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "Snippetbox",
+		RPOrigins:     []string{strings.TrimRight(origin, "/")},
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// webAuthnUser adapts a user and their passkeys to webauthn.User.
+type webAuthnUser struct {
+	*models.User
+	passkeys []*models.Passkey
+}
+
+// WebAuthnID is the user handle stored with the passkey on the authenticator, which hands it
+// back on login. The user ID is enough, the handle isn't secret and never shown.
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(u.ID))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.Name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, p := range u.passkeys {
+		transports := make([]protocol.AuthenticatorTransport, len(p.Transports))
+		for j, t := range p.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+
+		credentials[i] = webauthn.Credential{
+			ID:              p.ID,
+			PublicKey:       p.PublicKey,
+			AttestationType: p.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: p.BackupEligible, BackupState: p.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: p.AAGUID, SignCount: p.SignCount},
+		}
+	}
+	return credentials
+}
+
+// webAuthnUser loads the user with the given ID along with their passkeys.
+func (app *app) webAuthnUser(r *http.Request, id int) (*webAuthnUser, error) {
+	user, err := app.users.Get(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := app.passkeys.ForUser(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webAuthnUser{User: user, passkeys: passkeys}, nil
+}
+
+// The challenge of a ceremony is kept in the session between its begin and finish requests,
+// JSON encoded so the session doesn't have to know the type.
+func (app *app) putCeremony(r *http.Request, key string, data *webauthn.SessionData) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	app.session.Put(r, key, string(js))
+	return nil
+}
+
+// popCeremony returns the ceremony saved under key, which can only be finished once.
+func (app *app) popCeremony(r *http.Request, key string) (webauthn.SessionData, bool) {
+	var data webauthn.SessionData
+	js := app.session.PopString(r, key)
+	if js == "" || json.Unmarshal([]byte(js), &data) != nil {
+		return data, false
+	}
+	return data, true
+}
+
+// listPasskeys shows the passkeys of the user, where they can add and remove them.
+func (app *app) listPasskeys(w http.ResponseWriter, r *http.Request) {
+	passkeys, err := app.passkeys.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "passkeys.page.tmpl", &templateData{Passkeys: passkeys})
+}
+
+// beginPasskeyRegistration answers with the options for navigator.credentials.create. Passkeys
+// are created as discoverable credentials, so logging in with them doesn't need the email first.
+func (app *app) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, err := app.webAuthnUser(r, app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	exclude := make([]protocol.CredentialDescriptor, len(user.passkeys))
+	for i, c := range user.WebAuthnCredentials() {
+		exclude[i] = c.Descriptor()
+	}
+
+	creation, data, err := app.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.putCeremony(r, "passkeyRegistration", data); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, envelope{"publicKey": creation.Response})
+}
+
+// finishPasskeyRegistration checks the new credential against the challenge and stores it.
+func (app *app) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name       string          `json:"name"`
+		Credential json.RawMessage `json:"credential"`
+	}
+	if err := app.readJSON(w, r, &input); err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if utf8.RuneCountInString(name) > 100 {
+		app.apiError(w, r, http.StatusUnprocessableEntity, envelope{"name": "This field is too long (maximum is 100 characters)"})
+		return
+	}
+
+	data, ok := app.popCeremony(r, "passkeyRegistration")
+	if !ok {
+		app.apiError(w, r, http.StatusBadRequest, "no passkey registration in progress")
+		return
+	}
+
+	user, err := app.webAuthnUser(r, app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(input.Credential))
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, "passkey response is malformed")
+		return
+	}
+
+	credential, err := app.webauthn.CreateCredential(user, data, parsed)
+	if err != nil {
+		app.logger.InfoContext(r.Context(), "passkey registration rejected", "err", protocolErrorDetails(err))
+		app.apiError(w, r, http.StatusBadRequest, "passkey was not accepted")
+		return
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	err = app.passkeys.Insert(r.Context(), &models.Passkey{
+		ID:              credential.ID,
+		UserID:          user.ID,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Your passkey has been added")
+	app.writeJSON(w, r, http.StatusCreated, envelope{"redirect": "/user/passkeys"})
+}
+
+// deletePasskey removes one of the user's passkeys, identified by its base64url encoded ID.
+func (app *app) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(r.PostForm.Get("id"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = app.passkeys.Delete(r.Context(), app.authenticatedUser(r).ID, id)
+	if err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Your passkey has been removed")
+	http.Redirect(w, r, "/user/passkeys", http.StatusSeeOther)
+}
+
+// beginPasskeyLogin answers with the options for navigator.credentials.get. No user is named,
+// the browser offers whichever passkeys it has for the site. User verification (a PIN or
+// biometric on the authenticator) is required, which makes a passkey both factors at once.
+func (app *app) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	assertion, data, err := app.webauthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.putCeremony(r, "passkeyLogin", data); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, http.StatusOK, envelope{"publicKey": assertion.Response})
+}
+
+// finishPasskeyLogin checks the signed challenge and logs in the user owning the passkey.
+func (app *app) finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	data, ok := app.popCeremony(r, "passkeyLogin")
+	if !ok {
+		app.apiError(w, r, http.StatusBadRequest, "no passkey login in progress")
+		return
+	}
+	// unlike the other ceremonies the library leaves checking the deadline of discoverable logins to us
+	if !data.Expires.IsZero() && time.Now().After(data.Expires) {
+		app.apiError(w, r, http.StatusBadRequest, "passkey login timed out, please try again")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	parsed, err := protocol.ParseCredentialRequestResponseBody(r.Body)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, "passkey response is malformed")
+		return
+	}
+
+	var user *webAuthnUser
+	credential, err := app.webauthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		id, err := strconv.Atoi(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		user, err = app.webAuthnUser(r, id)
+		return user, err
+	}, data, parsed)
+	// a signature counter going backwards means the passkey has been cloned, the copy can't be trusted
+	if err == nil && credential.Authenticator.CloneWarning {
+		err = errors.New("signature counter went backwards")
+	}
+	if err != nil {
+		app.metrics.loginFailures.Inc()
+		if user != nil {
+			app.recordLoginAttempt(r, user.Email, models.ErrInvalidCredenetials)
+		}
+		app.logger.InfoContext(r.Context(), "passkey login rejected", "err", protocolErrorDetails(err))
+		app.apiError(w, r, http.StatusUnauthorized, "passkey was not accepted")
+		return
+	}
+
+	// only someone holding the passkey gets told the account was deactivated
+	if !user.Active {
+		app.recordLoginAttempt(r, user.Email, models.ErrAccountInactive)
+		app.apiError(w, r, http.StatusForbidden, "this account has been deactivated")
+		return
+	}
+
+	err = app.passkeys.Use(r.Context(), credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.recordLoginAttempt(r, user.Email, nil)
+
+	app.logIn(r, user.ID, false)
+	app.writeJSON(w, r, http.StatusOK, envelope{"redirect": "/"})
+}
+
+// protocolErrorDetails includes the debug information the webauthn errors keep apart from their
+// message, which tells why a response was rejected.
+func protocolErrorDetails(err error) string {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.DevInfo != "" {
+		return perr.Error() + ": " + perr.DevInfo
+	}
+	return err.Error()
+}
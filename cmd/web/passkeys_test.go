@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+// testOrigin is the origin the test application accepts passkeys from, see newTestApplication.
+const testOrigin = "https://localhost:4000"
+
+// softAuthenticator stands in for the browser and a security key: it creates a P-256 credential
+// and signs login challenges with it, the way navigator.credentials would.
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{origin: testOrigin, key: key, credentialID: id}
+}
+
+// ceremonyOptions is the part of the options sent for both ceremonies the authenticator needs.
+type ceremonyOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RPID      string `json:"rpId"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		AuthenticatorSelection struct {
+			ResidentKey string `json:"residentKey"`
+		} `json:"authenticatorSelection"`
+		UserVerification string `json:"userVerification"`
+	} `json:"publicKey"`
+}
+
+func parseCeremonyOptions(t *testing.T, body []byte) *ceremonyOptions {
+	var options ceremonyOptions
+	if err := json.Unmarshal(body, &options); err != nil {
+		t.Fatalf("decoding options %q: %v", body, err)
+	}
+	return &options
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, typ, challenge string) []byte {
+	js, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": a.origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+// authData builds the authenticator data: the RP ID hash, the flags (user present and verified)
+// and the signature counter, followed by attested credential data when registering.
+func (a *softAuthenticator) authData(rpID string, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	flags := byte(flagUserPresent | flagUserVerified)
+	if attested != nil {
+		flags |= flagAttestedCredentialData
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+// The authenticator data flags, as defined by the WebAuthn spec.
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagAttestedCredentialData = 0x40
+)
+
+// create answers the registration options with a new credential, using the "none" attestation format.
+func (a *softAuthenticator) create(t *testing.T, options *ceremonyOptions) map[string]interface{} {
+	a.userHandle, _ = base64.RawURLEncoding.DecodeString(options.PublicKey.User.ID)
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a zero AAGUID, then the credential ID and its public key
+	attested := make([]byte, 16)
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialID)))
+	attested = append(attested, a.credentialID...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(options.PublicKey.RP.ID, attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(a.clientData(t, "webauthn.create", options.PublicKey.Challenge)),
+			"attestationObject": b64(attestationObject),
+			"transports":        []string{"usb"},
+		},
+	}
+}
+
+// get answers the login options by signing the challenge with the credential.
+func (a *softAuthenticator) get(t *testing.T, options *ceremonyOptions) map[string]interface{} {
+	a.signCount++
+
+	authData := a.authData(options.PublicKey.RPID, nil)
+	clientData := a.clientData(t, "webauthn.get", options.PublicKey.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(a.userHandle),
+		},
+	}
+}
+
+// postJSON posts body as JSON, passing the CSRF token in the header the way passkeys.js does.
+func (ts *testServer) postJSON(t *testing.T, urlPath, csrfToken string, body interface{}) (int, []byte) {
+	var rd io.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rd = bytes.NewReader(js)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CSRF-Token", csrfToken)
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Body.Close()
+
+	respBody, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rs.StatusCode, respBody
+}
+
+// registerPasskey logs in as alice@example.com on a fresh client of the app and adds a passkey
+// from authenticator.
+func registerPasskey(t *testing.T, app *app, authenticator *softAuthenticator) {
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	code, body := ts.postJSON(t, "/user/passkeys/begin", csrfToken, nil)
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d: %s", http.StatusOK, code, body)
+	}
+	options := parseCeremonyOptions(t, body)
+	if options.PublicKey.AuthenticatorSelection.ResidentKey != "required" {
+		t.Errorf("want a discoverable credential required; got %q", options.PublicKey.AuthenticatorSelection.ResidentKey)
+	}
+
+	credential := authenticator.create(t, options)
+	code, body = ts.postJSON(t, "/user/passkeys/finish", csrfToken, map[string]interface{}{"name": "Security key", "credential": credential})
+	if code != http.StatusCreated {
+		t.Fatalf("want %d; got %d: %s", http.StatusCreated, code, body)
+	}
+
+	_, _, body = ts.get(t, "/user/passkeys")
+	if !bytes.Contains(body, []byte("Security key")) {
+		t.Errorf("want the passkey listed, but got %q", body)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// setup changes the authenticator before the passkey is registered, before changes it
+		// before it answers the login challenge, and after changes its answer before it is sent
+		setup    func(a *softAuthenticator)
+		before   func(a *softAuthenticator)
+		after    func(credential map[string]interface{})
+		wantCode int
+	}{
+		{name: "Valid", wantCode: http.StatusOK},
+		{name: "Bad signature", after: func(credential map[string]interface{}) {
+			credential["response"].(map[string]interface{})["signature"] = b64([]byte("not a signature"))
+		}, wantCode: http.StatusUnauthorized},
+		{name: "Wrong origin", before: func(a *softAuthenticator) {
+			a.origin = "https://snippets.example.com"
+		}, wantCode: http.StatusUnauthorized},
+		{name: "Someone else's user handle", before: func(a *softAuthenticator) {
+			a.userHandle = []byte("2")
+		}, wantCode: http.StatusUnauthorized},
+		// the counter was at 5 when the passkey was registered and is at 1 now, so there are two copies of the key
+		{name: "Cloned authenticator", setup: func(a *softAuthenticator) {
+			a.signCount = 5
+		}, before: func(a *softAuthenticator) {
+			a.signCount = 0
+		}, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			authenticator := newSoftAuthenticator(t)
+			if tt.setup != nil {
+				tt.setup(authenticator)
+			}
+			registerPasskey(t, app, authenticator)
+
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+			csrfToken := extractCSRFToken(t, body)
+
+			code, body := ts.postJSON(t, "/user/login/passkey/begin", csrfToken, nil)
+			if code != http.StatusOK {
+				t.Fatalf("want %d; got %d: %s", http.StatusOK, code, body)
+			}
+			options := parseCeremonyOptions(t, body)
+			if options.PublicKey.UserVerification != "required" {
+				t.Errorf("want user verification required; got %q", options.PublicKey.UserVerification)
+			}
+
+			if tt.before != nil {
+				tt.before(authenticator)
+			}
+			credential := authenticator.get(t, options)
+			if tt.after != nil {
+				tt.after(credential)
+			}
+
+			code, body = ts.postJSON(t, "/user/login/passkey/finish", csrfToken, credential)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d: %s", tt.wantCode, code, body)
+			}
+
+			wantProfile := http.StatusFound
+			if tt.wantCode == http.StatusOK {
+				wantProfile = http.StatusOK
+			}
+			if code, _, _ := ts.get(t, "/user/profile"); code != wantProfile {
+				t.Errorf("want %d for the profile afterwards; got %d", wantProfile, code)
+			}
+
+			// the challenge can't be answered twice
+			code, _ = ts.postJSON(t, "/user/login/passkey/finish", csrfToken, credential)
+			if code != http.StatusBadRequest {
+				t.Errorf("want %d replaying the response; got %d", http.StatusBadRequest, code)
+			}
+		})
+	}
+}
+
+func TestPasskeyRegistrationChallenge(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	_, body := ts.postJSON(t, "/user/passkeys/begin", csrfToken, nil)
+	options := parseCeremonyOptions(t, body)
+	options.PublicKey.Challenge = b64([]byte("a challenge the server never sent"))
+
+	code, body := ts.postJSON(t, "/user/passkeys/finish", csrfToken, map[string]interface{}{"credential": authenticator.create(t, options)})
+	if code != http.StatusBadRequest {
+		t.Errorf("want %d; got %d: %s", http.StatusBadRequest, code, body)
+	}
+
+	passkeys, err := app.passkeys.ForUser(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 0 {
+		t.Errorf("want no passkey stored; got %d", len(passkeys))
+	}
+}
+
+func TestPasskeyRegistrationUnverified(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	// an unverified account may belong to someone squatting the address, a passkey would let
+	// them back in after the owner takes it over with a password reset
+	csrfToken := ts.login(t, "carol@example.com")
+
+	for _, path := range []string{"/user/passkeys/begin", "/user/passkeys/finish"} {
+		if code, body := ts.postJSON(t, path, csrfToken, nil); code != http.StatusSeeOther {
+			t.Errorf("%s: want %d; got %d: %s", path, http.StatusSeeOther, code, body)
+		}
+	}
+}
+
+func TestDeletePasskey(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, app, authenticator)
+
+	tests := []struct {
+		name     string
+		email    string
+		id       string
+		wantCode int
+	}{
+		{"Someone else's passkey", "carol@example.com", b64(authenticator.credentialID), http.StatusNotFound},
+		{"Malformed ID", "alice@example.com", "not base64!", http.StatusBadRequest},
+		{"Own passkey", "alice@example.com", b64(authenticator.credentialID), http.StatusSeeOther},
+		{"Already removed", "alice@example.com", b64(authenticator.credentialID), http.StatusNotFound},
+	}
+
+	// the cases depend on each other, so they don't run in parallel
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+
+			csrfToken := ts.login(t, tt.email)
+			form := url.Values{"id": {tt.id}, "csrf_token": {csrfToken}}
+			if code, _, _ := ts.postForm(t, "/user/passkeys/delete", form); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+
+	if passkeys, _ := app.passkeys.ForUser(context.Background(), 1); len(passkeys) != 0 {
+		t.Errorf("want the passkey removed; got %d left", len(passkeys))
+	}
+}
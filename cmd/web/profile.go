@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/mailer"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// profile shows the account details of the user, with forms to change them and the password.
+func (app *app) profile(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	app.render(w, r, "profile.page.tmpl", &templateData{
+		Form:         forms.New(url.Values{"name": {user.Name}, "email": {user.Email}}),
+		PasswordForm: forms.New(nil),
+	})
+}
+
+// updateProfile changes the name and email address. A new address needs the current password,
+// like changePassword: whoever controls the address can reset the password, so a session left
+// logged in mustn't be enough to move it.
+func (app *app) updateProfile(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	form := forms.New(r.PostForm)
+	form.Required("name", "email")
+	form.MaxLength("name", 255)
+	form.MaxLength("email", 255)
+	form.MatchesPattern("email", forms.EmailRX)
+	emailChanged := !strings.EqualFold(form.Get("email"), user.Email)
+	if emailChanged {
+		form.Required("currentPassword")
+	}
+
+	if !form.Valid() {
+		app.render(w, r, "profile.page.tmpl", &templateData{Form: form, PasswordForm: forms.New(nil)})
+		return
+	}
+
+	if emailChanged {
+		id, err := app.authenticator.Authenticate(r.Context(), user.Email, form.Get("currentPassword"))
+		if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked || (err == nil && id != user.ID) {
+			form.Errors.Add("currentPassword", "Current password is incorrect")
+			app.render(w, r, "profile.page.tmpl", &templateData{Form: form, PasswordForm: forms.New(nil)})
+			return
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = app.users.UpdateProfile(r.Context(), user.ID, form.Get("name"), form.Get("email"))
+	if err == models.ErrDuplicateEmail {
+		form.Errors.Add("email", "Address is already in use")
+		app.render(w, r, "profile.page.tmpl", &templateData{Form: form, PasswordForm: forms.New(nil)})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	flash := "Your profile has been updated"
+	if emailChanged {
+		if err := app.sendVerificationEmail(r, form.Get("email")); err != nil {
+			app.logger.ErrorContext(r.Context(), "sending verification email failed", "err", err)
+		}
+		// the old address hears about it too, in case it wasn't the user who changed it
+		err := app.mailer.Send(r.Context(), mailer.Message{
+			To:      user.Email,
+			Subject: "Your email address was changed",
+			Body: fmt.Sprintf("Hi %s,\n\nthe email address of your Snippetbox account was changed to %s. "+
+				"If you didn't do this, please contact us right away.\n", user.Name, form.Get("email")),
+		})
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "sending email change notice failed", "err", err)
+		}
+		flash = "Your profile has been updated. Check your email for a link to verify your new address."
+	}
+
+	app.session.Put(r, "flash", flash)
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
+
+// changePassword needs the current password as well, so that someone who finds a session left
+// logged in can't lock the user out of their account.
+func (app *app) changePassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	detailsForm := forms.New(url.Values{"name": {user.Name}, "email": {user.Email}})
+
+	form := forms.New(r.PostForm)
+	form.Required("currentPassword", "newPassword")
+	form.MinLength("newPassword", 10)
+
+	if !form.Valid() {
+		app.render(w, r, "profile.page.tmpl", &templateData{Form: detailsForm, PasswordForm: form})
+		return
+	}
+
+	err = app.users.ChangePassword(r.Context(), user.ID, form.Get("currentPassword"), form.Get("newPassword"))
+	if err == models.ErrInvalidCredenetials {
+		form.Errors.Add("currentPassword", "Current password is incorrect")
+		app.render(w, r, "profile.page.tmpl", &templateData{Form: detailsForm, PasswordForm: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// the change logs out every session from before it, except this one
+	app.session.Put(r, "authTime", time.Now())
+	app.session.RenewToken(r)
+	app.session.Put(r, "flash", "Your password has been changed")
+	http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/mailer"
+)
+
+func TestProfile(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	mailDir := t.TempDir()
+	app.mailer = &mailer.File{Dir: mailDir}
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	code, header, _ := ts.get(t, "/user/profile")
+	if code != http.StatusFound || header.Get("Location") != "/user/login" {
+		t.Errorf("want redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	code, _, body := ts.get(t, "/user/profile")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if !bytes.Contains(body, []byte("value='mail@mail.mail'")) {
+		t.Errorf("want the form filled with the current details, but got %q", body)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		form     url.Values
+		wantCode int
+		wantBody []byte
+	}{
+		{"Empty name", "/user/profile", url.Values{"name": {""}, "email": {"alice@example.com"}},
+			http.StatusOK, []byte("This field cannot be blank")},
+		{"Invalid email", "/user/profile", url.Values{"name": {"Alice"}, "email": {"alice@"}},
+			http.StatusOK, []byte("This field is invalid")},
+		{"Duplicate email", "/user/profile", url.Values{"name": {"Alice"}, "email": {"dupe@example.com"}, "currentPassword": {"validPa$$word"}},
+			http.StatusOK, []byte("Address is already in use")},
+		{"Email change without password", "/user/profile", url.Values{"name": {"Alice"}, "email": {"alice@example.com"}},
+			http.StatusOK, []byte("This field cannot be blank")},
+		{"Email change, wrong password", "/user/profile", url.Values{"name": {"Alice"}, "email": {"alice@example.com"}, "currentPassword": {"wrong"}},
+			http.StatusOK, []byte("Current password is incorrect")},
+		{"Valid details", "/user/profile", url.Values{"name": {"Alice"}, "email": {"mail@mail.mail"}},
+			http.StatusSeeOther, nil},
+		{"Valid email change", "/user/profile", url.Values{"name": {"Alice"}, "email": {"alice@example.com"}, "currentPassword": {"validPa$$word"}},
+			http.StatusSeeOther, nil},
+		{"Wrong current password", "/user/profile/password", url.Values{"currentPassword": {"wrong"}, "newPassword": {"newPa$$word1"}},
+			http.StatusOK, []byte("Current password is incorrect")},
+		{"Short new password", "/user/profile/password", url.Values{"currentPassword": {"validPa$$word"}, "newPassword": {"short"}},
+			http.StatusOK, []byte("This field is too short")},
+		{"Valid password change", "/user/profile/password", url.Values{"currentPassword": {"validPa$$word"}, "newPassword": {"newPa$$word1"}},
+			http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfToken)
+			code, _, body := ts.postForm(t, tt.path, tt.form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	// the email change verifies the new address and tells the old one
+	files, _ := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	var toOld, toNew bool
+	for _, file := range files {
+		mail, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toOld = toOld || bytes.Contains(mail, []byte("To: mail@mail.mail")) && bytes.Contains(mail, []byte("was changed to alice@example.com"))
+		toNew = toNew || bytes.Contains(mail, []byte("To: alice@example.com"))
+	}
+	if len(files) != 2 || !toOld || !toNew {
+		t.Errorf("want a notice to the old address and a verification email to the new one; got %d emails", len(files))
+	}
+}
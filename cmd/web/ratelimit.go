@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/vandit1604/snipshot/pkg/ratelimit"
+)
+
+// rateLimits are the policies for the routes which are expensive or worth brute-forcing. A
+// disabled (zero) policy lets everything through, as does a nil store. The API shares the
+// buckets of the matching pages, so it can't be used to get around them.
+type rateLimits struct {
+	store         ratelimit.Store
+	login         ratelimit.Policy
+	signup        ratelimit.Policy
+	createSnippet ratelimit.Policy
+	report        ratelimit.Policy
+}
+
+// rateLimit limits the requests to a route, taking a token from the client's bucket for the
+// route before passing the request on. Requests from logged in users are counted against their
+// user ID, so that one account can't get around the limit by switching addresses, everyone else
+// is counted by IP address. It has to come after authenticate in the chain.
+//
+// When the store can't be reached the request is let through, we'd rather not take the site
+// down along with Redis.
+func (app *app) rateLimit(route string, policy ratelimit.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if app.rateLimits.store == nil || !policy.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := route + ":ip:" + clientIP(r)
+			if user := app.authenticatedUser(r); user != nil {
+				key = route + ":user:" + strconv.Itoa(user.ID)
+			}
+
+			ok, retryAfter, err := app.rateLimits.store.Take(r.Context(), key, policy)
+			if err != nil {
+				app.logger.WarnContext(r.Context(), "rate limit store failed", "route", route, "err", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !ok {
+				app.metrics.rateLimited.WithLabelValues(route).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				if isAPIRequest(r) {
+					app.apiError(w, r, http.StatusTooManyRequests, "too many requests, try again later")
+					return
+				}
+				app.clientError(w, http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the address the request came from. We don't look at X-Forwarded-For, which anyone
+// can set, so behind a proxy every client shares the proxy's bucket.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// reportSnippet puts a snippet in front of the moderators. Visitors can report snippets as well,
+// they're rate limited by address like everyone else.
+func (app *app) reportSnippet(w http.ResponseWriter, r *http.Request) {
+	snippet, ok := app.snippetFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("reason")
+	form.PermittedValues("reason", models.ReportReasons...)
+	form.MaxLength("details", 1000)
+	if !form.Valid() {
+		app.renderSnippet(w, r, snippet, form)
+		return
+	}
+
+	var userID int
+	if user := app.authenticatedUser(r); user != nil {
+		userID = user.ID
+	}
+
+	if _, err := app.reports.Insert(r.Context(), snippet.ID, userID, form.Get("reason"), form.Get("details")); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.InfoContext(r.Context(), "snippet reported", "snippet", snippet.ID, "reason", form.Get("reason"))
+	app.session.Put(r, "flash", "Thanks for the report, a moderator will take a look")
+	http.Redirect(w, r, fmt.Sprintf("/snippet/%d", snippet.ID), http.StatusSeeOther)
+}
+
+// listReports is the moderation queue, the reported snippets with what they were reported for.
+func (app *app) listReports(w http.ResponseWriter, r *http.Request) {
+	queue, err := app.reports.Queue(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "adminreports.page.tmpl", &templateData{Reports: queue})
+}
+
+// hideSnippet hides a snippet from everyone but the moderators, or shows it again. Hiding a
+// snippet deals with its reports.
+func (app *app) hideSnippet(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.snippetTarget(w, r)
+	if !ok {
+		return
+	}
+
+	hidden := r.PostForm.Get("hidden") == "true"
+	if err := app.snippets.SetHidden(r.Context(), id, hidden); err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if hidden {
+		if err := app.reports.Resolve(r.Context(), id); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		app.session.Put(r, "flash", "The snippet has been hidden")
+	} else {
+		app.session.Put(r, "flash", "The snippet is shown again")
+	}
+
+	app.logger.InfoContext(r.Context(), "snippet hidden changed", "snippet", id, "hidden", hidden, "by", app.authenticatedUser(r).ID)
+	http.Redirect(w, r, moderationReturn(r), http.StatusSeeOther)
+}
+
+// dismissReports takes a snippet out of the queue without doing anything to it.
+func (app *app) dismissReports(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.snippetTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.reports.Resolve(r.Context(), id); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.logger.InfoContext(r.Context(), "snippet reports dismissed", "snippet", id, "by", app.authenticatedUser(r).ID)
+	app.session.Put(r, "flash", "The reports have been dismissed")
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// moderationReturn is where a moderation action sends the moderator back to, the queue if that's
+// where they came from and the list of all snippets otherwise.
+func moderationReturn(r *http.Request) string {
+	if r.PostForm.Get("back") == "/admin/reports" {
+		return "/admin/reports"
+	}
+	return "/admin/snippets"
+}
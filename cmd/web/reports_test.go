@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestReportSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	// visitors can report snippets too
+	_, _, body := ts.get(t, "/snippet/1")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		reason       string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid", "/snippet/1/report", "spam", http.StatusSeeOther, "/snippet/1", nil},
+		{"No reason", "/snippet/1/report", "", http.StatusOK, "", []byte("This field cannot be blank")},
+		{"Unknown reason", "/snippet/1/report", "boring", http.StatusOK, "", []byte("This field is invalid")},
+		{"Unknown snippet", "/snippet/99/report", "spam", http.StatusNotFound, "", nil},
+		{"Hidden snippet", "/snippet/4/report", "spam", http.StatusNotFound, "", nil},
+		{"Team snippet", "/snippet/3/report", "spam", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"reason": {tt.reason}, "details": {"Selling pills"}, "csrf_token": {csrfToken}}
+			code, header, body := ts.postForm(t, tt.urlPath, form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestHiddenSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	for _, urlPath := range []string{"/snippet/4", "/snippet/4/raw"} {
+		if code, _, _ := ts.get(t, urlPath); code != http.StatusNotFound {
+			t.Errorf("%s: want %d; got %d", urlPath, http.StatusNotFound, code)
+		}
+	}
+}
+
+func TestListReports(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantCode int
+		wantBody []byte
+	}{
+		{"User", "alice@example.com", http.StatusForbidden, nil},
+		{"Moderator", "mia@example.com", http.StatusOK, []byte("Selling pills in the comments")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			ts.login(t, tt.email)
+
+			code, _, body := ts.get(t, "/admin/reports")
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestModerateSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "mia@example.com")
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		form         url.Values
+		wantCode     int
+		wantLocation string
+	}{
+		{"Hide from the queue", "/admin/snippets/hide", url.Values{"id": {"1"}, "hidden": {"true"}, "back": {"/admin/reports"}}, http.StatusSeeOther, "/admin/reports"},
+		{"Show again", "/admin/snippets/hide", url.Values{"id": {"4"}, "hidden": {"false"}}, http.StatusSeeOther, "/admin/snippets"},
+		{"Hide unknown", "/admin/snippets/hide", url.Values{"id": {"99"}, "hidden": {"true"}}, http.StatusNotFound, ""},
+		{"Back elsewhere", "/admin/snippets/hide", url.Values{"id": {"1"}, "hidden": {"true"}, "back": {"https://example.com"}}, http.StatusSeeOther, "/admin/snippets"},
+		{"Dismiss", "/admin/reports/dismiss", url.Values{"id": {"1"}}, http.StatusSeeOther, "/admin/reports"},
+		{"Dismiss invalid ID", "/admin/reports/dismiss", url.Values{"id": {"x"}}, http.StatusNotFound, ""},
+		{"Delete from the queue", "/admin/snippets/remove", url.Values{"id": {"1"}, "back": {"/admin/reports"}}, http.StatusSeeOther, "/admin/reports"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.form.Set("csrf_token", csrfToken)
+			code, header, _ := ts.postForm(t, tt.urlPath, tt.form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+		})
+	}
+
+	// users can't moderate
+	alice := newTestServer(app.setupRoutes())
+	defer alice.Close()
+	csrfToken = alice.login(t, "alice@example.com")
+	form := url.Values{"id": {"1"}, "hidden": {"true"}, "csrf_token": {csrfToken}}
+	if code, _, _ := alice.postForm(t, "/admin/snippets/hide", form); code != http.StatusForbidden {
+		t.Errorf("want %d for a user; got %d", http.StatusForbidden, code)
+	}
+}
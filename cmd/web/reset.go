@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/mailer"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// passwordResetTTL is how long the link in a password reset email works.
+const passwordResetTTL = time.Hour
+
+func (app *app) forgotPasswordForm(w http.ResponseWriter, r *http.Request) {
+	app.render(w, r, "forgot.page.tmpl", &templateData{Form: forms.New(nil)})
+}
+
+// forgotPassword mails a reset link to the address in the form. The answer is the same whether
+// or not there is an account for the address, so the form can't be used to find out.
+func (app *app) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.MatchesPattern("email", forms.EmailRX)
+	if !form.Valid() {
+		app.render(w, r, "forgot.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	token, err := app.passwordResets.New(r.Context(), form.Get("email"), passwordResetTTL)
+	if err != nil && err != models.ErrRecordNotFound {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err == nil {
+		link := app.absoluteURL(r, "/user/password/reset?token="+url.QueryEscape(token.Plaintext))
+		err = app.mailer.Send(r.Context(), mailer.Message{
+			To:      form.Get("email"),
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi,\n\nsomeone, hopefully you, asked to reset the password of your Snippetbox account. "+
+				"Follow the link below to choose a new one:\n\n%s\n\n"+
+				"The link works for %d minutes and only once. If you didn't ask for this, you can ignore this email.\n", link, int(passwordResetTTL.Minutes())),
+		})
+		// failing here would tell that the account exists, the user will have to try again
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "sending password reset email failed", "err", err)
+		}
+	}
+
+	app.session.Put(r, "flash", "If there is an account for that address, we've sent it a link to reset the password")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
+
+func (app *app) resetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(url.Values{"token": {r.URL.Query().Get("token")}})
+	app.render(w, r, "reset.page.tmpl", &templateData{Form: form})
+}
+
+// resetPassword sets the new password. The model logs out every session and revokes the API
+// tokens of the user along with it.
+func (app *app) resetPassword(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("token", "password")
+	form.MinLength("password", 10)
+	if !form.Valid() {
+		app.render(w, r, "reset.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	err = app.passwordResets.Reset(r.Context(), form.Get("token"), form.Get("password"))
+	if err == models.ErrRecordNotFound {
+		form.Errors.Add("generic", "This link is invalid, has expired or has already been used")
+		app.render(w, r, "reset.page.tmpl", &templateData{Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Destroy(r)
+	app.session.Put(r, "flash", "Your password has been reset. Please log in.")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/mailer"
+)
+
+func TestForgotPassword(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	mailDir := t.TempDir()
+	app.mailer = &mailer.File{Dir: mailDir}
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password/forgot")
+	csrfToken := extractCSRFToken(t, body)
+
+	// known and unknown addresses get the same answer, only the known one gets mail
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		form := url.Values{"email": {email}, "csrf_token": {csrfToken}}
+		code, header, _ := ts.postForm(t, "/user/password/forgot", form)
+		if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+			t.Errorf("%s: want redirect to /user/login; got %d %q", email, code, header.Get("Location"))
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 email sent; got %d", len(files))
+	}
+	mail, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(mail, []byte("/user/password/reset?token=RESETRESETRESETRESETRESETR")) {
+		t.Errorf("want the email to contain the reset link; got %q", mail)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/password/reset?token=RESETRESETRESETRESETRESETR")
+	csrfToken := extractCSRFToken(t, body)
+	if !bytes.Contains(body, []byte("value='RESETRESETRESETRESETRESETR'")) {
+		t.Errorf("want the token carried in the form, but got %q", body)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		password string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Short password", "RESETRESETRESETRESETRESETR", "pa$$word", http.StatusOK, []byte("This field is too short")},
+		{"Invalid token", "WRONG", "validPa$$word", http.StatusOK, []byte("This link is invalid")},
+		{"Valid token", "RESETRESETRESETRESETRESETR", "validPa$$word", http.StatusSeeOther, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"token": {tt.token}, "password": {tt.password}, "csrf_token": {csrfToken}}
+			code, _, body := ts.postForm(t, "/user/password/reset", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// TestSessionInvalidatedByPasswordChange logs in as a user whose password changes after the
+// session was created, which has to log the session out.
+func TestSessionInvalidatedByPasswordChange(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		"email":      {"dave@example.com"},
+		"password":   {"validPa$$word"},
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+	if code, _, _ := ts.postForm(t, "/user/login", form); code != http.StatusSeeOther {
+		t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+	}
+
+	code, header, _ := ts.get(t, "/snippet/create")
+	if code != http.StatusFound || header.Get("Location") != "/user/login" {
+		t.Errorf("want redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+}
@@ -5,30 +5,108 @@ import (
 
 	"github.com/bmizerany/pat"
 	"github.com/justinas/alice"
+	"github.com/vandit1604/snipshot/pkg/models"
 )
 
 func (app *app) setupRoutes() http.Handler {
 	// middlware chaining via alice
-	standardMiddleware := alice.New(app.recoverPanic, app.logRequest, secureHeaders)
+	standardMiddleware := alice.New(app.requestID, app.traceRequest, app.logRequest, app.recoverPanic, secureHeaders)
 
 	// we created this dynamic middleware because we dont need the static route to have session manager enabled on. The session manager uses the middleware to add the token to each request via the middleware
-	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.authenticate)
+	dynamicMiddleware := alice.New(app.session.Enable, noSurf, app.readYourWrites, app.authenticate)
 
-	mux := pat.New()
+	mux := router{pat.New(), app.metrics}
 	mux.Get("/", dynamicMiddleware.ThenFunc(app.home))
-	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippetForm))
-	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createSnippet))
+	mux.Get("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.createSnippetForm))
+	mux.Post("/snippet/create", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser, app.rateLimit("create", app.rateLimits.createSnippet)).ThenFunc(app.createSnippet))
+	mux.Get("/snippet/:id/raw", http.HandlerFunc(app.rawSnippet))
 	mux.Get("/snippet/:id", dynamicMiddleware.ThenFunc(app.showSnippet))
-	mux.Post("/user/signup", dynamicMiddleware.ThenFunc(app.signupUser))
+	mux.Post("/snippet/:id/report", dynamicMiddleware.Append(app.rateLimit("report", app.rateLimits.report)).ThenFunc(app.reportSnippet))
+	mux.Post("/user/signup", dynamicMiddleware.Append(app.rateLimit("signup", app.rateLimits.signup)).ThenFunc(app.signupUser))
 	mux.Get("/user/signup", dynamicMiddleware.ThenFunc(app.signupUserForm))
-	mux.Post("/user/login", dynamicMiddleware.ThenFunc(app.loginUser))
+	mux.Post("/user/login", dynamicMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.loginUser))
 	mux.Get("/user/login", dynamicMiddleware.ThenFunc(app.loginUserForm))
+	mux.Post("/user/login/2fa", dynamicMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.loginTwoFactor))
+	mux.Get("/user/login/2fa", dynamicMiddleware.ThenFunc(app.loginTwoFactorForm))
+	mux.Post("/user/login/passkey/begin", dynamicMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.beginPasskeyLogin))
+	mux.Post("/user/login/passkey/finish", dynamicMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.finishPasskeyLogin))
+	mux.Get("/user/login/oidc", dynamicMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.oidcLogin))
+	mux.Get("/user/login/oidc/callback", dynamicMiddleware.ThenFunc(app.oidcCallback))
+	mux.Get("/user/verify", dynamicMiddleware.ThenFunc(app.verifyUser))
+	mux.Post("/user/verify", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.rateLimit("signup", app.rateLimits.signup)).ThenFunc(app.resendVerification))
+	mux.Get("/user/password/forgot", dynamicMiddleware.ThenFunc(app.forgotPasswordForm))
+	mux.Post("/user/password/forgot", dynamicMiddleware.Append(app.rateLimit("reset", app.rateLimits.signup)).ThenFunc(app.forgotPassword))
+	mux.Get("/user/password/reset", dynamicMiddleware.ThenFunc(app.resetPasswordForm))
+	mux.Post("/user/password/reset", dynamicMiddleware.ThenFunc(app.resetPassword))
+	mux.Get("/user/profile", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.profile))
+	mux.Post("/user/profile", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.updateProfile))
+	mux.Post("/user/profile/password", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.changePassword))
+	mux.Get("/user/2fa", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.twoFactor))
+	mux.Post("/user/2fa/enable", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.enableTwoFactor))
+	mux.Post("/user/2fa/disable", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.disableTwoFactor))
+	mux.Get("/user/passkeys", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.listPasskeys))
+	mux.Post("/user/passkeys/begin", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.beginPasskeyRegistration))
+	mux.Post("/user/passkeys/finish", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.finishPasskeyRegistration))
+	mux.Post("/user/passkeys/delete", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.deletePasskey))
+	mux.Get("/user/sessions", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.listSessions))
+	mux.Post("/user/sessions/revoke", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.revokeSession))
+	mux.Post("/user/sessions/logout-all", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.logoutEverywhere))
+	mux.Get("/user/activity", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.loginActivity))
 	mux.Post("/user/logout", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.logoutUser))
+	mux.Get("/teams/join", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.joinTeamForm))
+	mux.Post("/teams/join", dynamicMiddleware.Append(app.requireAuthenticatedUser, app.requireVerifiedUser).ThenFunc(app.joinTeam))
+	mux.Get("/teams", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.listTeams))
+	mux.Post("/teams", dynamicMiddleware.Append(app.requireAuthenticatedUser).ThenFunc(app.createTeam))
+	mux.Get("/team/:slug", dynamicMiddleware.Append(app.requireTeamRole(models.TeamMember)).ThenFunc(app.showTeam))
+	mux.Post("/team/:slug/invite", dynamicMiddleware.Append(app.requireTeamRole(models.TeamOwner), app.rateLimit("signup", app.rateLimits.signup)).ThenFunc(app.inviteMember))
+	mux.Post("/team/:slug/members/remove", dynamicMiddleware.Append(app.requireTeamRole(models.TeamOwner)).ThenFunc(app.removeMember))
+	mux.Get("/admin/users", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.listUsers))
+	mux.Post("/admin/users/active", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.setUserActive))
+	mux.Post("/admin/users/role", dynamicMiddleware.Append(app.requireRole(models.RoleAdmin)).ThenFunc(app.setUserRole))
+	mux.Get("/admin/snippets", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.listAllSnippets))
+	mux.Post("/admin/snippets/remove", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.removeSnippet))
+	mux.Post("/admin/snippets/hide", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.hideSnippet))
+	mux.Get("/admin/reports", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.listReports))
+	mux.Post("/admin/reports/dismiss", dynamicMiddleware.Append(app.requireRole(models.RoleModerator)).ThenFunc(app.dismissReports))
+
+	// the JSON API used by cmd/snip authenticates with bearer tokens instead of the session cookie, so it skips the dynamic middleware (and with it the CSRF check)
+	apiMiddleware := alice.New(app.authenticateToken)
+	mux.Post("/api/tokens", apiMiddleware.Append(app.rateLimit("login", app.rateLimits.login)).ThenFunc(app.createToken))
+	mux.Get("/api/snippets", apiMiddleware.Append(app.requireTokenUser).ThenFunc(app.listSnippetsAPI))
+	mux.Post("/api/snippets", apiMiddleware.Append(app.requireTokenUser, app.requireVerifiedUser, app.rateLimit("create", app.rateLimits.createSnippet)).ThenFunc(app.createSnippetAPI))
 
 	// host the files inside the static directory to use the static assets.
 	fileServer := http.FileServer(http.Dir("./ui/static/"))
 	mux.Get("/static/", http.StripPrefix("/static", fileServer))
 	mux.Get("/healthcheck", http.HandlerFunc(ping))
+	mux.Get("/livez", http.HandlerFunc(ping))
+	mux.Get("/readyz", http.HandlerFunc(app.readyz))
+
+	// with a separate admin listener the metrics are served from there instead, see adminRoutes
+	if app.adminAddr == "" {
+		mux.Get("/metrics", app.metrics.handler())
+	}
 
 	return standardMiddleware.Then(mux)
 }
+
+// adminRoutes is served on the admin listener, when one is configured, away from public traffic.
+func (app *app) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metrics.handler())
+	return mux
+}
+
+// router registers handlers on the pat mux, instrumenting each one (metrics and the trace span name) with the pattern it is registered under.
+type router struct {
+	*pat.PatternServeMux
+	metrics *metrics
+}
+
+func (rt router) Get(pattern string, h http.Handler) {
+	rt.PatternServeMux.Get(pattern, rt.metrics.route(pattern, routeSpan(pattern, h)))
+}
+
+func (rt router) Post(pattern string, h http.Handler) {
+	rt.PatternServeMux.Post(pattern, rt.metrics.route(pattern, routeSpan(pattern, h)))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/secrets"
+)
+
+// secretsShown is how many of the secrets found in a snippet are named to the user.
+const secretsShown = 3
+
+// secretsCheck is what checkSecrets made of a new snippet.
+type secretsCheck struct {
+	title      string
+	content    string
+	visibility string
+	// blocked is set when the snippet mustn't be stored at all, message says why and field is the
+	// form field to show it on. Otherwise message says what was done to it, if anything.
+	blocked bool
+	field   string
+	message string
+}
+
+// checkSecrets scans the title and content of a new snippet for credentials and applies the
+// -secrets action to both. The secrets themselves are never logged.
+func (app *app) checkSecrets(ctx context.Context, title, content, visibility string) secretsCheck {
+	check := secretsCheck{title: title, content: content, visibility: visibility}
+	if app.secrets == nil || app.secretsAction == secrets.ActionOff {
+		return check
+	}
+
+	inTitle, inContent := app.secrets.Scan(title), app.secrets.Scan(content)
+	if len(inTitle) == 0 && len(inContent) == 0 {
+		return check
+	}
+
+	app.metrics.secretsFound.WithLabelValues(string(app.secretsAction)).Inc()
+	app.logger.InfoContext(ctx, "secret found in snippet", "action", app.secretsAction, "found", len(inTitle)+len(inContent))
+
+	found := describeSecrets(inTitle, inContent)
+	switch app.secretsAction {
+	case secrets.ActionPrivate:
+		check.visibility = models.VisibilityPrivate
+		check.message = "Your snippet looks like it contains a secret (" + found + "), so only you can see it"
+	case secrets.ActionRedact:
+		// the note left in place of a short key is longer than the key, so the title is cut back
+		// to the 100 characters the form allows
+		if redacted := []rune(secrets.Redact(title, inTitle)); len(redacted) > 100 {
+			check.title = string(redacted[:100])
+		} else {
+			check.title = string(redacted)
+		}
+		check.content = secrets.Redact(content, inContent)
+		check.message = "Your snippet looked like it contained a secret (" + found + "), which has been redacted"
+	default:
+		check.blocked = true
+		check.field = "content"
+		if len(inContent) == 0 {
+			check.field = "title"
+		}
+		check.message = "This looks like it contains a secret (" + found + "), take it out before publishing"
+	}
+
+	return check
+}
+
+// describeSecrets names the first few findings in the title and then the content, along with
+// where they are, e.g. "JWT in the title, AWS access key on line 3".
+func describeSecrets(inTitle, inContent []secrets.Finding) string {
+	var found []string
+	for _, f := range inTitle {
+		found = append(found, f.Kind+" in the title")
+	}
+	for _, f := range inContent {
+		found = append(found, fmt.Sprintf("%s on line %d", f.Kind, f.Line))
+	}
+
+	if len(found) > secretsShown {
+		found = append(found[:secretsShown], fmt.Sprintf("and %d more", len(found)-secretsShown))
+	}
+	return strings.Join(found, ", ")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// listSessions shows where the user is logged in, so they can spot and end sessions they don't
+// recognise.
+func (app *app) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := app.session.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "sessions.page.tmpl", &templateData{Sessions: sessions, CurrentSession: app.session.ID(r)})
+}
+
+// revokeSession logs out a single session of the user, which may be the current one.
+func (app *app) revokeSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := r.PostForm.Get("id")
+	if id == app.session.ID(r) {
+		app.logoutUser(w, r)
+		return
+	}
+
+	// only the user's own sessions can be ended, whatever ID was posted
+	sessions, err := app.session.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	var found *models.Session
+	for _, s := range sessions {
+		if s.ID == id {
+			found = s
+		}
+	}
+	if found == nil {
+		app.notFound(w)
+		return
+	}
+
+	if err := app.session.Store.Delete(r.Context(), found.ID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The session has been logged out")
+	http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+}
+
+// logoutEverywhere ends every session of the user, this one included, and revokes their API
+// tokens, which would otherwise keep working for whoever has one.
+func (app *app) logoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	userID := app.authenticatedUser(r).ID
+	if err := app.session.Store.DeleteForUser(r.Context(), userID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if err := app.tokens.DeleteForUser(r.Context(), userID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Destroy(r)
+	app.session.Put(r, "flash", "You have been logged out everywhere")
+	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+}
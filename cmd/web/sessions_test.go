@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/models/mock"
+)
+
+var (
+	sessionIDRX        = regexp.MustCompile(`name='id' value='([0-9a-f]{64})'`)
+	currentSessionIDRX = regexp.MustCompile(`(?s)<td>This session</td>.*?name='id' value='([0-9a-f]{64})'`)
+)
+
+// currentSessionID returns the ID of the session ts is logged in with, from the sessions page.
+func currentSessionID(t *testing.T, ts *testServer) string {
+	_, _, body := ts.get(t, "/user/sessions")
+	m := currentSessionIDRX.FindSubmatch(body)
+	if m == nil {
+		t.Fatalf("want the current session on the sessions page, but got %q", body)
+	}
+	return string(m[1])
+}
+
+// tokenRevoker is mock.TokenModel remembering whose tokens were deleted.
+type tokenRevoker struct {
+	mock.TokenModel
+	deletedFor []int
+}
+
+func (m *tokenRevoker) DeleteForUser(ctx context.Context, userID int) error {
+	m.deletedFor = append(m.deletedFor, userID)
+	return nil
+}
+
+func loggedIn(t *testing.T, ts *testServer) bool {
+	code, _, _ := ts.get(t, "/user/profile")
+	return code == http.StatusOK
+}
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	tokens := &tokenRevoker{}
+	app.tokens = tokens
+
+	// alice logs in from a laptop and a phone, carol from their own browser
+	laptop := newTestServer(app.setupRoutes())
+	defer laptop.Close()
+	phone := newTestServer(app.setupRoutes())
+	defer phone.Close()
+	carol := newTestServer(app.setupRoutes())
+	defer carol.Close()
+
+	csrfToken := laptop.login(t, "alice@example.com")
+	phone.login(t, "alice@example.com")
+	carolCSRFToken := carol.login(t, "carol@example.com")
+
+	code, _, body := laptop.get(t, "/user/sessions")
+	if code != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, code)
+	}
+	if ids := sessionIDRX.FindAllSubmatch(body, -1); len(ids) != 2 {
+		t.Fatalf("want alice's 2 sessions listed; got %d", len(ids))
+	}
+	phoneID := currentSessionID(t, phone)
+
+	// carol can't end alice's sessions
+	code, _, _ = carol.postForm(t, "/user/sessions/revoke", url.Values{"id": {phoneID}, "csrf_token": {carolCSRFToken}})
+	if code != http.StatusNotFound {
+		t.Errorf("want %d revoking someone else's session; got %d", http.StatusNotFound, code)
+	}
+	if !loggedIn(t, phone) {
+		t.Fatal("want the phone still logged in")
+	}
+
+	code, _, _ = laptop.postForm(t, "/user/sessions/revoke", url.Values{"id": {phoneID}, "csrf_token": {csrfToken}})
+	if code != http.StatusSeeOther {
+		t.Errorf("want %d; got %d", http.StatusSeeOther, code)
+	}
+	if loggedIn(t, phone) {
+		t.Error("want the phone logged out")
+	}
+	if !loggedIn(t, laptop) {
+		t.Error("want the laptop still logged in")
+	}
+
+	phone.login(t, "alice@example.com")
+	code, header, _ := laptop.postForm(t, "/user/sessions/logout-all", url.Values{"csrf_token": {csrfToken}})
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("want a redirect to /user/login; got %d %q", code, header.Get("Location"))
+	}
+	if loggedIn(t, laptop) || loggedIn(t, phone) {
+		t.Error("want alice logged out everywhere")
+	}
+	if !loggedIn(t, carol) {
+		t.Error("want carol still logged in")
+	}
+	if len(tokens.deletedFor) != 1 || tokens.deletedFor[0] != 1 {
+		t.Errorf("want alice's API tokens revoked; got them revoked for %v", tokens.deletedFor)
+	}
+	if _, _, body := laptop.get(t, "/user/login"); !bytes.Contains(body, []byte("You have been logged out everywhere")) {
+		t.Errorf("want the flash, but got %q", body)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+	u, _ := url.Parse(ts.URL)
+	stolen := ts.Client().Jar.Cookies(u)
+
+	ts.postForm(t, "/user/logout", url.Values{"csrf_token": {csrfToken}})
+
+	// someone who copied the cookie before the logout doesn't get in with it
+	thief := newTestServer(app.setupRoutes())
+	defer thief.Close()
+	tu, _ := url.Parse(thief.URL)
+	thief.Client().Jar.SetCookies(tu, stolen)
+	if loggedIn(t, thief) {
+		t.Error("want the copied cookie to be useless after logging out")
+	}
+}
+
+func TestLoginRenewsSession(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name        string
+		remember    string
+		wantPersist bool
+	}{
+		{"Forgotten when the browser closes", "", false},
+		{"Remember me", "on", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL)
+
+			// an attacker gets a session that isn't logged in yet, here half way through logging in
+			// with two-factor authentication, and plants its cookie in the victim's browser
+			attacker := newTestServer(app.setupRoutes())
+			defer attacker.Close()
+			_, _, body := attacker.get(t, "/user/login")
+			attacker.postForm(t, "/user/login", url.Values{"email": {"erin@example.com"}, "password": {"validPa$$word"}, "csrf_token": {extractCSRFToken(t, body)}})
+			planted := attacker.Client().Jar.Cookies(u)
+			if len(planted) == 0 {
+				t.Fatal("want the attacker to have a session to plant")
+			}
+
+			ts.Client().Jar.SetCookies(u, planted)
+			_, _, body = ts.get(t, "/user/login")
+			form := url.Values{"email": {"alice@example.com"}, "password": {"validPa$$word"}, "remember": {tt.remember}, "csrf_token": {extractCSRFToken(t, body)}}
+			code, header, _ := ts.postForm(t, "/user/login", form)
+			if code != http.StatusSeeOther {
+				t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+			}
+
+			var cookie *http.Cookie
+			for _, c := range (&http.Response{Header: header}).Cookies() {
+				if c.Name == "session" {
+					cookie = c
+				}
+			}
+			if cookie == nil {
+				t.Fatal("want a new session cookie")
+			}
+			if persistent := cookie.MaxAge > 0; persistent != tt.wantPersist {
+				t.Errorf("want persistent %t; got cookie %v", tt.wantPersist, cookie)
+			}
+
+			// the planted cookie didn't get logged in along with alice
+			attacker.Client().Jar.SetCookies(u, planted)
+			if loggedIn(t, attacker) {
+				t.Error("want the planted session not logged in")
+			}
+			if !loggedIn(t, ts) {
+				t.Error("want alice logged in")
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/mailer"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// invitationTTL is how long the link in a team invitation works.
+const invitationTTL = 7 * 24 * time.Hour
+
+// slugRX is what a team's name in its URL may look like.
+var slugRX = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,48}[a-z0-9])?$`)
+
+// currentTeam returns the team requireTeamRole loaded for the request.
+func (app *app) currentTeam(r *http.Request) *models.Team {
+	team, ok := r.Context().Value(contextKeyTeam).(*models.Team)
+	if !ok {
+		return nil
+	}
+	return team
+}
+
+// canView reports whether the user of r may see the snippet. Team only snippets are for the
+// members of their team, private ones for their author and everything else is for everybody.
+func (app *app) canView(r *http.Request, s *models.Snippet) (bool, error) {
+	if s.Visibility != models.VisibilityTeam && s.Visibility != models.VisibilityPrivate {
+		return true, nil
+	}
+
+	user := app.authenticatedUser(r)
+	if user == nil {
+		return false, nil
+	}
+	if s.Visibility == models.VisibilityPrivate {
+		return user.ID == s.UserID, nil
+	}
+
+	_, err := app.teams.Role(r.Context(), s.TeamID, user.ID)
+	if err == models.ErrRecordNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// listTeams shows the teams of the user, along with the form to start a new one.
+func (app *app) listTeams(w http.ResponseWriter, r *http.Request) {
+	app.renderTeams(w, r, forms.New(nil))
+}
+
+func (app *app) renderTeams(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	teams, err := app.teams.ForUser(r.Context(), app.authenticatedUser(r).ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "teams.page.tmpl", &templateData{Teams: teams, Form: form})
+}
+
+// createTeam starts a team with the user as its owner.
+func (app *app) createTeam(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "slug")
+	form.MaxLength("name", 100)
+	form.MatchesPattern("slug", slugRX)
+	if !form.Valid() {
+		app.renderTeams(w, r, form)
+		return
+	}
+
+	_, err := app.teams.Insert(r.Context(), app.authenticatedUser(r).ID, form.Get("name"), form.Get("slug"))
+	if err == models.ErrDuplicateTeam {
+		form.Errors.Add("slug", "This address is already taken")
+		app.renderTeams(w, r, form)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Your team has been created, invite the others from here")
+	http.Redirect(w, r, "/team/"+form.Get("slug"), http.StatusSeeOther)
+}
+
+// showTeam lists the snippets and members of a team to its members. Owners get the form to
+// invite more people as well.
+func (app *app) showTeam(w http.ResponseWriter, r *http.Request) {
+	app.renderTeam(w, r, forms.New(nil))
+}
+
+func (app *app) renderTeam(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	team := app.currentTeam(r)
+
+	snippets, err := app.snippets.ForTeam(r.Context(), team.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	members, err := app.teams.Members(r.Context(), team.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "team.page.tmpl", &templateData{Team: team, Snippets: snippets, Members: members, Form: form})
+}
+
+// inviteMember mails a link to join the team to the address in the form.
+func (app *app) inviteMember(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("email", "role")
+	form.MatchesPattern("email", forms.EmailRX)
+	form.PermittedValues("role", models.TeamMember, models.TeamOwner)
+	if !form.Valid() {
+		app.renderTeam(w, r, form)
+		return
+	}
+
+	team := app.currentTeam(r)
+	token, err := app.teams.Invite(r.Context(), team.ID, form.Get("email"), form.Get("role"), invitationTTL)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	link := app.absoluteURL(r, "/teams/join?token="+url.QueryEscape(token.Plaintext))
+	err = app.mailer.Send(r.Context(), mailer.Message{
+		To:      form.Get("email"),
+		Subject: fmt.Sprintf("Join %s on Snippetbox", team.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join the team %s on Snippetbox. Log in, or sign up with this email address, "+
+			"then follow the link below:\n\n%s\n\nThe link works for %d days and only once.\n",
+			app.authenticatedUser(r).Name, team.Name, link, int(invitationTTL.Hours()/24)),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "An invitation has been sent to "+form.Get("email"))
+	http.Redirect(w, r, "/team/"+team.Slug, http.StatusSeeOther)
+}
+
+// removeMember takes a member out of the team. Owners can't be removed, by themselves or by
+// another owner, so a team always has somebody left to run it and nobody can take it over.
+func (app *app) removeMember(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	team := app.currentTeam(r)
+	id, err := strconv.Atoi(r.PostForm.Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w)
+		return
+	}
+
+	if id == app.authenticatedUser(r).ID {
+		app.session.Put(r, "flash", "You can't remove yourself from a team you own")
+		http.Redirect(w, r, "/team/"+team.Slug, http.StatusSeeOther)
+		return
+	}
+
+	err = app.teams.RemoveMember(r.Context(), team.ID, id)
+	if err == models.ErrRecordNotFound {
+		app.notFound(w)
+		return
+	} else if err == models.ErrTeamOwner {
+		app.session.Put(r, "flash", "Owners can't be removed from a team")
+		http.Redirect(w, r, "/team/"+team.Slug, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "The member has been removed")
+	http.Redirect(w, r, "/team/"+team.Slug, http.StatusSeeOther)
+}
+
+// joinTeamForm is where the link in an invitation leads, the user confirms joining from there.
+func (app *app) joinTeamForm(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(url.Values{"token": {r.URL.Query().Get("token")}})
+	app.render(w, r, "join.page.tmpl", &templateData{Form: form})
+}
+
+// joinTeam accepts an invitation. The invitation is for an email address, which is why the user
+// has to have verified theirs.
+func (app *app) joinTeam(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	user := app.authenticatedUser(r)
+	team, err := app.teams.Accept(r.Context(), form.Get("token"), user.ID, user.Email)
+	if err == models.ErrRecordNotFound {
+		form.Errors.Add("generic", "This invitation is invalid, has expired, has already been used or is for another email address")
+		app.render(w, r, "join.page.tmpl", &templateData{Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "You have joined "+team.Name)
+	http.Redirect(w, r, "/team/"+team.Slug, http.StatusSeeOther)
+}
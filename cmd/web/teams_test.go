@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/mailer"
+)
+
+func TestShowTeam(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		email        string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Anonymous", "", "/team/platform", http.StatusFound, "/user/login", nil},
+		{"Owner", "alice@example.com", "/team/platform", http.StatusOK, "", []byte("Invite Someone")},
+		{"Member", "carol@example.com", "/team/platform", http.StatusOK, "", []byte("Deploy runbook")},
+		{"Outsider", "mia@example.com", "/team/platform", http.StatusNotFound, "", nil},
+		{"Unknown team", "alice@example.com", "/team/nope", http.StatusNotFound, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			if tt.email != "" {
+				ts.login(t, tt.email)
+			}
+
+			code, header, body := ts.get(t, tt.urlPath)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+
+	// members don't get the owner's forms
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+	ts.login(t, "carol@example.com")
+	if _, _, body := ts.get(t, "/team/platform"); bytes.Contains(body, []byte("Invite Someone")) {
+		t.Error("want no invite form for a member")
+	}
+}
+
+func TestCreateTeam(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name         string
+		teamName     string
+		slug         string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Valid", "Data", "data-eng", http.StatusSeeOther, "/team/data-eng", nil},
+		{"Taken slug", "Platform", "platform", http.StatusOK, "", []byte("This address is already taken")},
+		{"Invalid slug", "Data", "Data Eng", http.StatusOK, "", []byte("This field is invalid")},
+		{"No name", "", "data", http.StatusOK, "", []byte("This field cannot be blank")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"name": {tt.teamName}, "slug": {tt.slug}, "csrf_token": {csrfToken}}
+			code, header, body := ts.postForm(t, "/teams", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestInviteMember(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	mailDir := t.TempDir()
+	app.mailer = &mailer.File{Dir: mailDir}
+
+	tests := []struct {
+		name     string
+		email    string
+		invitee  string
+		role     string
+		wantCode int
+	}{
+		{"Member", "carol@example.com", "mia@example.com", "member", http.StatusForbidden},
+		{"Invalid email", "alice@example.com", "mia@", "member", http.StatusOK},
+		{"Unknown role", "alice@example.com", "mia@example.com", "admin", http.StatusOK},
+		{"Owner", "alice@example.com", "mia@example.com", "member", http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			csrfToken := ts.login(t, tt.email)
+
+			form := url.Values{"email": {tt.invitee}, "role": {tt.role}, "csrf_token": {csrfToken}}
+			if code, _, _ := ts.postForm(t, "/team/platform/invite", form); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+
+	files, _ := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 email sent; got %d", len(files))
+	}
+	mail, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(mail, []byte("/teams/join?token=INVITATIONINVITATION")) {
+		t.Errorf("want the email to contain the invitation link; got %q", mail)
+	}
+}
+
+func TestRemoveMember(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	tests := []struct {
+		name     string
+		id       string
+		wantCode int
+	}{
+		{"Member", "2", http.StatusSeeOther},
+		{"Not a member", "7", http.StatusNotFound},
+		{"Invalid ID", "x", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"id": {tt.id}, "csrf_token": {csrfToken}}
+			if code, _, _ := ts.postForm(t, "/team/platform/members/remove", form); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+
+	// owners can't leave their team without anyone to run it
+	ts.postForm(t, "/team/platform/members/remove", url.Values{"id": {"1"}, "csrf_token": {csrfToken}})
+	code, _, body := ts.get(t, "/team/platform")
+	if code != http.StatusOK || !bytes.Contains(body, []byte("You can&#39;t remove yourself from a team you own")) {
+		t.Errorf("want the owner still in with a flash; got %d %q", code, body)
+	}
+
+	// nor can they push another owner out
+	ts.postForm(t, "/team/platform/members/remove", url.Values{"id": {"3"}, "csrf_token": {csrfToken}})
+	code, _, body = ts.get(t, "/team/platform")
+	if code != http.StatusOK || !bytes.Contains(body, []byte("Owners can&#39;t be removed from a team")) {
+		t.Errorf("want the other owner still in with a flash; got %d %q", code, body)
+	}
+}
+
+func TestJoinTeam(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name         string
+		email        string
+		token        string
+		wantCode     int
+		wantLocation string
+		wantBody     []byte
+	}{
+		{"Invited", "mia@example.com", "INVITATIONINVITATION", http.StatusSeeOther, "/team/platform", nil},
+		{"Someone else", "grace@example.com", "INVITATIONINVITATION", http.StatusOK, "", []byte("This invitation is invalid")},
+		{"Invalid token", "mia@example.com", "WRONG", http.StatusOK, "", []byte("This invitation is invalid")},
+		{"Unverified", "carol@example.com", "INVITATIONINVITATION", http.StatusSeeOther, "/user/verify", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			csrfToken := ts.login(t, tt.email)
+
+			form := url.Values{"token": {tt.token}, "csrf_token": {csrfToken}}
+			code, header, body := ts.postForm(t, "/teams/join", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if loc := header.Get("Location"); loc != tt.wantLocation {
+				t.Errorf("want location %q; got %q", tt.wantLocation, loc)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestTeamSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		email    string
+		urlPath  string
+		wantCode int
+	}{
+		{"Anonymous", "", "/snippet/3", http.StatusNotFound},
+		{"Outsider", "mia@example.com", "/snippet/3", http.StatusNotFound},
+		{"Member", "carol@example.com", "/snippet/3", http.StatusOK},
+		{"Owner", "alice@example.com", "/snippet/3", http.StatusOK},
+		{"Raw", "alice@example.com", "/snippet/3/raw", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			if tt.email != "" {
+				ts.login(t, tt.email)
+			}
+
+			if code, _, _ := ts.get(t, tt.urlPath); code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+		})
+	}
+}
+
+func TestCreateTeamSnippet(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name       string
+		email      string
+		team       string
+		visibility string
+		wantCode   int
+		wantBody   []byte
+	}{
+		{"Team only", "alice@example.com", "platform", "team", http.StatusSeeOther, nil},
+		{"Public in a team", "alice@example.com", "platform", "public", http.StatusSeeOther, nil},
+		{"Team only without a team", "alice@example.com", "", "team", http.StatusOK, []byte("Only the snippets of a team can be kept to the team")},
+		{"Someone else's team", "mia@example.com", "platform", "team", http.StatusOK, []byte("You aren&#39;t a member of this team")},
+		{"Unknown visibility", "alice@example.com", "platform", "everyone", http.StatusOK, []byte("This field is invalid")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+			csrfToken := ts.login(t, tt.email)
+
+			form := url.Values{
+				"title":      {"Deploy runbook"},
+				"content":    {"make deploy"},
+				"expires":    {"7"},
+				"team":       {tt.team},
+				"visibility": {tt.visibility},
+				"csrf_token": {csrfToken},
+			}
+			code, _, body := ts.postForm(t, "/snippet/create", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
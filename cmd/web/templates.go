@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/base64"
 	"html/template"
 	"path/filepath"
 	"time"
@@ -10,11 +11,33 @@ import (
 )
 
 type templateData struct {
-	Snippet           *models.Snippet
-	Snippets          []*models.Snippet
-	CurrentYear       int
-	Form              *forms.Form
-	Flash             string
+	Snippet       *models.Snippet
+	Snippets      []*models.Snippet
+	LoginAttempts []*models.LoginAttempt
+	Passkeys      []*models.Passkey
+	Sessions      []*models.Session
+	Users         []*models.User
+	Team          *models.Team
+	Teams         []*models.Team
+	Members       []*models.Member
+	// Roles are the roles a user can be given, for the admin area.
+	Roles []string
+	// Reports is the moderation queue.
+	Reports []*models.ReportedSnippet
+	// Reasons are the reasons a snippet can be reported for.
+	Reasons []string
+	// CurrentSession is the ID of the session the page is shown to.
+	CurrentSession string
+	CurrentYear    int
+	Form           *forms.Form
+	PasswordForm   *forms.Form
+	TOTP           *totpEnrollment
+	RecoveryCodes  []string
+	Flash          string
+	// Next is where a page that moves on by itself goes, "/" if empty.
+	Next string
+	// SSO is the name of the single sign-on provider, empty if there is none.
+	SSO               string
 	AuthenticatedUser *models.User
 	CSRFToken         string
 }
@@ -64,6 +87,12 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// base64url encodes binary IDs, like those of passkeys, for forms and URLs.
+func base64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 var templateFunctions = template.FuncMap{
 	"humanDate": humanDate,
+	"base64url": base64url,
 }
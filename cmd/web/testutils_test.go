@@ -4,6 +4,7 @@ import (
 	"html"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/http/httptest"
@@ -12,8 +13,11 @@ import (
 	"testing"
 	"time"
 
-	"github.com/golangcollege/sessions"
+	"github.com/vandit1604/snipshot/pkg/mailer"
 	"github.com/vandit1604/snipshot/pkg/models/mock"
+	"github.com/vandit1604/snipshot/pkg/secrets"
+	"github.com/vandit1604/snipshot/pkg/session"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // Create a newTestApplication helper which returns an instance of our
@@ -25,19 +29,38 @@ func newTestApplication(t *testing.T) *app {
 		t.Fatal(err)
 	}
 	// Create a session manager instance, with the same settings as production.
-	session := sessions.New([]byte("3dSm5MnygFHh7XidAtbskXrjbwfoJcbJ"))
-	session.Lifetime = 12 * time.Hour
-	session.Secure = true
+	sessionManager := session.New(session.NewMemory())
+	sessionManager.Lifetime = 12 * time.Hour
+	sessionManager.Secure = true
+	sessionManager.SameSite = http.SameSiteStrictMode
+
+	webAuthn, err := newWebAuthn(testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Initialize the dependencies, using the mocks for the loggers and
 	// database models.
 	return &app{
-		errorLog:      log.New(io.Discard, "", 0),
-		infoLog:       log.New(io.Discard, "", 0),
-		session:       session,
-		templateCache: templateCache,
-		snippets:      &mock.SnippetModel{},
-		users:         &mock.UserModel{},
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		session:         sessionManager,
+		templateCache:   templateCache,
+		snippets:        &mock.SnippetModel{},
+		users:           &mock.UserModel{},
+		authenticator:   &mock.UserModel{},
+		tokens:          &mock.TokenModel{},
+		passkeys:        &mock.PasskeyModel{},
+		loginAttempts:   &mock.LoginAttemptModel{},
+		passwordResets:  &mock.PasswordResetModel{},
+		teams:           &mock.TeamModel{},
+		reports:         &mock.ReportModel{},
+		secrets:         &secrets.Scanner{MinEntropy: 4.5},
+		secretsAction:   secrets.ActionBlock,
+		mailer:          &mailer.File{Dir: t.TempDir(), From: "no-reply@example.com"},
+		verificationKey: []byte("dVMNrAE5Gp2CgYWhL3fRiMzJ4tQ8sKbX"),
+		webauthn:        webAuthn,
+		metrics:         newMetrics(),
+		tracer:          noop.NewTracerProvider().Tracer(tracerName),
 	}
 }
 
@@ -122,3 +145,17 @@ func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (i
 	// Return the response status, headers, and body.
 	return rs.StatusCode, rs.Header, body
 }
+
+// login logs the test server's client in as the mock user with the given email address and
+// returns a CSRF token valid for its session.
+func (ts *testServer) login(t *testing.T, email string) string {
+	_, _, body := ts.get(t, "/user/login")
+	csrfToken := extractCSRFToken(t, body)
+
+	form := url.Values{"email": {email}, "password": {"validPa$$word"}, "csrf_token": {csrfToken}}
+	if code, _, _ := ts.postForm(t, "/user/login", form); code != http.StatusSeeOther {
+		t.Fatalf("logging in as %s: want %d; got %d", email, http.StatusSeeOther, code)
+	}
+
+	return csrfToken
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceRequest(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	app := newTestApplication(t)
+	app.tracer = tp.Tracer(tracerName)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/snippet/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rs, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs.Body.Close()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	server, ok := spans["GET /snippet/:id"]
+	if !ok {
+		t.Fatalf("want a server span named after the route; got %v", spans)
+	}
+	if got := server.SpanContext.TraceID().String(); got != traceID {
+		t.Errorf("want the trace of the traceparent header %s; got %s", traceID, got)
+	}
+
+	render, ok := spans["render show.page.tmpl"]
+	if !ok {
+		t.Fatalf("want a render span; got %v", spans)
+	}
+	if render.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Errorf("want the render span to be a child of the server span")
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"html/template"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// pendingLoginTTL is how long a user who got their password right has to enter their code.
+const pendingLoginTTL = 5 * time.Minute
+
+// recoveryCodeCount is how many recovery codes a user gets when enabling two-factor authentication.
+const recoveryCodeCount = 10
+
+// totpEnrollment is shown while setting up an authenticator app.
+type totpEnrollment struct {
+	Secret string
+	// URL is the otpauth:// URI, QRCode the same as a PNG data URI.
+	URL    string
+	QRCode template.URL
+}
+
+func newTOTPEnrollment(key *otp.Key) (*totpEnrollment, error) {
+	img, err := key.Image(200, 200)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return &totpEnrollment{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())),
+	}, nil
+}
+
+// twoFactor shows the two-factor settings of the user. Users without it get a new secret to
+// set up their app with, kept in the session (as the otpauth URI) until they confirm it with a
+// code.
+func (app *app) twoFactor(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	if user.TOTPEnabled {
+		app.render(w, r, "twofactor.page.tmpl", &templateData{Form: forms.New(nil)})
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Snippetbox", AccountName: user.Email})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.session.Put(r, "totpURL", key.String())
+
+	app.renderTOTPEnrollment(w, r, key.String(), forms.New(nil))
+}
+
+func (app *app) renderTOTPEnrollment(w http.ResponseWriter, r *http.Request, url string, form *forms.Form) {
+	key, err := otp.NewKeyFromURL(url)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	enrollment, err := newTOTPEnrollment(key)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, "twofactor.page.tmpl", &templateData{Form: form, TOTP: enrollment})
+}
+
+// enableTwoFactor checks a code from the app the user just set up, which shows they got the
+// secret in, and turns two-factor authentication on. The recovery codes are shown this once.
+func (app *app) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	url := app.session.GetString(r, "totpURL")
+	if user.TOTPEnabled || url == "" {
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	key, err := otp.NewKeyFromURL(url)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if form.Valid() && !totp.Validate(strings.TrimSpace(form.Get("code")), key.Secret()) {
+		form.Errors.Add("code", "Code is incorrect, check the time on your device is right")
+	}
+	if !form.Valid() {
+		app.renderTOTPEnrollment(w, r, url, form)
+		return
+	}
+
+	codes, err := generateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.users.EnableTOTP(r.Context(), user.ID, key.Secret(), codes); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.session.Remove(r, "totpURL")
+	app.session.RenewToken(r)
+
+	app.render(w, r, "twofactor.page.tmpl", &templateData{Form: forms.New(nil), RecoveryCodes: codes})
+}
+
+// disableTwoFactor asks for the password again, a session left logged in shouldn't be enough
+// to take the second factor off an account.
+func (app *app) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	form := forms.New(r.PostForm)
+	form.Required("password")
+	if !form.Valid() {
+		app.render(w, r, "twofactor.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	id, err := app.authenticator.Authenticate(r.Context(), user.Email, form.Get("password"))
+	app.recordLoginAttempt(r, user.Email, err)
+	if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked || (err == nil && id != user.ID) {
+		form.Errors.Add("password", "Password is incorrect")
+		app.render(w, r, "twofactor.page.tmpl", &templateData{Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.users.DisableTOTP(r.Context(), user.ID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.RenewToken(r)
+	app.session.Put(r, "flash", "Two-factor authentication has been turned off")
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
+
+// awaitSecondFactor remembers that user id got past the first factor, a password or single
+// sign-on, and now owes loginTwoFactor their code.
+func (app *app) awaitSecondFactor(r *http.Request, id int, remember bool) {
+	app.session.Put(r, "pendingUserID", id)
+	app.session.Put(r, "pendingUntil", time.Now().Add(pendingLoginTTL))
+	app.session.Put(r, "pendingRemember", remember)
+}
+
+// loginTwoFactorForm is where loginUser and the single sign-on callback send users with two-factor
+// authentication, after they got past the first factor.
+func (app *app) loginTwoFactorForm(w http.ResponseWriter, r *http.Request) {
+	if !app.session.Exists(r, "pendingUserID") {
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	app.render(w, r, "login2fa.page.tmpl", &templateData{Form: forms.New(nil)})
+}
+
+func (app *app) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	id := app.session.GetInt(r, "pendingUserID")
+	if id == 0 || time.Now().After(app.session.GetTime(r, "pendingUntil")) {
+		app.session.Remove(r, "pendingUserID")
+		app.session.Put(r, "flash", "That took too long, please log in again")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code")
+	if !form.Valid() {
+		app.render(w, r, "login2fa.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	err = app.checkSecondFactor(r.Context(), id, form.Get("code"))
+	if err == models.ErrInvalidCredenetials || err == models.ErrAccountLocked {
+		app.metrics.loginFailures.Inc()
+		user, getErr := app.users.Get(r.Context(), id)
+		if getErr != nil {
+			app.serverError(w, r, getErr)
+			return
+		}
+		app.recordSecondFactorAttempt(r, user.Email, err)
+
+		// they know the password already, there's nothing to give away by saying it's locked
+		if err == models.ErrAccountLocked {
+			form.Errors.Add("code", "Too many wrong codes, please try again later")
+		} else {
+			form.Errors.Add("code", "Code is incorrect")
+		}
+		app.render(w, r, "login2fa.page.tmpl", &templateData{Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	remember := app.session.GetBool(r, "pendingRemember")
+	app.session.Remove(r, "pendingUserID")
+	app.session.Remove(r, "pendingUntil")
+	app.session.Remove(r, "pendingRemember")
+	app.logIn(r, id, remember)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// checkSecondFactor accepts either a six digit code from the user's app, once, or one of their
+// recovery codes, which is used up. It returns ErrInvalidCredenetials for a wrong code, which
+// counts against the account's lockout like a wrong password, and ErrAccountLocked while the
+// account is locked.
+func (app *app) checkSecondFactor(ctx context.Context, userID int, code string) error {
+	code = strings.TrimSpace(code)
+
+	var err error
+	if len(code) == 6 && strings.Trim(code, "0123456789") == "" {
+		err = app.useTOTPCode(ctx, userID, code)
+	} else {
+		err = app.users.UseRecoveryCode(ctx, userID, code)
+	}
+
+	if err == models.ErrInvalidCredenetials {
+		if err := app.users.SecondFactorFailed(ctx, userID); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// totpPeriod is how long a code from an authenticator app is good for, the default of
+// github.com/pquerna/otp.
+const totpPeriod = 30 * time.Second
+
+// useTOTPCode checks a code from the user's app, allowing for a period of clock drift either way
+// like totp.Validate, and records its time step so it can't be used again.
+func (app *app) useTOTPCode(ctx context.Context, userID int, code string) error {
+	secret, err := app.users.TOTPSecret(ctx, userID)
+	if err == models.ErrRecordNotFound {
+		return models.ErrInvalidCredenetials
+	} else if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, drift := range []time.Duration{0, -totpPeriod, totpPeriod} {
+		t := now.Add(drift)
+		want, err := totp.GenerateCode(secret, t)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(want)) == 1 {
+			return app.users.UseTOTPStep(ctx, userID, t.Unix()/int64(totpPeriod/time.Second))
+		}
+	}
+
+	return models.ErrInvalidCredenetials
+}
+
+// generateRecoveryCodes makes codes of 10 base32 characters, about 50 random bits each, written
+// as two groups of five.
+func generateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"github.com/vandit1604/snipshot/pkg/models"
+	"github.com/vandit1604/snipshot/pkg/models/mock"
+)
+
+// mockTOTPSecret is the secret of erin@example.com in the mock user model.
+const mockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func TestLoginTwoFactor(t *testing.T) {
+	t.Parallel()
+
+	code, err := totp.GenerateCode(mockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wantOutcome is the login attempt recorded for the code, on top of the one for the password
+	tests := []struct {
+		name        string
+		code        string
+		wantCode    int
+		wantBody    []byte
+		wantOutcome string
+	}{
+		{"Wrong code", "000000", http.StatusOK, []byte("Code is incorrect"), models.LoginSecondFactorFailed},
+		{"Unknown recovery code", "ZZZZZ-ZZZZZ", http.StatusOK, []byte("Code is incorrect"), models.LoginSecondFactorFailed},
+		{"Empty code", "", http.StatusOK, []byte("This field cannot be blank"), ""},
+		{"Valid code", code, http.StatusSeeOther, nil, ""},
+		{"Recovery code", "ABCDE-FGHIJ", http.StatusSeeOther, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			attempts := &attemptRecorder{}
+			app.loginAttempts = attempts
+			ts := newTestServer(app.setupRoutes())
+			defer ts.Close()
+
+			_, _, body := ts.get(t, "/user/login")
+			csrfToken := extractCSRFToken(t, body)
+			form := url.Values{"email": {"erin@example.com"}, "password": {"validPa$$word"}, "csrf_token": {csrfToken}}
+			_, header, _ := ts.postForm(t, "/user/login", form)
+			if header.Get("Location") != "/user/login/2fa" {
+				t.Fatalf("want redirect to /user/login/2fa; got %q", header.Get("Location"))
+			}
+
+			// the password alone doesn't log in
+			if code, _, _ := ts.get(t, "/user/profile"); code != http.StatusFound {
+				t.Errorf("want %d before the code is entered; got %d", http.StatusFound, code)
+			}
+
+			form = url.Values{"code": {tt.code}, "csrf_token": {csrfToken}}
+			code, _, body := ts.postForm(t, "/user/login/2fa", form)
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+
+			wantProfile := http.StatusFound
+			if tt.wantCode == http.StatusSeeOther {
+				wantProfile = http.StatusOK
+			}
+			if code, _, _ := ts.get(t, "/user/profile"); code != wantProfile {
+				t.Errorf("want %d for the profile afterwards; got %d", wantProfile, code)
+			}
+
+			var got string
+			if outcomes := attempts.recorded(); len(outcomes) > 1 {
+				got = outcomes[len(outcomes)-1]
+			}
+			if got != tt.wantOutcome {
+				t.Errorf("want %q recorded for the code; got %q", tt.wantOutcome, got)
+			}
+		})
+	}
+}
+
+// attemptRecorder is mock.LoginAttemptModel remembering the outcomes recorded.
+type attemptRecorder struct {
+	mock.LoginAttemptModel
+	mu       sync.Mutex
+	outcomes []string
+}
+
+func (m *attemptRecorder) Insert(ctx context.Context, email, ip, userAgent, outcome string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes = append(m.outcomes, outcome)
+	return nil
+}
+
+func (m *attemptRecorder) recorded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.outcomes...)
+}
+
+// secondFactorRecorder is mock.UserModel remembering the wrong codes and the last time step
+// used, like mysql.UserModel does.
+type secondFactorRecorder struct {
+	mock.UserModel
+	mu       sync.Mutex
+	failures int
+	lastStep int64
+	locked   bool
+}
+
+func (m *secondFactorRecorder) TOTPSecret(ctx context.Context, id int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked {
+		return "", models.ErrAccountLocked
+	}
+	return m.UserModel.TOTPSecret(ctx, id)
+}
+
+func (m *secondFactorRecorder) UseTOTPStep(ctx context.Context, id int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if step <= m.lastStep {
+		return models.ErrInvalidCredenetials
+	}
+	m.lastStep = step
+	return nil
+}
+
+func (m *secondFactorRecorder) SecondFactorFailed(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures++
+	return nil
+}
+
+func TestLoginTwoFactorFailures(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	users := &secondFactorRecorder{}
+	app.users = users
+
+	code, err := totp.GenerateCode(mockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// enterCode logs erin in with their password in a browser of its own and enters code
+	enterCode := func(code string) (int, []byte) {
+		ts := newTestServer(app.setupRoutes())
+		defer ts.Close()
+		_, _, body := ts.get(t, "/user/login")
+		csrfToken := extractCSRFToken(t, body)
+		ts.postForm(t, "/user/login", url.Values{"email": {"erin@example.com"}, "password": {"validPa$$word"}, "csrf_token": {csrfToken}})
+		status, _, body := ts.postForm(t, "/user/login/2fa", url.Values{"code": {code}, "csrf_token": {csrfToken}})
+		return status, body
+	}
+
+	if _, body := enterCode("000000"); !bytes.Contains(body, []byte("Code is incorrect")) {
+		t.Errorf("want the wrong code refused, but got %q", body)
+	}
+	if _, body := enterCode("ZZZZZ-ZZZZZ"); !bytes.Contains(body, []byte("Code is incorrect")) {
+		t.Errorf("want the wrong recovery code refused, but got %q", body)
+	}
+	if users.failures != 2 {
+		t.Errorf("want 2 wrong codes counted against the account; got %d", users.failures)
+	}
+
+	if status, _ := enterCode(code); status != http.StatusSeeOther {
+		t.Fatalf("want the code accepted; got %d", status)
+	}
+	if _, body := enterCode(code); !bytes.Contains(body, []byte("Code is incorrect")) {
+		t.Errorf("want the code refused the second time, but got %q", body)
+	}
+	if users.failures != 3 {
+		t.Errorf("want the reused code counted as well; got %d", users.failures)
+	}
+
+	// while locked not even the right code gets in
+	users.locked, users.lastStep = true, 0
+	if _, body := enterCode(code); !bytes.Contains(body, []byte("Too many wrong codes")) {
+		t.Errorf("want the account locked, but got %q", body)
+	}
+	if users.failures != 3 {
+		t.Errorf("want nothing counted while locked; got %d", users.failures)
+	}
+}
+
+var (
+	totpKeyRx      = regexp.MustCompile(`Key: <code>([A-Z2-7]+)</code>`)
+	recoveryCodeRx = regexp.MustCompile(`[A-Z2-7]{5}-[A-Z2-7]{5}`)
+)
+
+func TestEnableTwoFactor(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "alice@example.com")
+
+	_, _, body := ts.get(t, "/user/2fa")
+	if !bytes.Contains(body, []byte("data:image/png;base64,")) {
+		t.Errorf("want a QR code, but got %q", body)
+	}
+	matches := totpKeyRx.FindSubmatch(body)
+	if matches == nil {
+		t.Fatalf("no key found in body %q", body)
+	}
+
+	form := url.Values{"code": {"000000"}, "csrf_token": {csrfToken}}
+	_, _, body = ts.postForm(t, "/user/2fa/enable", form)
+	if !bytes.Contains(body, []byte("Code is incorrect")) || !bytes.Contains(body, matches[0]) {
+		t.Errorf("want an error and the same key shown again, but got %q", body)
+	}
+
+	code, err := totp.GenerateCode(string(matches[1]), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	form.Set("code", code)
+	status, _, body := ts.postForm(t, "/user/2fa/enable", form)
+	if status != http.StatusOK {
+		t.Fatalf("want %d; got %d", http.StatusOK, status)
+	}
+	if n := len(recoveryCodeRx.FindAll(body, -1)); n != recoveryCodeCount {
+		t.Errorf("want %d recovery codes shown; got %d", recoveryCodeCount, n)
+	}
+
+	// an unverified account may belong to someone squatting the address, whose recovery codes
+	// would outlive the owner taking it back
+	unverified := newTestServer(app.setupRoutes())
+	defer unverified.Close()
+	form.Set("csrf_token", unverified.login(t, "carol@example.com"))
+	status, header, _ := unverified.postForm(t, "/user/2fa/enable", form)
+	if status != http.StatusSeeOther || header.Get("Location") != "/user/verify" {
+		t.Errorf("want a redirect to /user/verify; got %d %q", status, header.Get("Location"))
+	}
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	csrfToken := ts.login(t, "erin@example.com")
+	code, err := totp.GenerateCode(mockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.postForm(t, "/user/login/2fa", url.Values{"code": {code}, "csrf_token": {csrfToken}})
+
+	_, _, body := ts.postForm(t, "/user/2fa/disable", url.Values{"csrf_token": {csrfToken}})
+	if !bytes.Contains(body, []byte("This field cannot be blank")) {
+		t.Errorf("want the password required, but got %q", body)
+	}
+
+	status, header, _ := ts.postForm(t, "/user/2fa/disable", url.Values{"password": {"validPa$$word"}, "csrf_token": {csrfToken}})
+	if status != http.StatusSeeOther || header.Get("Location") != "/user/2fa" {
+		t.Errorf("want redirect to /user/2fa; got %d %q", status, header.Get("Location"))
+	}
+}
+
+func TestCreateTokenTwoFactor(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	attempts := &attemptRecorder{}
+	app.loginAttempts = attempts
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	code, err := totp.GenerateCode(mockTOTPSecret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody []byte
+	}{
+		{"No code", `{"email":"erin@example.com","password":"validPa$$word"}`, http.StatusUnauthorized, []byte("two-factor code required")},
+		{"Wrong code", `{"email":"erin@example.com","password":"validPa$$word","code":"000000"}`, http.StatusUnauthorized, []byte("two-factor code is incorrect")},
+		{"Valid code", `{"email":"erin@example.com","password":"validPa$$word","code":"` + code + `"}`, http.StatusCreated, []byte(`"token"`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.do(t, http.MethodPost, "/api/tokens", "", tt.body)
+			if status != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, status)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+
+	var wrongCodes int
+	for _, outcome := range attempts.recorded() {
+		if outcome == models.LoginSecondFactorFailed {
+			wrongCodes++
+		}
+	}
+	if wrongCodes != 1 {
+		t.Errorf("want the wrong code recorded as %q once; got %v", models.LoginSecondFactorFailed, attempts.recorded())
+	}
+}
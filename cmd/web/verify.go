@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/forms"
+	"github.com/vandit1604/snipshot/pkg/mailer"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// verificationTTL is how long the link in a verification email works.
+const verificationTTL = 48 * time.Hour
+
+var errInvalidVerificationToken = errors.New("invalid or expired verification token")
+
+// signVerification makes the token put in the verification link. It carries the email address
+// and expiry, signed with the app's verification key, so nothing needs to be stored until the
+// link is followed. The tokens are single-use because UserModel.Verify only verifies users who
+// aren't verified yet.
+func (app *app) signVerification(email string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(email)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(app.verificationMAC(payload))
+}
+
+// checkVerification returns the email address a token was signed for, if the signature is
+// valid and the token hasn't expired.
+func (app *app) checkVerification(token string, now time.Time) (string, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return "", errInvalidVerificationToken
+	}
+	payload := token[:i]
+
+	mac, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(mac, app.verificationMAC(payload)) {
+		return "", errInvalidVerificationToken
+	}
+
+	encodedEmail, expiresStr, _ := strings.Cut(payload, ".")
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || now.After(time.Unix(expires, 0)) {
+		return "", errInvalidVerificationToken
+	}
+
+	email, err := base64.RawURLEncoding.DecodeString(encodedEmail)
+	if err != nil {
+		return "", errInvalidVerificationToken
+	}
+
+	return string(email), nil
+}
+
+func (app *app) verificationMAC(payload string) []byte {
+	h := hmac.New(sha256.New, app.verificationKey)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// absoluteURL turns a path into a link for emails, on the configured base URL or else on the
+// host the request came in on.
+func (app *app) absoluteURL(r *http.Request, path string) string {
+	if app.baseURL != "" {
+		return strings.TrimSuffix(app.baseURL, "/") + path
+	}
+	return "https://" + r.Host + path
+}
+
+// sendVerificationEmail mails the user a link to /user/verify.
+func (app *app) sendVerificationEmail(r *http.Request, email string) error {
+	token := app.signVerification(email, time.Now().Add(verificationTTL))
+	link := app.absoluteURL(r, "/user/verify?token="+url.QueryEscape(token))
+
+	return app.mailer.Send(r.Context(), mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi,\n\nplease confirm that this is your email address by following the link below:\n\n%s\n\n"+
+			"The link works for %d hours. If you didn't sign up to Snippetbox, you can ignore this email.\n", link, int(verificationTTL.Hours())),
+	})
+}
+
+// verifyUser follows the link from the verification email. Without a token it shows the page
+// telling the user to check their email.
+func (app *app) verifyUser(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(nil)
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		app.render(w, r, "verify.page.tmpl", &templateData{Form: form})
+		return
+	}
+
+	email, err := app.checkVerification(token, time.Now())
+	if err == nil {
+		err = app.users.Verify(r.Context(), email)
+	}
+	if err == errInvalidVerificationToken || err == models.ErrRecordNotFound {
+		form.Errors.Add("generic", "This link is invalid, has expired or has already been used")
+		app.render(w, r, "verify.page.tmpl", &templateData{Form: form})
+		return
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// a verified user may do more, which deserves a new token like logging in does
+	app.session.RenewToken(r)
+	app.session.Put(r, "flash", "Your email address has been verified")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// resendVerification mails the logged in user a new verification link.
+func (app *app) resendVerification(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	if user.Verified {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.sendVerificationEmail(r, user.Email); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "We've sent you a new verification email")
+	http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+}
+
+// requireVerifiedUser keeps users who haven't verified their email address from creating
+// snippets. It has to come after requireAuthenticatedUser (or requireTokenUser) in the chain.
+func (app *app) requireVerifiedUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.authenticatedUser(r).Verified {
+			if isAPIRequest(r) {
+				app.apiError(w, r, http.StatusForbidden, "you must verify your email address to access this resource")
+				return
+			}
+			http.Redirect(w, r, "/user/verify", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/mailer"
+)
+
+func TestVerificationToken(t *testing.T) {
+	t.Parallel()
+	a := newTestApplication(t)
+	now := time.Now()
+	token := a.signVerification("carol@example.com", now.Add(time.Hour))
+
+	email, err := a.checkVerification(token, now)
+	if err != nil || email != "carol@example.com" {
+		t.Fatalf("want %q; got %q, %v", "carol@example.com", email, err)
+	}
+
+	other := newTestApplication(t)
+	other.verificationKey = []byte("another key")
+
+	tests := []struct {
+		name  string
+		app   *app
+		token string
+		now   time.Time
+	}{
+		{"Expired", a, token, now.Add(2 * time.Hour)},
+		{"Tampered", a, strings.Replace(token, token[:4], "AAAA", 1), now},
+		{"Other key", other, token, now},
+		{"Garbage", a, "not-a-token", now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.app.checkVerification(tt.token, tt.now); err != errInvalidVerificationToken {
+				t.Errorf("want %v; got %v", errInvalidVerificationToken, err)
+			}
+		})
+	}
+}
+
+func TestVerifyUser(t *testing.T) {
+	t.Parallel()
+	app := newTestApplication(t)
+	mailDir := t.TempDir()
+	app.mailer = &mailer.File{Dir: mailDir}
+	ts := newTestServer(app.setupRoutes())
+	defer ts.Close()
+
+	// signing up mails a verification link
+	_, _, body := ts.get(t, "/user/signup")
+	form := url.Values{
+		"name":       {"Carol"},
+		"email":      {"carol@example.com"},
+		"password":   {"validPa$$word"},
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+	if code, _, _ := ts.postForm(t, "/user/signup", form); code != http.StatusSeeOther {
+		t.Fatalf("want %d; got %d", http.StatusSeeOther, code)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(mailDir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("want 1 email sent; got %d", len(files))
+	}
+	mail, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(mail, []byte("/user/verify?token=")) {
+		t.Errorf("want the email to contain a verification link; got %q", mail)
+	}
+
+	// unverified users can't create snippets until they follow the link
+	_, _, body = ts.get(t, "/user/login")
+	form = url.Values{
+		"email":      {"carol@example.com"},
+		"password":   {"validPa$$word"},
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+	ts.postForm(t, "/user/login", form)
+
+	code, header, _ := ts.get(t, "/snippet/create")
+	if code != http.StatusSeeOther || header.Get("Location") != "/user/verify" {
+		t.Errorf("want redirect to /user/verify; got %d %q", code, header.Get("Location"))
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody []byte
+	}{
+		{"Valid token", app.signVerification("carol@example.com", time.Now().Add(time.Hour)), http.StatusSeeOther, nil},
+		{"Already verified", app.signVerification("alice@example.com", time.Now().Add(time.Hour)), http.StatusOK, []byte("This link is invalid")},
+		{"Invalid token", "abc.123.def", http.StatusOK, []byte("This link is invalid")},
+		{"No token", "", http.StatusOK, []byte("Send the email again")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, "/user/verify?token="+url.QueryEscape(tt.token))
+			if code != tt.wantCode {
+				t.Errorf("want %d; got %d", tt.wantCode, code)
+			}
+			if !bytes.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, but got %q", tt.wantBody, body)
+			}
+		})
+	}
+}
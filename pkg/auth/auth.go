@@ -0,0 +1,30 @@
+// Package auth checks passwords at login, against the users table or an LDAP directory.
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// Authenticator checks the password of a user logging in and returns the ID of their local
+// account. Wrong credentials are reported as models.ErrInvalidCredenetials, other errors mean
+// the password couldn't be checked. mysql.UserModel is the Authenticator for local passwords.
+type Authenticator interface {
+	Authenticate(ctx context.Context, login, password string) (int, error)
+}
+
+// Chain tries each Authenticator in turn until one accepts the credentials, e.g. the directory
+// first and then local accounts for users who aren't in it.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(ctx context.Context, login, password string) (int, error) {
+	for _, a := range c {
+		id, err := a.Authenticate(ctx, login, password)
+		if !errors.Is(err, models.ErrInvalidCredenetials) {
+			return id, err
+		}
+	}
+	return 0, models.ErrInvalidCredenetials
+}
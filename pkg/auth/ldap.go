@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// LDAP checks passwords by binding to a directory, like OpenLDAP or Active Directory, as the
+// user. The user's entry is looked up first, with the service account if one is configured.
+//
+// Directory users are linked to the local account with the email address of their entry, or get
+// one if Provision is set. The directory is trusted with the address, it is managed by admins
+// and not by the users themselves.
+type LDAP struct {
+	// URL of the server, ldap://host:389 or ldaps://host:636.
+	URL string
+	// StartTLS upgrades ldap:// connections to TLS before anything is sent.
+	StartTLS  bool
+	TLSConfig *tls.Config
+	// BindDN and BindPassword are the service account searching for users. Without them the
+	// search is made anonymously.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// Filter finds the entry of the user, %s stands for the login they typed, escaped. For
+	// example (&(objectClass=inetOrgPerson)(uid=%s)), or (sAMAccountName=%s) for Active Directory.
+	Filter string
+	// EmailAttribute and NameAttribute map the entry to a local account, mail and cn if empty.
+	EmailAttribute string
+	NameAttribute  string
+	// Timeout bounds connecting and every request to the server.
+	Timeout time.Duration
+	Users   interface {
+		ExternalLogin(context.Context, string, string, string, string, bool) (int, error)
+	}
+	Provision bool
+}
+
+func (l *LDAP) Authenticate(ctx context.Context, login, password string) (int, error) {
+	// an empty password makes a bind unauthenticated, which servers happily accept
+	if login == "" || password == "" {
+		return 0, models.ErrInvalidCredenetials
+	}
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if l.BindDN != "" {
+		err = conn.Bind(l.BindDN, l.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ldap: binding as the service account: %w", err)
+	}
+
+	emailAttribute, nameAttribute := or(l.EmailAttribute, "mail"), or(l.NameAttribute, "cn")
+	// two entries are enough to tell the filter isn't specific enough
+	req := ldap.NewSearchRequest(l.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(l.Timeout.Seconds()), false,
+		strings.ReplaceAll(l.Filter, "%s", ldap.EscapeFilter(login)), []string{emailAttribute, nameAttribute}, nil)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return 0, fmt.Errorf("ldap: searching for the user: %w", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return 0, models.ErrInvalidCredenetials
+	}
+	entry := res.Entries[0]
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return 0, models.ErrInvalidCredenetials
+	} else if err != nil {
+		return 0, fmt.Errorf("ldap: binding as the user: %w", err)
+	}
+
+	email := entry.GetAttributeValue(emailAttribute)
+	if email == "" {
+		return 0, fmt.Errorf("ldap: %s has no %s attribute", entry.DN, emailAttribute)
+	}
+	name := or(entry.GetAttributeValue(nameAttribute), login)
+
+	id, err := l.Users.ExternalLogin(ctx, l.URL, entry.DN, name, email, l.Provision)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		// known to the directory, but not allowed in here
+		return 0, models.ErrInvalidCredenetials
+	}
+	return id, err
+}
+
+func (l *LDAP) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: l.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldap.DialURL(l.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(l.TLSConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: connecting: %w", err)
+	}
+	if l.Timeout > 0 {
+		conn.SetTimeout(l.Timeout)
+	}
+	// the client doesn't take a context, closing the connection is how requests are given up on
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	if l.StartTLS {
+		if err := conn.StartTLS(l.TLSConfig); err != nil {
+			stop()
+			conn.Close()
+			return nil, fmt.Errorf("ldap: starting TLS: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type ldapEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer is just enough of an LDAP server for the tests: simple binds, searches with
+// and, or, not, equality, substring and presence filters, and unbinds, all in the clear.
+// Searching needs a bind with a password first, an empty one is accepted as anonymous like
+// real servers do.
+type testLDAPServer struct {
+	net.Listener
+	entries []ldapEntry
+}
+
+func newTestLDAPServer(t *testing.T, entries ...ldapEntry) *testLDAPServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testLDAPServer{Listener: l, entries: entries}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *testLDAPServer) URL() string {
+	return "ldap://" + s.Addr().String()
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if password == "" {
+				code, bound = ldap.LDAPResultSuccess, false
+			} else if e := s.find(dn); e != nil && e.password == password {
+				code, bound = ldap.LDAPResultSuccess, true
+			} else {
+				bound = false
+			}
+			s.respond(conn, id, ldap.ApplicationBindResponse, code)
+
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				s.respond(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)
+				continue
+			}
+			s.search(conn, id, op)
+
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) search(conn net.Conn, id int64, op *ber.Packet) {
+	baseDN := op.Children[0].Data.String()
+	sizeLimit := int(op.Children[3].Value.(int64))
+	filter := op.Children[6]
+
+	found := 0
+	for _, e := range s.entries {
+		if !strings.HasSuffix(e.dn, baseDN) || !matches(filter, e) {
+			continue
+		}
+		if sizeLimit > 0 && found == sizeLimit {
+			s.respond(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded)
+			return
+		}
+		found++
+		s.sendEntry(conn, id, e)
+	}
+	s.respond(conn, id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)
+}
+
+func (s *testLDAPServer) find(dn string) *ldapEntry {
+	for i := range s.entries {
+		if strings.EqualFold(s.entries[i].dn, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	p.AppendChild(op)
+	return p
+}
+
+func (s *testLDAPServer) respond(conn net.Conn, id int64, tag ber.Tag, code uint16) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	conn.Write(envelope(id, op).Bytes())
+}
+
+func (s *testLDAPServer) sendEntry(conn net.Conn, id int64, e ldapEntry) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	conn.Write(envelope(id, op).Bytes())
+}
+
+func (e ldapEntry) values(attr string) []string {
+	for name, values := range e.attrs {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+func matches(filter *ber.Packet, e ldapEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !matches(f, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, f := range filter.Children {
+			if matches(f, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matches(filter.Children[0], e)
+	case ldap.FilterPresent:
+		return len(e.values(filter.Data.String())) > 0
+	case ldap.FilterEqualityMatch:
+		for _, v := range e.values(filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, v := range e.values(filter.Children[0].Data.String()) {
+			if substringsMatch(strings.ToLower(v), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func substringsMatch(v string, parts []*ber.Packet) bool {
+	for _, part := range parts {
+		s := strings.ToLower(part.Data.String())
+		switch part.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// externalLogins records the users linked by the LDAP authenticator, handing out IDs from 10 on.
+// erin@example.com belongs to a local account which was never verified.
+type externalLogins struct {
+	logins []string
+}
+
+func (u *externalLogins) ExternalLogin(ctx context.Context, issuer, subject, name, email string, provision bool) (int, error) {
+	if email == "erin@example.com" {
+		return 0, models.ErrUnverifiedAccount
+	}
+	if !provision && email != "alice@example.com" {
+		return 0, models.ErrRecordNotFound
+	}
+	u.logins = append(u.logins, strings.Join([]string{subject, name, email}, "|"))
+	return 10 + len(u.logins) - 1, nil
+}
+
+type staticAuthenticator struct {
+	id  int
+	err error
+}
+
+func (a staticAuthenticator) Authenticate(ctx context.Context, login, password string) (int, error) {
+	return a.id, a.err
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	server := newTestLDAPServer(t,
+		ldapEntry{dn: "cn=snipshot,ou=services,dc=example,dc=com", password: "service-pa55"},
+		ldapEntry{dn: "uid=alice,ou=people,dc=example,dc=com", password: "alice-pa55", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"alice"}, "cn": {"Alice Jones"}, "mail": {"alice@example.com"},
+		}},
+		ldapEntry{dn: "uid=bob,ou=people,dc=example,dc=com", password: "bob-pa55", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"bob"}, "mail": {"bob@example.com"},
+		}},
+		ldapEntry{dn: "uid=carol,ou=people,dc=example,dc=com", password: "carol-pa55", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"carol"}, "cn": {"Carol"},
+		}},
+		ldapEntry{dn: "uid=erin,ou=people,dc=example,dc=com", password: "erin-pa55", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"erin"}, "mail": {"erin@example.com"},
+		}},
+	)
+
+	tests := []struct {
+		name         string
+		login        string
+		password     string
+		bindPassword string
+		provision    bool
+		wantID       int
+		wantErr      error
+		wantLogin    string
+	}{
+		{"Valid", "alice", "alice-pa55", "service-pa55", false, 10, nil, "uid=alice,ou=people,dc=example,dc=com|Alice Jones|alice@example.com"},
+		{"Name from login", "bob", "bob-pa55", "service-pa55", true, 10, nil, "uid=bob,ou=people,dc=example,dc=com|bob|bob@example.com"},
+		{"Not provisioned", "bob", "bob-pa55", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+		// someone signed up locally with erin's address, the directory login mustn't take over that account
+		{"Unverified local account", "erin", "erin-pa55", "service-pa55", true, 0, models.ErrUnverifiedAccount, ""},
+		{"Wrong password", "alice", "wrong", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+		{"Empty password", "alice", "", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+		{"Unknown user", "dave", "dave-pa55", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+		{"Filter injection", "ali*", "alice-pa55", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+		{"Filter injection matching everyone", "*", "alice-pa55", "service-pa55", false, 0, models.ErrInvalidCredenetials, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &externalLogins{}
+			l := &LDAP{
+				URL:          server.URL(),
+				BindDN:       "cn=snipshot,ou=services,dc=example,dc=com",
+				BindPassword: tt.bindPassword,
+				BaseDN:       "ou=people,dc=example,dc=com",
+				Filter:       "(&(objectClass=inetOrgPerson)(uid=%s))",
+				Timeout:      5 * time.Second,
+				Users:        users,
+				Provision:    tt.provision,
+			}
+
+			id, err := l.Authenticate(context.Background(), tt.login, tt.password)
+			if !errors.Is(err, tt.wantErr) || id != tt.wantID {
+				t.Errorf("want %d, %v; got %d, %v", tt.wantID, tt.wantErr, id, err)
+			}
+
+			var got string
+			if len(users.logins) > 0 {
+				got = users.logins[0]
+			}
+			if got != tt.wantLogin {
+				t.Errorf("want login %q; got %q", tt.wantLogin, got)
+			}
+		})
+	}
+
+	t.Run("No email", func(t *testing.T) {
+		l := &LDAP{URL: server.URL(), BindDN: "cn=snipshot,ou=services,dc=example,dc=com", BindPassword: "service-pa55",
+			BaseDN: "dc=example,dc=com", Filter: "(uid=%s)", Timeout: 5 * time.Second, Users: &externalLogins{}, Provision: true}
+		if _, err := l.Authenticate(context.Background(), "carol", "carol-pa55"); err == nil || errors.Is(err, models.ErrInvalidCredenetials) {
+			t.Errorf("want an error about the missing attribute; got %v", err)
+		}
+	})
+
+	t.Run("Wrong service password", func(t *testing.T) {
+		l := &LDAP{URL: server.URL(), BindDN: "cn=snipshot,ou=services,dc=example,dc=com", BindPassword: "wrong",
+			BaseDN: "dc=example,dc=com", Filter: "(uid=%s)", Timeout: 5 * time.Second, Users: &externalLogins{}}
+		// a misconfigured server isn't the user's fault
+		if _, err := l.Authenticate(context.Background(), "alice", "alice-pa55"); err == nil || errors.Is(err, models.ErrInvalidCredenetials) {
+			t.Errorf("want a configuration error; got %v", err)
+		}
+	})
+
+	t.Run("Unreachable", func(t *testing.T) {
+		l := &LDAP{URL: "ldap://127.0.0.1:1", Filter: "(uid=%s)", Timeout: time.Second, Users: &externalLogins{}}
+		if _, err := l.Authenticate(context.Background(), "alice", "alice-pa55"); err == nil || errors.Is(err, models.ErrInvalidCredenetials) {
+			t.Errorf("want a connection error; got %v", err)
+		}
+	})
+}
+
+func TestChain(t *testing.T) {
+	failure := errors.New("directory down")
+
+	tests := []struct {
+		name    string
+		chain   Chain
+		wantID  int
+		wantErr error
+	}{
+		{"First accepts", Chain{staticAuthenticator{1, nil}, staticAuthenticator{2, nil}}, 1, nil},
+		{"Falls through", Chain{staticAuthenticator{0, models.ErrInvalidCredenetials}, staticAuthenticator{2, nil}}, 2, nil},
+		{"None accept", Chain{staticAuthenticator{0, models.ErrInvalidCredenetials}, staticAuthenticator{0, models.ErrInvalidCredenetials}}, 0, models.ErrInvalidCredenetials},
+		{"Stops on errors", Chain{staticAuthenticator{0, failure}, staticAuthenticator{2, nil}}, 0, failure},
+		{"Stops on locked accounts", Chain{staticAuthenticator{0, models.ErrAccountLocked}, staticAuthenticator{2, nil}}, 0, models.ErrAccountLocked},
+		{"Empty", Chain{}, 0, models.ErrInvalidCredenetials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.chain.Authenticate(context.Background(), "alice@example.com", "pa55word")
+			if id != tt.wantID || !errors.Is(err, tt.wantErr) {
+				t.Errorf("want %d, %v; got %d, %v", tt.wantID, tt.wantErr, id, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	m := &File{Dir: dir, From: "Snippetbox <no-reply@example.com>"}
+
+	err := m.Send(context.Background(), Message{To: "bob@example.com", Subject: "Hello", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("want 1 message written; got %d", len(files))
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"To: bob@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want message to contain %q; got %q", want, data)
+		}
+	}
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	t.Parallel()
+	m := &File{Dir: t.TempDir()}
+
+	err := m.Send(context.Background(), Message{To: "bob@example.com\r\nBcc: eve@example.com", Subject: "Hello"})
+	if err == nil {
+		t.Error("want an error for a recipient containing a line break")
+	}
+}
+
+// TestSMTP delivers a message to a bare bones SMTP server which records the transaction.
+func TestSMTP(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ready")
+
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				received <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			switch {
+			case inData && line == ".":
+				inData = false
+				reply("250 queued")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				reply("354 go ahead")
+			case strings.HasPrefix(line, "QUIT"):
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+
+	m := &SMTP{Addr: l.Addr().String(), From: "no-reply@example.com"}
+	err = m.Send(context.Background(), Message{To: "bob@example.com", Subject: "Verify", Body: "Click the link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcript := strings.Join(<-received, "\n")
+	for _, want := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<bob@example.com>", "Subject: Verify", "Click the link"} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("want transcript to contain %q; got %q", want, transcript)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// snippetModel is the set of methods SnippetModel wraps, as implemented by mysql.SnippetModel.
+type snippetModel interface {
+	Insert(context.Context, int, int, string, string, string, string, string) (int, error)
+	Get(context.Context, int) (*models.Snippet, error)
+	GetBySlug(context.Context, string) (*models.Snippet, error)
+	Latest(context.Context) ([]*models.Snippet, error)
+	ForUser(context.Context, int) ([]*models.Snippet, error)
+	ForTeam(context.Context, int) ([]*models.Snippet, error)
+	Recent(context.Context, int) ([]*models.Snippet, error)
+	Delete(context.Context, int) error
+	Find(context.Context, int) (*models.Snippet, error)
+	SetHidden(context.Context, int, bool) error
+}
+
+const latestKey = "snippets:latest"
+
+func snippetKey(id int) string {
+	return fmt.Sprintf("snippet:%d", id)
+}
+
+func slugKey(slug string) string {
+	return "snippet:slug:" + slug
+}
+
+func userKey(userID int) string {
+	return fmt.Sprintf("snippets:user:%d", userID)
+}
+
+func teamKey(teamID int) string {
+	return fmt.Sprintf("snippets:team:%d", teamID)
+}
+
+// SnippetModel caches the reads of the wrapped model. Entries live for at most TTL and never past
+// the expiry of the snippets they contain. Writes through the model invalidate the lists they
+// change. The cache is best effort: backend errors are counted and the wrapped model is used
+// instead.
+type SnippetModel struct {
+	Model   snippetModel
+	Backend Backend
+	TTL     time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+// Stats is a snapshot of the cache counters.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Errors uint64
+}
+
+func (m *SnippetModel) Stats() Stats {
+	return Stats{
+		Hits:   m.hits.Load(),
+		Misses: m.misses.Load(),
+		Errors: m.errors.Load(),
+	}
+}
+
+func (m *SnippetModel) Insert(ctx context.Context, userID, teamID int, title, content, language, visibility, expires string) (int, error) {
+	id, err := m.Model.Insert(ctx, userID, teamID, title, content, language, visibility, expires)
+	if err != nil {
+		return 0, err
+	}
+
+	m.invalidate(ctx, latestKey, userKey(userID), teamKey(teamID))
+	return id, nil
+}
+
+// Invalidate drops the cached copy of a snippet and the lists it may appear in. Call it after
+// changing or removing a snippet outside of this model.
+func (m *SnippetModel) Invalidate(ctx context.Context, s *models.Snippet) {
+	m.invalidate(ctx, snippetKey(s.ID), slugKey(s.Slug), latestKey, userKey(s.UserID), teamKey(s.TeamID))
+}
+
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	var s *models.Snippet
+	if m.load(ctx, snippetKey(id), &s) {
+		return s, nil
+	}
+
+	s, err := m.Model.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.store(ctx, snippetKey(id), s, s.Expires)
+	return s, nil
+}
+
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	var s *models.Snippet
+	if m.load(ctx, slugKey(slug), &s) {
+		return s, nil
+	}
+
+	s, err := m.Model.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	m.store(ctx, slugKey(slug), s, s.Expires)
+	return s, nil
+}
+
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	return m.list(ctx, latestKey, m.Model.Latest)
+}
+
+func (m *SnippetModel) ForUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	return m.list(ctx, userKey(userID), func(ctx context.Context) ([]*models.Snippet, error) {
+		return m.Model.ForUser(ctx, userID)
+	})
+}
+
+func (m *SnippetModel) ForTeam(ctx context.Context, teamID int) ([]*models.Snippet, error) {
+	return m.list(ctx, teamKey(teamID), func(ctx context.Context) ([]*models.Snippet, error) {
+		return m.Model.ForTeam(ctx, teamID)
+	})
+}
+
+// Recent isn't cached, it's only used by the admin area which should see what is there right now.
+func (m *SnippetModel) Recent(ctx context.Context, n int) ([]*models.Snippet, error) {
+	return m.Model.Recent(ctx, n)
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	// the owner is looked up first, their list has to go as well. Find, as moderators delete
+	// hidden snippets which Get doesn't return.
+	s, err := m.Model.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Model.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	m.Invalidate(ctx, s)
+	return nil
+}
+
+// Find isn't cached either, moderators should see the snippet as it is.
+func (m *SnippetModel) Find(ctx context.Context, id int) (*models.Snippet, error) {
+	return m.Model.Find(ctx, id)
+}
+
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	// Get doesn't return hidden snippets, Find does
+	s, err := m.Model.Find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := m.Model.SetHidden(ctx, id, hidden); err != nil {
+		return err
+	}
+
+	m.Invalidate(ctx, s)
+	return nil
+}
+
+func (m *SnippetModel) list(ctx context.Context, key string, fetch func(context.Context) ([]*models.Snippet, error)) ([]*models.Snippet, error) {
+	var snippets []*models.Snippet
+	if m.load(ctx, key, &snippets) {
+		return snippets, nil
+	}
+
+	snippets, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the list is stale as soon as its first snippet expires
+	var expires time.Time
+	for _, s := range snippets {
+		if expires.IsZero() || s.Expires.Before(expires) {
+			expires = s.Expires
+		}
+	}
+
+	m.store(ctx, key, snippets, expires)
+	return snippets, nil
+}
+
+// load decodes the entry under key into dst and reports whether there was one.
+func (m *SnippetModel) load(ctx context.Context, key string, dst interface{}) bool {
+	data, ok, err := m.Backend.Get(ctx, key)
+	if err != nil {
+		m.errors.Add(1)
+	}
+	if !ok {
+		m.misses.Add(1)
+		return false
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(dst); err != nil {
+		m.errors.Add(1)
+		m.misses.Add(1)
+		return false
+	}
+
+	m.hits.Add(1)
+	return true
+}
+
+// store caches value for TTL, or until expires if that is sooner. A zero expires means the
+// value doesn't expire by itself.
+func (m *SnippetModel) store(ctx context.Context, key string, value interface{}, expires time.Time) {
+	ttl := m.TTL
+	if !expires.IsZero() {
+		if untilExpiry := time.Until(expires); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		m.errors.Add(1)
+		return
+	}
+
+	if err := m.Backend.Set(ctx, key, buf.Bytes(), ttl); err != nil {
+		m.errors.Add(1)
+	}
+}
+
+func (m *SnippetModel) invalidate(ctx context.Context, keys ...string) {
+	if err := m.Backend.Delete(ctx, keys...); err != nil {
+		m.errors.Add(1)
+	}
+}
@@ -0,0 +1,306 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// countingModel is a stand-in for mysql.SnippetModel which records how often it is hit.
+type countingModel struct {
+	snippets map[int]*models.Snippet
+	calls    int
+}
+
+func (m *countingModel) Insert(ctx context.Context, userID, teamID int, title, content, language, visibility, expires string) (int, error) {
+	id := len(m.snippets) + 1
+	m.snippets[id] = &models.Snippet{ID: id, UserID: userID, TeamID: teamID, Title: title, Content: content, Visibility: visibility, Expires: time.Now().Add(time.Hour)}
+	return id, nil
+}
+
+func (m *countingModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
+	m.calls++
+	s, ok := m.snippets[id]
+	if !ok || s.Hidden {
+		return nil, models.ErrRecordNotFound
+	}
+	return s, nil
+}
+
+func (m *countingModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	m.calls++
+	for _, s := range m.snippets {
+		if s.Slug == slug && !s.Hidden {
+			return s, nil
+		}
+	}
+	return nil, models.ErrRecordNotFound
+}
+
+func (m *countingModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
+	m.calls++
+	var snippets []*models.Snippet
+	for _, s := range m.snippets {
+		if !s.Hidden {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *countingModel) ForUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	m.calls++
+	var snippets []*models.Snippet
+	for _, s := range m.snippets {
+		if s.UserID == userID && !s.Hidden {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *countingModel) ForTeam(ctx context.Context, teamID int) ([]*models.Snippet, error) {
+	m.calls++
+	var snippets []*models.Snippet
+	for _, s := range m.snippets {
+		if s.TeamID == teamID && !s.Hidden {
+			snippets = append(snippets, s)
+		}
+	}
+	return snippets, nil
+}
+
+func (m *countingModel) Recent(ctx context.Context, n int) ([]*models.Snippet, error) {
+	snippets, _ := m.Latest(ctx)
+	if len(snippets) > n {
+		snippets = snippets[:n]
+	}
+	return snippets, nil
+}
+
+func (m *countingModel) Delete(ctx context.Context, id int) error {
+	if _, ok := m.snippets[id]; !ok {
+		return models.ErrRecordNotFound
+	}
+	delete(m.snippets, id)
+	return nil
+}
+
+func (m *countingModel) Find(ctx context.Context, id int) (*models.Snippet, error) {
+	s, ok := m.snippets[id]
+	if !ok {
+		return nil, models.ErrRecordNotFound
+	}
+	return s, nil
+}
+
+func (m *countingModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	s, ok := m.snippets[id]
+	if !ok {
+		return models.ErrRecordNotFound
+	}
+	// a copy, so the cached one can't change along with it
+	hid := *s
+	hid.Hidden = hidden
+	m.snippets[id] = &hid
+	return nil
+}
+
+func newCountingModel() *countingModel {
+	return &countingModel{snippets: map[int]*models.Snippet{
+		1: {ID: 1, Slug: "an-old-silent-pond-k3v9xq2m", UserID: 1, Title: "An old silent pond", Expires: time.Now().Add(time.Hour)},
+		2: {ID: 2, UserID: 1, Title: "Expiring", Expires: time.Now().Add(50 * time.Millisecond)},
+	}}
+}
+
+func TestSnippetModel(t *testing.T) {
+	t.Parallel()
+
+	mr := miniredis.RunT(t)
+
+	backends := []struct {
+		name    string
+		backend Backend
+	}{
+		{"LRU", NewLRU(100)},
+		{"Redis", &Redis{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()}), Prefix: "test:"}},
+	}
+
+	for _, b := range backends {
+		b := b
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			model := newCountingModel()
+			m := &SnippetModel{Model: model, Backend: b.backend, TTL: time.Minute}
+
+			for i := 0; i < 3; i++ {
+				s, err := m.Get(ctx, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.Title != "An old silent pond" || s.UserID != 1 {
+					t.Errorf("want cached snippet to round trip; got %+v", s)
+				}
+			}
+			if model.calls != 1 {
+				t.Errorf("want 1 call to the model; got %d", model.calls)
+			}
+			if stats := m.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+				t.Errorf("want 2 hits and 1 miss; got %+v", stats)
+			}
+
+			if _, err := m.Get(ctx, 3); err != models.ErrRecordNotFound {
+				t.Errorf("want %v; got %v", models.ErrRecordNotFound, err)
+			}
+
+			// looked up by slug it's cached as well, until it's hidden
+			calls := model.calls
+			for i := 0; i < 2; i++ {
+				if s, err := m.GetBySlug(ctx, "an-old-silent-pond-k3v9xq2m"); err != nil || s.ID != 1 {
+					t.Fatalf("want snippet 1 by its slug; got %+v, %v", s, err)
+				}
+			}
+			if model.calls != calls+1 {
+				t.Errorf("want 1 call to the model for the slug; got %d", model.calls-calls)
+			}
+			if err := m.SetHidden(ctx, 1, true); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.GetBySlug(ctx, "an-old-silent-pond-k3v9xq2m"); err != models.ErrRecordNotFound {
+				t.Errorf("want %v by slug once hidden; got %v", models.ErrRecordNotFound, err)
+			}
+			if err := m.SetHidden(ctx, 1, false); err != nil {
+				t.Fatal(err)
+			}
+
+			latest, err := m.Latest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Insert(ctx, 1, 0, "New", "content", "", models.VisibilityPublic, "7"); err != nil {
+				t.Fatal(err)
+			}
+			calls = model.calls
+			fresh, err := m.Latest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if model.calls != calls+1 || len(fresh) != len(latest)+1 {
+				t.Errorf("want Insert to invalidate the latest snippets; got %d snippets after %d", len(fresh), len(latest))
+			}
+
+			if team, _ := m.ForTeam(ctx, 7); len(team) != 0 {
+				t.Fatalf("want no snippets for team 7 yet; got %d", len(team))
+			}
+			if _, err := m.Insert(ctx, 1, 7, "Team", "content", "", models.VisibilityTeam, "7"); err != nil {
+				t.Fatal(err)
+			}
+			if team, _ := m.ForTeam(ctx, 7); len(team) != 1 {
+				t.Errorf("want Insert to invalidate the team's snippets; got %d", len(team))
+			}
+
+			// nor does a hidden one
+			newID := len(latest) + 1
+			if _, err := m.Get(ctx, newID); err != nil {
+				t.Fatal(err)
+			}
+			shown, err := m.Latest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := m.SetHidden(ctx, newID, true); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Get(ctx, newID); err != models.ErrRecordNotFound {
+				t.Errorf("want %v once hidden; got %v", models.ErrRecordNotFound, err)
+			}
+			if hidden, _ := m.Latest(ctx); len(hidden) != len(shown)-1 {
+				t.Errorf("want SetHidden to invalidate the latest snippets; got %d", len(hidden))
+			}
+			if err := m.SetHidden(ctx, newID, false); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Get(ctx, newID); err != nil {
+				t.Errorf("want the snippet back once shown; got %v", err)
+			}
+
+			// a removed snippet doesn't live on in the cache
+			if _, err := m.ForUser(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Delete(ctx, 1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := m.Get(ctx, 1); err != models.ErrRecordNotFound {
+				t.Errorf("want %v after Delete; got %v", models.ErrRecordNotFound, err)
+			}
+			owned, err := m.ForUser(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range owned {
+				if s.ID == 1 {
+					t.Error("want Delete to invalidate the owner's snippets")
+				}
+			}
+
+			// hidden snippets can be deleted too, they're the ones moderators remove
+			if err := m.SetHidden(ctx, newID, true); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Delete(ctx, newID); err != nil {
+				t.Errorf("want a hidden snippet deleted; got %v", err)
+			}
+			if _, err := m.Find(ctx, newID); err != models.ErrRecordNotFound {
+				t.Errorf("want %v after deleting the hidden snippet; got %v", models.ErrRecordNotFound, err)
+			}
+		})
+	}
+}
+
+func TestSnippetModelBoundedByExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	model := newCountingModel()
+	m := &SnippetModel{Model: model, Backend: NewLRU(100), TTL: time.Hour}
+
+	if _, err := m.Get(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := m.Get(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if model.calls != 2 {
+		t.Errorf("want the entry to expire with the snippet; got %d calls to the model", model.calls)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("a"), time.Minute)
+	c.Set(ctx, "b", []byte("b"), time.Minute)
+	c.Get(ctx, "a")
+	c.Set(ctx, "c", []byte("c"), time.Minute)
+
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("want least recently used entry to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := c.Get(ctx, key); !ok {
+			t.Errorf("want %q to still be cached", key)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("want 2 entries; got %d", c.Len())
+	}
+}
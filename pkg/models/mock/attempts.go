@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+var mockLoginAttempt = &models.LoginAttempt{
+	ID:        1,
+	Email:     "alice@example.com",
+	IP:        "192.0.2.1",
+	UserAgent: "Mozilla/5.0",
+	Outcome:   models.LoginFailed,
+	Created:   time.Now(),
+}
+
+// mockSecondFactorAttempt got the password right but not the code
+var mockSecondFactorAttempt = &models.LoginAttempt{
+	ID:        2,
+	Email:     "alice@example.com",
+	IP:        "192.0.2.1",
+	UserAgent: "Mozilla/5.0",
+	Outcome:   models.LoginSecondFactorFailed,
+	Created:   time.Now(),
+}
+
+type LoginAttemptModel struct{}
+
+func (m *LoginAttemptModel) Insert(ctx context.Context, email, ip, userAgent, outcome string) error {
+	return nil
+}
+
+func (m *LoginAttemptModel) ForUser(ctx context.Context, userID, limit int) ([]*models.LoginAttempt, error) {
+	switch userID {
+	case 1:
+		return []*models.LoginAttempt{mockSecondFactorAttempt, mockLoginAttempt}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// PasskeyModel keeps passkeys in memory. Unlike the other mocks it has to remember what was
+// inserted: the keys are generated by the software authenticator in the tests, so they can't be
+// fixed up front.
+type PasskeyModel struct {
+	mu       sync.Mutex
+	passkeys []*models.Passkey
+}
+
+func (m *PasskeyModel) Insert(ctx context.Context, p *models.Passkey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *p
+	stored.Created = time.Now()
+	m.passkeys = append(m.passkeys, &stored)
+	return nil
+}
+
+func (m *PasskeyModel) ForUser(ctx context.Context, userID int) ([]*models.Passkey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	passkeys := []*models.Passkey{}
+	for _, p := range m.passkeys {
+		if p.UserID == userID {
+			copied := *p
+			passkeys = append(passkeys, &copied)
+		}
+	}
+	return passkeys, nil
+}
+
+func (m *PasskeyModel) Use(ctx context.Context, id []byte, signCount uint32, backupState bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.passkeys {
+		if bytes.Equal(p.ID, id) {
+			p.SignCount, p.BackupState, p.LastUsed = signCount, backupState, time.Now()
+		}
+	}
+	return nil
+}
+
+func (m *PasskeyModel) Delete(ctx context.Context, userID int, id []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, p := range m.passkeys {
+		if p.UserID == userID && bytes.Equal(p.ID, id) {
+			m.passkeys = append(m.passkeys[:i], m.passkeys[i+1:]...)
+			return nil
+		}
+	}
+	return models.ErrRecordNotFound
+}
@@ -0,0 +1,28 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type ReportModel struct{}
+
+func (m *ReportModel) Insert(ctx context.Context, snippetID, userID int, reason, details string) (int, error) {
+	return 1, nil
+}
+
+// Queue has mockSnippet reported as spam.
+func (m *ReportModel) Queue(ctx context.Context) ([]*models.ReportedSnippet, error) {
+	return []*models.ReportedSnippet{{
+		Snippet: mockSnippet,
+		Reports: []*models.Report{
+			{ID: 1, SnippetID: mockSnippet.ID, Reason: models.ReportSpam, Details: "Selling pills in the comments", Created: time.Now()},
+		},
+	}}, nil
+}
+
+func (m *ReportModel) Resolve(ctx context.Context, snippetID int) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type PasswordResetModel struct{}
+
+func (m *PasswordResetModel) New(ctx context.Context, email string, ttl time.Duration) (*models.Token, error) {
+	switch email {
+	case "alice@example.com":
+		return &models.Token{
+			Plaintext: "RESETRESETRESETRESETRESETR",
+			UserID:    1,
+			Expires:   time.Now().Add(ttl),
+		}, nil
+	default:
+		return nil, models.ErrRecordNotFound
+	}
+}
+
+func (m *PasswordResetModel) Reset(ctx context.Context, plaintext, password string) error {
+	switch plaintext {
+	case "RESETRESETRESETRESETRESETR":
+		return nil
+	default:
+		return models.ErrRecordNotFound
+	}
+}
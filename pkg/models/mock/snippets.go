@@ -1,6 +1,7 @@
 package mock
 
 import (
+	"context"
 	"time"
 
 	"github.com/vandit1604/snipshot/pkg/models"
@@ -8,29 +9,112 @@ import (
 
 // created a mock snippet to return and use in testing
 var mockSnippet = &models.Snippet{
-	ID:      1,
-	Title:   "Ao Kabhi Haveli Pe",
-	Content: "Ao Kabhi Haveli Pe...",
-	Created: time.Now(),
-	Expires: time.Now(),
+	ID:         1,
+	Slug:       "ao-kabhi-haveli-pe-k3v9xq2m",
+	UserID:     1,
+	Title:      "Ao Kabhi Haveli Pe",
+	Content:    "Ao Kabhi Haveli Pe...",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// mockTeamSnippet is only for the members of mockTeam.
+var mockTeamSnippet = &models.Snippet{
+	ID:         3,
+	Slug:       "deploy-runbook-p7m2x4qa",
+	UserID:     1,
+	TeamID:     1,
+	Title:      "Deploy runbook",
+	Content:    "make deploy",
+	Visibility: models.VisibilityTeam,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+}
+
+// mockHiddenSnippet has been hidden by a moderator.
+var mockHiddenSnippet = &models.Snippet{
+	ID:         4,
+	Slug:       "cheap-pills-w5tn3bcd",
+	UserID:     1,
+	Title:      "Cheap pills",
+	Content:    "buy now",
+	Visibility: models.VisibilityPublic,
+	Created:    time.Now(),
+	Expires:    time.Now(),
+	Hidden:     true,
 }
 
 // created an empty SnippetModel struct to create functions against. It's only use is to encapsulate the functions with itself
 type SnippetModel struct{}
 
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
+func (m *SnippetModel) Insert(ctx context.Context, userID, teamID int, title, content, language, visibility, expires string) (int, error) {
 	return 2, nil
 }
 
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (*models.Snippet, error) {
 	switch id {
 	case 1:
 		return mockSnippet, nil
+	case 3:
+		return mockTeamSnippet, nil
 	default:
 		return nil, models.ErrRecordNotFound
 	}
 }
 
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*models.Snippet, error) {
+	for _, s := range []*models.Snippet{mockSnippet, mockTeamSnippet} {
+		if s.Slug == slug {
+			return s, nil
+		}
+	}
+	return nil, models.ErrRecordNotFound
+}
+
+func (m *SnippetModel) Latest(ctx context.Context) ([]*models.Snippet, error) {
 	return []*models.Snippet{mockSnippet}, nil
 }
+
+func (m *SnippetModel) ForUser(ctx context.Context, userID int) ([]*models.Snippet, error) {
+	switch userID {
+	case 1:
+		return []*models.Snippet{mockSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) ForTeam(ctx context.Context, teamID int) ([]*models.Snippet, error) {
+	switch teamID {
+	case 1:
+		return []*models.Snippet{mockTeamSnippet}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (m *SnippetModel) Recent(ctx context.Context, n int) ([]*models.Snippet, error) {
+	return []*models.Snippet{mockSnippet, mockHiddenSnippet}, nil
+}
+
+func (m *SnippetModel) Find(ctx context.Context, id int) (*models.Snippet, error) {
+	if id == mockHiddenSnippet.ID {
+		return mockHiddenSnippet, nil
+	}
+	return m.Get(ctx, id)
+}
+
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) error {
+	_, err := m.Find(ctx, id)
+	return err
+}
+
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	switch id {
+	case 1:
+		return nil
+	default:
+		return models.ErrRecordNotFound
+	}
+}
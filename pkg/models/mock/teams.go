@@ -0,0 +1,99 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// mockTeam is owned by mockUser and mockResetUser, mockUnverifiedUser is a member.
+var mockTeam = models.Team{
+	ID:      1,
+	Name:    "Platform",
+	Slug:    "platform",
+	Created: time.Now(),
+}
+
+// mockInvitation invites mia@example.com to mockTeam.
+const mockInvitation = "INVITATIONINVITATION"
+
+type TeamModel struct{}
+
+// teamAs returns mockTeam as looked up for a user with the given role.
+func teamAs(role string) *models.Team {
+	t := mockTeam
+	t.Role = role
+	return &t
+}
+
+func (m *TeamModel) Insert(ctx context.Context, userID int, name, slug string) (int, error) {
+	switch slug {
+	case "platform":
+		return 0, models.ErrDuplicateTeam
+	default:
+		return 2, nil
+	}
+}
+
+func (m *TeamModel) Get(ctx context.Context, slug string, userID int) (*models.Team, error) {
+	if slug != mockTeam.Slug {
+		return nil, models.ErrRecordNotFound
+	}
+	role, err := m.Role(ctx, mockTeam.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return teamAs(role), nil
+}
+
+func (m *TeamModel) Role(ctx context.Context, teamID, userID int) (string, error) {
+	switch {
+	case teamID == 1 && userID == 1:
+		return models.TeamOwner, nil
+	case teamID == 1 && userID == 2:
+		return models.TeamMember, nil
+	case teamID == 1 && userID == 3:
+		return models.TeamOwner, nil
+	default:
+		return "", models.ErrRecordNotFound
+	}
+}
+
+func (m *TeamModel) ForUser(ctx context.Context, userID int) ([]*models.Team, error) {
+	role, err := m.Role(ctx, mockTeam.ID, userID)
+	if err != nil {
+		return nil, nil
+	}
+	return []*models.Team{teamAs(role)}, nil
+}
+
+func (m *TeamModel) Members(ctx context.Context, teamID int) ([]*models.Member, error) {
+	return []*models.Member{
+		{UserID: 1, Name: mockUser.Name, Email: mockUser.Email, Role: models.TeamOwner, Joined: time.Now()},
+		{UserID: 2, Name: mockUnverifiedUser.Name, Email: mockUnverifiedUser.Email, Role: models.TeamMember, Joined: time.Now()},
+		{UserID: 3, Name: mockResetUser.Name, Email: mockResetUser.Email, Role: models.TeamOwner, Joined: time.Now()},
+	}, nil
+}
+
+func (m *TeamModel) RemoveMember(ctx context.Context, teamID, userID int) error {
+	role, err := m.Role(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if role == models.TeamOwner {
+		return models.ErrTeamOwner
+	}
+	return nil
+}
+
+func (m *TeamModel) Invite(ctx context.Context, teamID int, email, role string, ttl time.Duration) (*models.Token, error) {
+	return &models.Token{Plaintext: mockInvitation, Expires: time.Now().Add(ttl)}, nil
+}
+
+func (m *TeamModel) Accept(ctx context.Context, plaintext string, userID int, email string) (*models.Team, error) {
+	if plaintext != mockInvitation || email != mockModerator.Email {
+		return nil, models.ErrRecordNotFound
+	}
+	return teamAs(models.TeamMember), nil
+}
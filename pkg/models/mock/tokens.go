@@ -0,0 +1,34 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type TokenModel struct{}
+
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration) (*models.Token, error) {
+	return &models.Token{
+		Plaintext: "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+		UserID:    userID,
+		Expires:   time.Now().Add(ttl),
+	}, nil
+}
+
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (int, error) {
+	switch plaintext {
+	case "ABCDEFGHIJKLMNOPQRSTUVWXYZ":
+		return 1, nil
+	// frank created it before the account was deactivated
+	case "FRANKFRANKFRANKFRANKFRANK":
+		return 6, nil
+	default:
+		return 0, models.ErrInvalidCredenetials
+	}
+}
+
+func (m *TokenModel) DeleteForUser(ctx context.Context, userID int) error {
+	return nil
+}
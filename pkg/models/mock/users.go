@@ -1,21 +1,101 @@
 package mock
 
 import (
+	"context"
 	"time"
 
 	"github.com/vandit1604/snipshot/pkg/models"
 )
 
 var mockUser = &models.User{
-	ID:      0,
-	Name:    "mail",
-	Email:   "mail@mail.mail",
+	ID:       1,
+	Name:     "mail",
+	Email:    "mail@mail.mail",
+	Created:  time.Now(),
+	Verified: true,
+	Role:     models.RoleUser,
+	Active:   true,
+}
+
+var mockUnverifiedUser = &models.User{
+	ID:      2,
+	Name:    "Carol",
+	Email:   "carol@example.com",
 	Created: time.Now(),
+	Role:    models.RoleUser,
+	Active:  true,
+}
+
+// mockResetUser changed their password after any session of theirs was logged in.
+var mockResetUser = &models.User{
+	ID:              3,
+	Name:            "Dave",
+	Email:           "dave@example.com",
+	Created:         time.Now(),
+	Verified:        true,
+	PasswordChanged: time.Now().Add(time.Hour),
+	Role:            models.RoleUser,
+	Active:          true,
+}
+
+// mockTOTPUser has two-factor authentication enabled with mockTOTPSecret.
+var mockTOTPUser = &models.User{
+	ID:          4,
+	Name:        "Erin",
+	Email:       "erin@example.com",
+	Created:     time.Now(),
+	Verified:    true,
+	TOTPEnabled: true,
+	Role:        models.RoleUser,
+	Active:      true,
+}
+
+// mockSSOUser is the user created by the first single sign-on with an unknown address.
+var mockSSOUser = &models.User{
+	ID:       5,
+	Name:     "Olivia",
+	Email:    "olivia@example.com",
+	Created:  time.Now(),
+	Verified: true,
+	Role:     models.RoleUser,
+	Active:   true,
+}
+
+// mockInactiveUser was deactivated by an admin.
+var mockInactiveUser = &models.User{
+	ID:       6,
+	Name:     "Frank",
+	Email:    "frank@example.com",
+	Created:  time.Now(),
+	Verified: true,
+	Role:     models.RoleUser,
+}
+
+var mockModerator = &models.User{
+	ID:       7,
+	Name:     "Mia",
+	Email:    "mia@example.com",
+	Created:  time.Now(),
+	Verified: true,
+	Role:     models.RoleModerator,
+	Active:   true,
+}
+
+var mockAdmin = &models.User{
+	ID:       8,
+	Name:     "Grace",
+	Email:    "grace@example.com",
+	Created:  time.Now(),
+	Verified: true,
+	Role:     models.RoleAdmin,
+	Active:   true,
 }
 
+const mockTOTPSecret = "JBSWY3DPEHPK3PXP"
+
 type UserModel struct{}
 
-func (m *UserModel) Insert(name, email, password string) error {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) error {
 	switch email {
 	case "dupe@example.com":
 		return models.ErrDuplicateEmail
@@ -24,20 +104,155 @@ func (m *UserModel) Insert(name, email, password string) error {
 	}
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	switch email {
 	case "alice@example.com":
 		return 1, nil
+	case mockUser.Email:
+		// the address alice's account has now, which profile changes are confirmed with
+		if password != "validPa$$word" {
+			return 0, models.ErrInvalidCredenetials
+		}
+		return 1, nil
+	case "carol@example.com":
+		return 2, nil
+	case "dave@example.com":
+		return 3, nil
+	case "erin@example.com":
+		return 4, nil
+	case "frank@example.com":
+		return 0, models.ErrAccountInactive
+	case "mia@example.com":
+		return 7, nil
+	case "grace@example.com":
+		return 8, nil
+	case "locked@example.com":
+		return 0, models.ErrAccountLocked
 	default:
 		return 0, models.ErrInvalidCredenetials
 	}
 }
 
-func (m *UserModel) Get(id int) (*models.User, error) {
+func (m *UserModel) Get(ctx context.Context, id int) (*models.User, error) {
 	switch id {
 	case 1:
 		return mockUser, nil
+	case 2:
+		return mockUnverifiedUser, nil
+	case 3:
+		return mockResetUser, nil
+	case 4:
+		return mockTOTPUser, nil
+	case 5:
+		return mockSSOUser, nil
+	case 6:
+		return mockInactiveUser, nil
+	case 7:
+		return mockModerator, nil
+	case 8:
+		return mockAdmin, nil
 	default:
 		return nil, models.ErrRecordNotFound
 	}
 }
+
+func (m *UserModel) Verify(ctx context.Context, email string) error {
+	switch email {
+	case "carol@example.com":
+		return nil
+	default:
+		return models.ErrRecordNotFound
+	}
+}
+
+func (m *UserModel) UpdateProfile(ctx context.Context, id int, name, email string) error {
+	switch email {
+	case "dupe@example.com":
+		return models.ErrDuplicateEmail
+	default:
+		return nil
+	}
+}
+
+func (m *UserModel) ChangePassword(ctx context.Context, id int, current, password string) error {
+	switch current {
+	case "validPa$$word":
+		return nil
+	default:
+		return models.ErrInvalidCredenetials
+	}
+}
+
+func (m *UserModel) EnableTOTP(ctx context.Context, id int, secret string, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *UserModel) DisableTOTP(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *UserModel) TOTPSecret(ctx context.Context, id int) (string, error) {
+	switch id {
+	case 4:
+		return mockTOTPSecret, nil
+	default:
+		return "", models.ErrRecordNotFound
+	}
+}
+
+func (m *UserModel) UseTOTPStep(ctx context.Context, id int, step int64) error {
+	switch id {
+	case 4:
+		return nil
+	default:
+		return models.ErrInvalidCredenetials
+	}
+}
+
+func (m *UserModel) SecondFactorFailed(ctx context.Context, id int) error {
+	return nil
+}
+
+func (m *UserModel) UseRecoveryCode(ctx context.Context, id int, code string) error {
+	switch {
+	case id == 4 && code == "ABCDE-FGHIJ":
+		return nil
+	default:
+		return models.ErrInvalidCredenetials
+	}
+}
+
+func (m *UserModel) ExternalLogin(ctx context.Context, issuer, subject, name, email string, provision bool) (int, error) {
+	switch {
+	case email == "alice@example.com":
+		return 1, nil
+	case email == "carol@example.com":
+		return 0, models.ErrUnverifiedAccount
+	case email == "erin@example.com":
+		return 4, nil
+	case email == "frank@example.com":
+		return 0, models.ErrAccountInactive
+	case provision:
+		return 5, nil
+	default:
+		return 0, models.ErrRecordNotFound
+	}
+}
+
+func (m *UserModel) List(ctx context.Context) ([]*models.User, error) {
+	return []*models.User{mockUser, mockUnverifiedUser, mockResetUser, mockTOTPUser, mockSSOUser, mockInactiveUser, mockModerator, mockAdmin}, nil
+}
+
+func (m *UserModel) SetActive(ctx context.Context, id int, active bool) error {
+	if _, err := m.Get(ctx, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m *UserModel) SetRole(ctx context.Context, id int, role string) error {
+	if _, err := m.Get(ctx, id); err != nil {
+		return err
+	}
+	return nil
+}
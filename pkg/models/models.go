@@ -8,15 +8,112 @@ import (
 var (
 	ErrRecordNotFound      = errors.New("models: no matching record found")
 	ErrDuplicateEmail      = errors.New("models: duplicate email")
+	ErrDuplicateTeam       = errors.New("models: duplicate team")
 	ErrInvalidCredenetials = errors.New("models: invalid credentials")
+	// ErrAccountLocked is returned instead of checking the password while an account is locked
+	// after too many failed logins. Don't tell the user apart from ErrInvalidCredenetials, that
+	// would give away which addresses have an account.
+	ErrAccountLocked = errors.New("models: account temporarily locked")
+	// ErrAccountInactive is returned for the right credentials of an account an admin deactivated.
+	ErrAccountInactive = errors.New("models: account deactivated")
+	// ErrUnverifiedAccount is returned when an external login would be linked to an account whose
+	// email address was never verified. Whoever signed up with it may not own the address.
+	ErrUnverifiedAccount = errors.New("models: account not verified")
+	// ErrTeamOwner is returned when removing an owner from a team. Only members can be removed,
+	// so a team is never left without an owner and owners can't push each other out.
+	ErrTeamOwner = errors.New("models: team owners can't be removed")
+
+	// ErrNoRecord is the name the older code and tests use for ErrRecordNotFound.
+	ErrNoRecord = ErrRecordNotFound
+)
+
+// Outcomes of a login attempt.
+const (
+	LoginSucceeded = "success"
+	LoginFailed    = "failure"
+	LoginLocked    = "locked"
+	// LoginDeactivated is a login with the right credentials to a deactivated account.
+	LoginDeactivated = "deactivated"
+	// LoginSecondFactorFailed is a wrong two-factor or recovery code entered after the right
+	// password.
+	LoginSecondFactorFailed = "second_factor"
+)
+
+// Roles a user can have, each one allowed everything the ones before it are.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists the roles from least to most privileged.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// roleRank orders the roles, unknown ones rank with RoleUser.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return 0
+}
+
+// Who can see a snippet.
+const (
+	VisibilityPublic = "public"
+	// VisibilityTeam snippets are only shown to the members of the team they belong to.
+	VisibilityTeam = "team"
+	// VisibilityPrivate snippets are only shown to their author.
+	VisibilityPrivate = "private"
 )
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
+	ID int `json:"id"`
+	// Slug names the snippet in URLs as well as its ID: its title followed by a random suffix,
+	// e.g. deploy-runbook-k3v9xq2m.
+	Slug   string `json:"slug"`
+	UserID int    `json:"-"`
+	// TeamID is 0 for snippets which don't belong to a team.
+	TeamID     int       `json:"team_id,omitempty"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Language   string    `json:"language,omitempty"`
+	Visibility string    `json:"visibility"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	// Hidden is set by moderators, a hidden snippet is only listed in the admin area.
+	Hidden bool `json:"-"`
+}
+
+// Reasons a snippet can be reported for.
+const (
+	ReportSpam      = "spam"
+	ReportMalware   = "malware"
+	ReportAbuse     = "abuse"
+	ReportPersonal  = "personal"
+	ReportCopyright = "copyright"
+	ReportOther     = "other"
+)
+
+// ReportReasons lists the reasons in the order the report form offers them.
+var ReportReasons = []string{ReportSpam, ReportMalware, ReportAbuse, ReportPersonal, ReportCopyright, ReportOther}
+
+// Report is someone flagging a snippet to the moderators.
+type Report struct {
+	ID        int
+	SnippetID int
+	// UserID is 0 for reports by visitors who weren't logged in.
+	UserID  int
+	Reason  string
+	Details string
 	Created time.Time
-	Expires time.Time
+}
+
+// ReportedSnippet is an entry of the moderation queue, a snippet along with its open reports.
+type ReportedSnippet struct {
+	Snippet *Snippet
+	Reports []*Report
 }
 
 type User struct {
@@ -25,4 +122,107 @@ type User struct {
 	Email          string
 	HashedPassword []byte
 	Created        time.Time
+	// Verified is set once the user has followed the link in the verification email.
+	Verified bool
+	// PasswordChanged is when the password was last reset, sessions logged in before then are
+	// no longer valid. It is zero for users who never changed their password.
+	PasswordChanged time.Time
+	// TOTPEnabled is set for users who log in with a one-time code from an authenticator app as well as their password.
+	TOTPEnabled bool
+	// Role is one of RoleUser, RoleModerator or RoleAdmin.
+	Role string
+	// Active is cleared when an admin deactivates the account, which can't be logged in to then.
+	Active bool
+}
+
+// HasRole reports whether the user has role or one more privileged than it.
+func (u *User) HasRole(role string) bool {
+	return roleRank(u.Role) >= roleRank(role)
+}
+
+// Roles a user can have in a team. Owners manage the members, everybody shares the snippets.
+const (
+	TeamMember = "member"
+	TeamOwner  = "owner"
+)
+
+// Team is an organization whose members share snippets.
+type Team struct {
+	ID      int
+	Name    string
+	Slug    string
+	Created time.Time
+	// Role is that of the user the team was looked up for.
+	Role string
+}
+
+// IsOwner reports whether the user the team was looked up for owns it.
+func (t *Team) IsOwner() bool {
+	return t.Role == TeamOwner
+}
+
+// Member is a user's membership of a team.
+type Member struct {
+	UserID int
+	Name   string
+	Email  string
+	Role   string
+	Joined time.Time
+}
+
+// Token is an API token handed out to command-line clients. Only the hash is
+// stored, the plaintext is shown to the user once when the token is created.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int       `json:"-"`
+	Expires   time.Time `json:"expires"`
+}
+
+// Passkey is a WebAuthn credential a user can log in with instead of their password. The
+// private key never leaves the user's authenticator, only its public key is stored.
+type Passkey struct {
+	ID              []byte
+	UserID          int
+	Name            string
+	PublicKey       []byte
+	AttestationType string
+	// Transports are hints for the browser on how to reach the authenticator, e.g. usb or internal.
+	Transports []string
+	AAGUID     []byte
+	// SignCount is the signature counter of the authenticator as of the last login. Authenticators
+	// which don't keep one always report 0.
+	SignCount      uint32
+	BackupEligible bool
+	BackupState    bool
+	Created        time.Time
+	// LastUsed is zero for passkeys which were never logged in with.
+	LastUsed time.Time
+}
+
+// LoginAttempt is an audit record of a login, kept whether it succeeded or not.
+type LoginAttempt struct {
+	ID        int
+	Email     string
+	IP        string
+	UserAgent string
+	Outcome   string
+	Created   time.Time
+}
+
+// Session is a browser session kept on the server. The cookie only holds a random token, ID is
+// its SHA-256 hash so the stored sessions can't be used to log in.
+type Session struct {
+	ID string
+	// UserID is 0 while nobody is logged in.
+	UserID int
+	// Persistent sessions are the ones the user asked to be remembered. They last longer and
+	// don't time out when idle.
+	Persistent bool
+	Data       []byte
+	IP         string
+	UserAgent  string
+	Created    time.Time
+	LastSeen   time.Time
+	Expires    time.Time
 }
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// Insert records a login attempt. It is linked to the account with the given email when there is
+// one, attempts for unknown addresses are kept too so that they show up when auditing.
+func (m *LoginAttemptModel) Insert(ctx context.Context, email, ip, userAgent, outcome string) (err error) {
+	ctx, end := startSpan(ctx, "LoginAttemptModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	stmt := `INSERT INTO login_attempts (user_id, email, ip, user_agent, outcome, created)
+	VALUES ((SELECT id FROM users WHERE email = ?), ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = m.DB.ExecContext(ctx, stmt, email, email, ip, userAgent, outcome)
+	return err
+}
+
+// ForUser returns the latest login attempts on the user's account, newest first.
+func (m *LoginAttemptModel) ForUser(ctx context.Context, userID, limit int) (_ []*models.LoginAttempt, err error) {
+	ctx, end := startSpan(ctx, "LoginAttemptModel.ForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, email, ip, user_agent, outcome, created FROM login_attempts
+	WHERE user_id = ? ORDER BY created DESC, id DESC LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []*models.LoginAttempt
+	for rows.Next() {
+		a := &models.LoginAttempt{}
+		if err = rows.Scan(&a.ID, &a.Email, &a.IP, &a.UserAgent, &a.Outcome, &a.Created); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
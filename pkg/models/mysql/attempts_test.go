@@ -0,0 +1,45 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestLoginAttemptModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := LoginAttemptModel{DB: db}
+	ctx := context.Background()
+
+	for _, a := range []struct{ email, outcome string }{
+		{"alice@example.com", models.LoginFailed},
+		{"nobody@example.com", models.LoginFailed},
+		{"alice@example.com", models.LoginSucceeded},
+	} {
+		if err := m.Insert(ctx, a.email, "192.0.2.1", "test", a.outcome); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	attempts, err := m.ForUser(ctx, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("want 2 attempts on alice's account; got %d", len(attempts))
+	}
+	if attempts[0].Outcome != models.LoginSucceeded {
+		t.Errorf("want the newest attempt first; got %q", attempts[0].Outcome)
+	}
+	if attempts[1].IP != "192.0.2.1" {
+		t.Errorf("want ip %q; got %q", "192.0.2.1", attempts[1].IP)
+	}
+}
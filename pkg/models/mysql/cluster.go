@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// Cluster is a primary connection pool plus zero or more read replicas. Writes always use
+// Primary; reads are spread round-robin over the replicas currently passing health checks and
+// fall back to Primary when there are none.
+type Cluster struct {
+	Primary  *sql.DB
+	Replicas []*Replica
+
+	next atomic.Uint64
+}
+
+type Replica struct {
+	DB      *sql.DB
+	healthy atomic.Bool
+}
+
+// Healthy reports whether the replica passed its last health check.
+func (r *Replica) Healthy() bool {
+	return r.healthy.Load()
+}
+
+// NewCluster returns a cluster for primary and replicas. Replicas start out healthy.
+func NewCluster(primary *sql.DB, replicas ...*sql.DB) *Cluster {
+	c := &Cluster{Primary: primary}
+	for _, db := range replicas {
+		r := &Replica{DB: db}
+		r.healthy.Store(true)
+		c.Replicas = append(c.Replicas, r)
+	}
+	return c
+}
+
+// Check pings every replica once, taking it out of rotation if the ping fails or takes longer
+// than timeout and putting it back if it succeeds. Run it before using the cluster, so that
+// replicas which are down at startup begin as unhealthy.
+func (c *Cluster) Check(ctx context.Context, timeout time.Duration) {
+	for _, r := range c.Replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		r.healthy.Store(r.DB.PingContext(pingCtx) == nil)
+		cancel()
+	}
+}
+
+// CheckHealth runs Check each interval. It blocks until ctx is done, so run it in its own
+// goroutine.
+func (c *Cluster) CheckHealth(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx, timeout)
+		}
+	}
+}
+
+// reader returns the index of the replica that should serve the next read, or -1 for the primary.
+func (c *Cluster) reader(ctx context.Context) int {
+	if len(c.Replicas) == 0 || readsFromPrimary(ctx) {
+		return -1
+	}
+
+	start := c.next.Add(1)
+	for i := range c.Replicas {
+		idx := int((start + uint64(i)) % uint64(len(c.Replicas)))
+		if c.Replicas[idx].Healthy() {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+type primaryContextKey struct{}
+
+// ReadFromPrimary returns a copy of ctx whose reads skip the replicas. Use it when a request has
+// to see a write that may not have replicated yet.
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey{}, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryContextKey{}).(bool)
+	return primary
+}
@@ -0,0 +1,74 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestClusterReader(t *testing.T) {
+	t.Parallel()
+
+	// sql.Open doesn't connect, so these pools are fine for checking the routing decisions.
+	open := func() *sql.DB {
+		db, err := sql.Open("mysql", "test_web:pass@/test_snippetbox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+
+	ctx := context.Background()
+
+	c := NewCluster(open())
+	if idx := c.reader(ctx); idx != -1 {
+		t.Errorf("want primary without replicas; got replica %d", idx)
+	}
+
+	c = NewCluster(open(), open(), open())
+	seen := map[int]int{}
+	for i := 0; i < 4; i++ {
+		seen[c.reader(ctx)]++
+	}
+	if seen[0] != 2 || seen[1] != 2 {
+		t.Errorf("want reads spread evenly over both replicas; got %v", seen)
+	}
+
+	if idx := c.reader(ReadFromPrimary(ctx)); idx != -1 {
+		t.Errorf("want primary for ReadFromPrimary; got replica %d", idx)
+	}
+
+	c.Replicas[0].healthy.Store(false)
+	for i := 0; i < 3; i++ {
+		if idx := c.reader(ctx); idx != 1 {
+			t.Errorf("want only the healthy replica; got %d", idx)
+		}
+	}
+
+	c.Replicas[1].healthy.Store(false)
+	if idx := c.reader(ctx); idx != -1 {
+		t.Errorf("want primary when no replica is healthy; got replica %d", idx)
+	}
+}
+
+func TestClusterCheck(t *testing.T) {
+	t.Parallel()
+
+	// nothing listens on port 1, so the ping fails straight away
+	down, err := sql.Open("mysql", "test_web:pass@tcp(127.0.0.1:1)/test_snippetbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer down.Close()
+
+	c := NewCluster(down, down)
+	c.Check(context.Background(), time.Second)
+	if c.Replicas[0].Healthy() {
+		t.Error("want an unreachable replica taken out of rotation")
+	}
+	if idx := c.reader(context.Background()); idx != -1 {
+		t.Errorf("want reads from the primary; got replica %d", idx)
+	}
+}
@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// ExternalLogin returns the user an identity from an external provider, like an OpenID Connect
+// issuer, belongs to. An identity seen for the first time is linked to the user with the same
+// email address, which the provider must have verified. Without such a user one is created if
+// provision is set, and ErrRecordNotFound returned otherwise. Deactivated users get
+// ErrAccountInactive.
+//
+// Users who never verified their address get ErrUnverifiedAccount and aren't linked: anyone can
+// sign up with someone else's address, and linking would hand the owner of the address an account
+// whose password the person who signed up still knows. Created users are marked verified, the
+// provider has vouched for the address, and get a random password nobody knows. They log in
+// through the provider or set one with a password reset.
+func (m *UserModel) ExternalLogin(ctx context.Context, issuer, subject, name, email string, provision bool) (_ int, err error) {
+	ctx, end := startSpan(ctx, "UserModel.ExternalLogin")
+	defer func() { end(err) }()
+
+	var hashedPassword []byte
+	if provision {
+		// hashed up front, so bcrypt doesn't run inside the transaction
+		password := make([]byte, 32)
+		if _, err = rand.Read(password); err != nil {
+			return 0, err
+		}
+		if hashedPassword, err = hashPassword(ctx, hex.EncodeToString(password)); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var active bool
+	stmt := `SELECT u.id, u.active FROM user_identities i JOIN users u ON u.id = i.user_id WHERE i.issuer = ? AND i.subject = ?`
+	err = tx.QueryRowContext(ctx, stmt, issuer, subject).Scan(&id, &active)
+	if err == nil {
+		if !active {
+			return 0, models.ErrAccountInactive
+		}
+		return id, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	var verified bool
+	err = tx.QueryRowContext(ctx, `SELECT id, active, verified FROM users WHERE email = ? FOR UPDATE`, email).Scan(&id, &active, &verified)
+	switch {
+	case err == nil && !active:
+		return 0, models.ErrAccountInactive
+	case err == nil && !verified:
+		return 0, models.ErrUnverifiedAccount
+	case err == nil:
+		// a verified user, linked below
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, err
+	case !provision:
+		return 0, models.ErrRecordNotFound
+	default:
+		stmt := `INSERT INTO users (name, email, hashed_password, created, verified) VALUES (?, ?, ?, UTC_TIMESTAMP(), TRUE)`
+		res, err := tx.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+		if err != nil {
+			var mysqlErr *mysql.MySQLError
+			if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+				return 0, models.ErrDuplicateEmail
+			}
+			return 0, err
+		}
+
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		id = int(lastID)
+	}
+
+	stmt = `INSERT INTO user_identities (issuer, subject, user_id, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	if _, err = tx.ExecContext(ctx, stmt, issuer, subject, id); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
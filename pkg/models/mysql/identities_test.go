@@ -0,0 +1,81 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestUserModelExternalLogin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+	const issuer = "https://idp.example.com"
+
+	// the address of an existing user links the identity to them
+	id, err := m.ExternalLogin(ctx, issuer, "alice-sub", "Alice", "alice@example.com", false)
+	if err != nil || id != 1 {
+		t.Fatalf("want user 1 linked; got %d, %v", id, err)
+	}
+
+	// once linked the subject is what counts, even if the address changed at the provider
+	id, err = m.ExternalLogin(ctx, issuer, "alice-sub", "Alice", "alice@corp.example.com", false)
+	if err != nil || id != 1 {
+		t.Errorf("want user 1 by subject; got %d, %v", id, err)
+	}
+
+	if _, err := m.ExternalLogin(ctx, issuer, "bob-sub", "Bob", "bob@example.com", false); err != models.ErrRecordNotFound {
+		t.Errorf("want %v without provisioning; got %v", models.ErrRecordNotFound, err)
+	}
+
+	id, err = m.ExternalLogin(ctx, issuer, "bob-sub", "Bob", "bob@example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "bob@example.com" || user.Name != "Bob" || !user.Verified {
+		t.Errorf("want a verified user for bob@example.com; got %+v", user)
+	}
+
+	// the same subject at another issuer is someone else
+	if _, err := m.ExternalLogin(ctx, "https://other.example.com", "bob-sub", "Bob", "robert@example.com", false); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for another issuer; got %v", models.ErrRecordNotFound, err)
+	}
+
+	// whoever signed up with an address they never verified doesn't get the owner's identity
+	if err := m.Insert(ctx, "Mallory", "carol@example.com", "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ExternalLogin(ctx, issuer, "carol-sub", "Carol", "carol@example.com", true); err != models.ErrUnverifiedAccount {
+		t.Errorf("want %v; got %v", models.ErrUnverifiedAccount, err)
+	}
+	carolID, err := m.Authenticate(ctx, "carol@example.com", "pa55word")
+	if err != nil {
+		t.Fatalf("want the unverified account left alone; got %v", err)
+	}
+	carol, err := m.Get(ctx, carolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carol.Verified {
+		t.Error("want carol@example.com still unverified")
+	}
+
+	// deactivated users don't get in through the provider either
+	if err := m.SetActive(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ExternalLogin(ctx, issuer, "bob-sub", "Bob", "bob@example.com", false); err != models.ErrAccountInactive {
+		t.Errorf("want %v; got %v", models.ErrAccountInactive, err)
+	}
+}
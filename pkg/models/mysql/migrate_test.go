@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("want migration %d to have version %d; got %d (%s)", i, i+1, m.version, m.name)
+		}
+
+		for _, stmt := range m.statements() {
+			if strings.HasPrefix(stmt, "--") || strings.HasSuffix(stmt, ";") {
+				t.Errorf("%s: want comments and terminators stripped; got %q", m.name, stmt)
+			}
+		}
+	}
+
+	if got := len(migrations[0].statements()); got != 2 {
+		t.Errorf("want 2 statements in %s; got %d", migrations[0].name, got)
+	}
+}
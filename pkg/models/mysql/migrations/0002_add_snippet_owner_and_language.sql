@@ -0,0 +1,4 @@
+ALTER TABLE snippets
+ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0 AFTER id,
+ADD COLUMN language VARCHAR(50) NOT NULL DEFAULT '' AFTER content;
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
@@ -0,0 +1,6 @@
+CREATE TABLE tokens (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
@@ -0,0 +1,13 @@
+ALTER TABLE users
+ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN locked_until DATETIME NULL;
+CREATE TABLE login_attempts (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NULL,
+email VARCHAR(255) NOT NULL,
+ip VARCHAR(45) NOT NULL,
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+outcome VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_login_attempts_user_created ON login_attempts(user_id, created);
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- everyone who signed up before verification existed keeps being able to create snippets
+UPDATE users SET verified = TRUE;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN password_changed DATETIME NULL;
+CREATE TABLE password_resets (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+ADD COLUMN totp_secret VARCHAR(64) NULL,
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE recovery_codes (
+user_id INTEGER NOT NULL,
+hash BINARY(32) NOT NULL,
+PRIMARY KEY (user_id, hash)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE passkeys (
+id VARBINARY(255) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+public_key BLOB NOT NULL,
+attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+transports VARCHAR(255) NOT NULL DEFAULT '',
+aaguid VARBINARY(16) NOT NULL,
+sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
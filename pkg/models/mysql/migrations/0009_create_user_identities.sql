@@ -0,0 +1,8 @@
+CREATE TABLE user_identities (
+issuer VARCHAR(255) NOT NULL,
+subject VARCHAR(255) NOT NULL,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE sessions (
+id CHAR(64) NOT NULL PRIMARY KEY,
+user_id INTEGER NULL,
+data BLOB NOT NULL,
+ip VARCHAR(45) NOT NULL DEFAULT '',
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+created DATETIME NOT NULL,
+last_seen DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires ON sessions(expires);
@@ -0,0 +1 @@
+ALTER TABLE sessions ADD COLUMN persistent BOOLEAN NOT NULL DEFAULT FALSE AFTER user_id;
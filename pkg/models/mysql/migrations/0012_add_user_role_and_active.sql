@@ -0,0 +1,4 @@
+-- nobody is an admin to begin with, the first one has to be made by hand with an UPDATE
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,29 @@
+CREATE TABLE teams (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+name VARCHAR(100) NOT NULL,
+slug VARCHAR(50) NOT NULL,
+created DATETIME NOT NULL,
+CONSTRAINT teams_uc_slug UNIQUE (slug)
+);
+CREATE TABLE team_members (
+team_id INTEGER NOT NULL,
+user_id INTEGER NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+CREATE TABLE team_invitations (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+team_id INTEGER NOT NULL,
+email VARCHAR(255) NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_team_invitations_team_id ON team_invitations(team_id);
+-- snippets without a team belong to their author alone, as before
+ALTER TABLE snippets
+ADD COLUMN team_id INTEGER NULL AFTER user_id,
+ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'public';
+CREATE INDEX idx_snippets_team_id ON snippets(team_id);
@@ -0,0 +1,12 @@
+CREATE TABLE reports (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+snippet_id INTEGER NOT NULL,
+user_id INTEGER NULL,
+reason VARCHAR(20) NOT NULL,
+details TEXT NOT NULL,
+created DATETIME NOT NULL,
+resolved DATETIME NULL
+);
+CREATE INDEX idx_reports_snippet_id ON reports(snippet_id);
+-- a hidden snippet is kept for the moderators but shown to nobody else
+ALTER TABLE snippets ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+-- the time step of the last code accepted, so that a code can't be used twice
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NULL;
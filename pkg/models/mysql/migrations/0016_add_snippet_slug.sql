@@ -0,0 +1,5 @@
+-- snippets can be fetched by slug as well as by ID, the existing ones get one made from their ID
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(50) NULL AFTER id;
+UPDATE snippets SET slug = CONCAT('snippet-', id);
+ALTER TABLE snippets MODIFY COLUMN slug VARCHAR(50) NOT NULL;
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/vandit1604/snipshot/pkg/models/mysql")
+
+// withTimeout bounds ctx by the per-query deadline configured on a model. A zero timeout
+// leaves ctx untouched, so the query only stops when the caller's context is done.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// startSpan starts a client span for a model method. Pass the method's error to the returned
+// function when it finishes, typically from a deferred call using a named result. The models
+// errors are expected outcomes, like a wrong password, and don't mark the span as failed.
+func startSpan(ctx context.Context, name string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "mysql")))
+
+	return ctx, func(err error) {
+		if err != nil && !isModelError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func isModelError(err error) bool {
+	return errors.Is(err, models.ErrRecordNotFound) ||
+		errors.Is(err, models.ErrDuplicateEmail) ||
+		errors.Is(err, models.ErrInvalidCredenetials) ||
+		errors.Is(err, models.ErrAccountLocked)
+}
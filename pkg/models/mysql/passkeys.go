@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type PasskeyModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// Insert stores a passkey the user just registered.
+func (m *PasskeyModel) Insert(ctx context.Context, p *models.Passkey) (err error) {
+	ctx, end := startSpan(ctx, "PasskeyModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `INSERT INTO passkeys (id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = m.DB.ExecContext(ctx, stmt, p.ID, p.UserID, p.Name, p.PublicKey, p.AttestationType,
+		strings.Join(p.Transports, ","), p.AAGUID, p.SignCount, p.BackupEligible, p.BackupState)
+	return err
+}
+
+// ForUser returns the passkeys of a user, oldest first.
+func (m *PasskeyModel) ForUser(ctx context.Context, userID int) (_ []*models.Passkey, err error) {
+	ctx, end := startSpan(ctx, "PasskeyModel.ForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id, user_id, name, public_key, attestation_type, transports, aaguid, sign_count, backup_eligible, backup_state, created, last_used
+	FROM passkeys WHERE user_id = ? ORDER BY created, id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	passkeys := []*models.Passkey{}
+	for rows.Next() {
+		p := &models.Passkey{}
+		var transports string
+		var lastUsed sql.NullTime
+		err = rows.Scan(&p.ID, &p.UserID, &p.Name, &p.PublicKey, &p.AttestationType, &transports, &p.AAGUID,
+			&p.SignCount, &p.BackupEligible, &p.BackupState, &p.Created, &lastUsed)
+		if err != nil {
+			return nil, err
+		}
+		if transports != "" {
+			p.Transports = strings.Split(transports, ",")
+		}
+		p.LastUsed = lastUsed.Time
+		passkeys = append(passkeys, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// Use records a login with a passkey, saving the signature counter the authenticator reported.
+func (m *PasskeyModel) Use(ctx context.Context, id []byte, signCount uint32, backupState bool) (err error) {
+	ctx, end := startSpan(ctx, "PasskeyModel.Use")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `UPDATE passkeys SET sign_count = ?, backup_state = ?, last_used = UTC_TIMESTAMP() WHERE id = ?`
+	_, err = m.DB.ExecContext(ctx, stmt, signCount, backupState, id)
+	return err
+}
+
+// Delete removes a passkey of the user. It returns ErrRecordNotFound if the user has no passkey
+// with that ID.
+func (m *PasskeyModel) Delete(ctx context.Context, userID int, id []byte) (err error) {
+	ctx, end := startSpan(ctx, "PasskeyModel.Delete")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `DELETE FROM passkeys WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestPasskeyModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := PasskeyModel{DB: db}
+	ctx := context.Background()
+
+	passkey := &models.Passkey{
+		ID:              []byte{1, 2, 3, 4},
+		UserID:          1,
+		Name:            "Laptop",
+		PublicKey:       []byte{5, 6, 7, 8},
+		AttestationType: "none",
+		Transports:      []string{"internal", "hybrid"},
+		AAGUID:          make([]byte, 16),
+		SignCount:       1,
+		BackupEligible:  true,
+	}
+	if err := m.Insert(ctx, passkey); err != nil {
+		t.Fatal(err)
+	}
+
+	passkeys, err := m.ForUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(passkeys) != 1 {
+		t.Fatalf("want 1 passkey; got %d", len(passkeys))
+	}
+	got := passkeys[0]
+	if !bytes.Equal(got.ID, passkey.ID) || !bytes.Equal(got.PublicKey, passkey.PublicKey) ||
+		!reflect.DeepEqual(got.Transports, passkey.Transports) || !got.BackupEligible || !got.LastUsed.IsZero() {
+		t.Errorf("want %+v; got %+v", passkey, got)
+	}
+
+	if err := m.Use(ctx, passkey.ID, 5, true); err != nil {
+		t.Fatal(err)
+	}
+	passkeys, err = m.ForUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := passkeys[0]; got.SignCount != 5 || !got.BackupState || got.LastUsed.IsZero() {
+		t.Errorf("want the counter, backup state and last use updated; got %+v", got)
+	}
+
+	// users can only remove their own passkeys
+	if err := m.Delete(ctx, 2, passkey.ID); err != models.ErrRecordNotFound {
+		t.Errorf("want %v; got %v", models.ErrRecordNotFound, err)
+	}
+	if err := m.Delete(ctx, 1, passkey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if passkeys, _ := m.ForUser(ctx, 1); len(passkeys) != 0 {
+		t.Errorf("want no passkeys left; got %d", len(passkeys))
+	}
+}
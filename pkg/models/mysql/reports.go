@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// ReportModel keeps the reports people make about snippets for the moderators to act on.
+type ReportModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// Insert records a report about a snippet. A userID of 0 is a report by someone who wasn't
+// logged in.
+func (m *ReportModel) Insert(ctx context.Context, snippetID, userID int, reason, details string) (_ int, err error) {
+	ctx, end := startSpan(ctx, "ReportModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `INSERT INTO reports (snippet_id, user_id, reason, details, created) VALUES (?, NULLIF(?, 0), ?, ?, UTC_TIMESTAMP())`
+	res, err := m.DB.ExecContext(ctx, stmt, snippetID, userID, reason, details)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Queue returns the snippets with open reports, along with those reports. The snippet reported
+// first comes first. Reports of snippets which have been deleted since are left out.
+func (m *ReportModel) Queue(ctx context.Context) (_ []*models.ReportedSnippet, err error) {
+	ctx, end := startSpan(ctx, "ReportModel.Queue")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT r.id, r.snippet_id, IFNULL(r.user_id, 0), r.reason, r.details, r.created,
+	s.id, s.user_id, IFNULL(s.team_id, 0), s.title, s.content, s.language, s.visibility, s.created, s.expires, s.hidden
+	FROM reports r JOIN snippets s ON s.id = r.snippet_id
+	WHERE r.resolved IS NULL ORDER BY r.created, r.id`
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queue []*models.ReportedSnippet
+	bySnippet := map[int]*models.ReportedSnippet{}
+	for rows.Next() {
+		r := &models.Report{}
+		s := &models.Snippet{}
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.UserID, &r.Reason, &r.Details, &r.Created,
+			&s.ID, &s.UserID, &s.TeamID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Created, &s.Expires, &s.Hidden)
+		if err != nil {
+			return nil, err
+		}
+
+		entry, ok := bySnippet[s.ID]
+		if !ok {
+			entry = &models.ReportedSnippet{Snippet: s}
+			bySnippet[s.ID] = entry
+			queue = append(queue, entry)
+		}
+		entry.Reports = append(entry.Reports, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return queue, nil
+}
+
+// Resolve closes the open reports of a snippet once a moderator has dealt with it. The reports
+// are kept, they just leave the queue.
+func (m *ReportModel) Resolve(ctx context.Context, snippetID int) (err error) {
+	ctx, end := startSpan(ctx, "ReportModel.Resolve")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE reports SET resolved = UTC_TIMESTAMP() WHERE snippet_id = ? AND resolved IS NULL`, snippetID)
+	return err
+}
@@ -0,0 +1,70 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestReportModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	snippets, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snippets.Close()
+
+	m := ReportModel{DB: db}
+	ctx := context.Background()
+
+	spam, err := snippets.Insert(ctx, 1, 0, "Cheap pills", "buy now", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := snippets.Insert(ctx, 1, 0, "Leaked", "hunter2", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []struct {
+		snippetID, userID int
+		reason            string
+	}{
+		{spam, 0, models.ReportSpam},
+		{other, 1, models.ReportPersonal},
+		{spam, 1, models.ReportMalware},
+	} {
+		if _, err := m.Insert(ctx, r.snippetID, r.userID, r.reason, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue, err := m.Queue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 2 || queue[0].Snippet.ID != spam || len(queue[0].Reports) != 2 || queue[1].Snippet.ID != other {
+		t.Fatalf("want the spam snippet with 2 reports, then the other one; got %+v", queue)
+	}
+	if r := queue[0].Reports[0]; r.UserID != 0 || r.Reason != models.ReportSpam {
+		t.Errorf("want the anonymous spam report first; got %+v", r)
+	}
+
+	if err := m.Resolve(ctx, spam); err != nil {
+		t.Fatal(err)
+	}
+	if err := snippets.Delete(ctx, other); err != nil {
+		t.Fatal(err)
+	}
+	if queue, err := m.Queue(ctx); err != nil || len(queue) != 0 {
+		t.Errorf("want an empty queue once resolved and deleted; got %v, %v", queue, err)
+	}
+}
@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// PasswordResetModel hands out the tokens mailed to users who forgot their password. Like API
+// tokens only their SHA-256 hash is stored.
+type PasswordResetModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// New creates a reset token for the user with the given email address, valid for ttl. It
+// returns ErrRecordNotFound if there is no such user.
+func (m *PasswordResetModel) New(ctx context.Context, email string, ttl time.Duration) (_ *models.Token, err error) {
+	ctx, end := startSpan(ctx, "PasswordResetModel.New")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var userID int
+	err = m.DB.QueryRowContext(ctx, `SELECT id FROM users WHERE email = ?`, email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `INSERT INTO password_resets (hash, user_id, created, expires) VALUES (?, ?, UTC_TIMESTAMP(), ?)`
+	if _, err = m.DB.ExecContext(ctx, stmt, token.Hash, token.UserID, token.Expires); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Reset sets a new password for the owner of an unexpired reset token. All of the user's reset
+// tokens are used up, their API tokens revoked and the time of the change recorded, which logs
+// out their sessions. It also lifts any lockout. Following the link proves the user controls
+// the address, so the account is marked verified. If it wasn't verified before, whoever
+// registered it may not have been the owner of the address: their passkeys, two-factor secret,
+// recovery codes and sessions are deleted with it. ErrRecordNotFound is returned if the token
+// is unknown, used or expired.
+func (m *PasswordResetModel) Reset(ctx context.Context, plaintext, password string) (err error) {
+	ctx, end := startSpan(ctx, "PasswordResetModel.Reset")
+	defer func() { end(err) }()
+
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	var userID int
+	var verified bool
+	stmt := `SELECT r.user_id, u.verified FROM password_resets r JOIN users u ON u.id = r.user_id
+	WHERE r.hash = ? AND r.expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRowContext(ctx, stmt, hash[:]).Scan(&userID, &verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	stmt = `UPDATE users SET hashed_password = ?, password_changed = UTC_TIMESTAMP(), failed_logins = 0, locked_until = NULL, verified = TRUE WHERE id = ?`
+	if !verified {
+		stmt = `UPDATE users SET hashed_password = ?, password_changed = UTC_TIMESTAMP(), failed_logins = 0, locked_until = NULL, verified = TRUE,
+		totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL WHERE id = ?`
+	}
+	if _, err = tx.ExecContext(ctx, stmt, string(hashedPassword), userID); err != nil {
+		return err
+	}
+
+	if !verified {
+		for _, stmt := range []string{
+			`DELETE FROM passkeys WHERE user_id = ?`,
+			`DELETE FROM recovery_codes WHERE user_id = ?`,
+			`DELETE FROM sessions WHERE user_id = ?`,
+		} {
+			if _, err = tx.ExecContext(ctx, stmt, userID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
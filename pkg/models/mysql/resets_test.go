@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestPasswordResetModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := PasswordResetModel{DB: db}
+	users := UserModel{DB: db}
+	ctx := context.Background()
+
+	if _, err := m.New(ctx, "nobody@example.com", time.Hour); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an unknown address; got %v", models.ErrRecordNotFound, err)
+	}
+
+	expired, err := m.New(ctx, "alice@example.com", -time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(ctx, expired.Plaintext, "newPa$$word1"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an expired token; got %v", models.ErrRecordNotFound, err)
+	}
+
+	token, err := m.New(ctx, "alice@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(ctx, token.Plaintext, "newPa$$word1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := users.Authenticate(ctx, "alice@example.com", "newPa$$word1"); err != nil {
+		t.Errorf("want the new password to work; got %v", err)
+	}
+
+	user, err := users.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PasswordChanged.IsZero() {
+		t.Error("want the time of the change recorded")
+	}
+
+	if err := m.Reset(ctx, token.Plaintext, "otherPa$$word"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v when reusing a token; got %v", models.ErrRecordNotFound, err)
+	}
+}
+
+func TestPasswordResetModelUnverified(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := PasswordResetModel{DB: db}
+	users := UserModel{DB: db}
+	passkeys := PasskeyModel{DB: db}
+	sessions := SessionModel{DB: db}
+	ctx := context.Background()
+
+	// someone registers bob's address before bob does and sets up every way back in
+	if err := users.Insert(ctx, "Bob", "bob@example.com", "squatterPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.EnableTOTP(ctx, 2, "JBSWY3DPEHPK3PXP", []string{"ABCDE-FGHIJ"}); err != nil {
+		t.Fatal(err)
+	}
+	passkey := &models.Passkey{ID: []byte{1, 2, 3, 4}, UserID: 2, Name: "Squatter", PublicKey: []byte{5, 6, 7, 8}, AAGUID: make([]byte, 16)}
+	if err := passkeys.Insert(ctx, passkey); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	session := &models.Session{ID: "squatter", UserID: 2, Data: []byte{1}, Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+	if err := sessions.Insert(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := m.New(ctx, "bob@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(ctx, token.Plaintext, "newPa$$word1"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.Get(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.Verified || user.TOTPEnabled {
+		t.Errorf("want bob verified without two-factor; got %+v", user)
+	}
+	if err := users.UseRecoveryCode(ctx, 2, "ABCDE-FGHIJ"); err != models.ErrInvalidCredenetials {
+		t.Errorf("want the recovery codes gone; got %v", err)
+	}
+	if keys, err := passkeys.ForUser(ctx, 2); err != nil || len(keys) != 0 {
+		t.Errorf("want the passkeys gone; got %d, %v", len(keys), err)
+	}
+	if _, err := sessions.Find(ctx, "squatter"); err != models.ErrRecordNotFound {
+		t.Errorf("want the sessions gone; got %v", err)
+	}
+
+	// a verified account keeps what its owner set up
+	if err := users.EnableTOTP(ctx, 1, "JBSWY3DPEHPK3PXP", []string{"ABCDE-FGHIJ"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err = m.New(ctx, "alice@example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reset(ctx, token.Plaintext, "newPa$$word1"); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := users.Get(ctx, 1); err != nil || !user.TOTPEnabled {
+		t.Errorf("want alice's two-factor kept; got %+v, %v", user, err)
+	}
+}
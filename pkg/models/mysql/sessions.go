@@ -0,0 +1,180 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// SessionModel is the session.Store shared by every instance of the app.
+type SessionModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+const sessionColumns = `id, user_id, persistent, data, ip, user_agent, created, last_seen, expires`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.Session, error) {
+	s := &models.Session{}
+	var userID sql.NullInt64
+	err := row.Scan(&s.ID, &userID, &s.Persistent, &s.Data, &s.IP, &s.UserAgent, &s.Created, &s.LastSeen, &s.Expires)
+	if err != nil {
+		return nil, err
+	}
+	s.UserID = int(userID.Int64)
+	return s, nil
+}
+
+// Find returns an unexpired session, or ErrRecordNotFound.
+func (m *SessionModel) Find(ctx context.Context, id string) (_ *models.Session, err error) {
+	ctx, end := startSpan(ctx, "SessionModel.Find")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ? AND expires > UTC_TIMESTAMP()`
+	s, err := scanSession(m.DB.QueryRowContext(ctx, stmt, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Insert stores a new session.
+func (m *SessionModel) Insert(ctx context.Context, s *models.Session) (err error) {
+	ctx, end := startSpan(ctx, "SessionModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	userID, userAgent := sessionUser(s)
+	stmt := `INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = m.DB.ExecContext(ctx, stmt, s.ID, userID, s.Persistent, s.Data, s.IP, userAgent, s.Created.UTC(), s.LastSeen.UTC(), s.Expires.UTC())
+	return err
+}
+
+// Update changes everything but when the session was created and expires. It returns
+// ErrRecordNotFound for a session which was deleted, it isn't created again.
+func (m *SessionModel) Update(ctx context.Context, s *models.Session) (err error) {
+	ctx, end := startSpan(ctx, "SessionModel.Update")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	userID, userAgent := sessionUser(s)
+	stmt := `UPDATE sessions SET user_id = ?, data = ?, ip = ?, user_agent = ?, last_seen = ? WHERE id = ?`
+	res, err := m.DB.ExecContext(ctx, stmt, userID, s.Data, s.IP, userAgent, s.LastSeen.UTC(), s.ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// MySQL counts changed rows, so nothing changed could also mean the same values again
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, `SELECT TRUE FROM sessions WHERE id = ?`, s.ID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	}
+	return err
+}
+
+// sessionUser returns the user of s as stored, NULL for none, and its user agent cut to fit.
+func sessionUser(s *models.Session) (sql.NullInt64, string) {
+	userAgent := s.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	return sql.NullInt64{Int64: int64(s.UserID), Valid: s.UserID != 0}, userAgent
+}
+
+func (m *SessionModel) Delete(ctx context.Context, id string) (err error) {
+	ctx, end := startSpan(ctx, "SessionModel.Delete")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	return err
+}
+
+// ForUser returns the unexpired sessions of a user, most recently active first.
+func (m *SessionModel) ForUser(ctx context.Context, userID int) (_ []*models.Session, err error) {
+	ctx, end := startSpan(ctx, "SessionModel.ForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT ` + sessionColumns + ` FROM sessions WHERE user_id = ? AND expires > UTC_TIMESTAMP()
+	ORDER BY last_seen DESC, id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteForUser logs a user out everywhere.
+func (m *SessionModel) DeleteForUser(ctx context.Context, userID int) (err error) {
+	ctx, end := startSpan(ctx, "SessionModel.DeleteForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID)
+	return err
+}
+
+// DeleteExpired deletes expired sessions, and those which aren't persistent and weren't active
+// since idleSince unless it's zero.
+func (m *SessionModel) DeleteExpired(ctx context.Context, idleSince time.Time) (err error) {
+	ctx, end := startSpan(ctx, "SessionModel.DeleteExpired")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	if idleSince.IsZero() {
+		_, err = m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expires <= UTC_TIMESTAMP()`)
+		return err
+	}
+
+	stmt := `DELETE FROM sessions WHERE expires <= UTC_TIMESTAMP() OR (persistent = FALSE AND last_seen < ?)`
+	_, err = m.DB.ExecContext(ctx, stmt, idleSince.UTC())
+	return err
+}
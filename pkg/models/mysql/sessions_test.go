@@ -0,0 +1,115 @@
+package mysql
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestSessionModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := SessionModel{DB: db}
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	anonymous := &models.Session{ID: "anonymous", Data: []byte{1}, Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+	laptop := &models.Session{ID: "laptop", UserID: 1, Data: []byte{2}, IP: "192.0.2.1", UserAgent: "Firefox",
+		Created: now, LastSeen: now.Add(-time.Minute), Expires: now.Add(time.Hour)}
+	phone := &models.Session{ID: "phone", UserID: 1, Data: []byte{3}, IP: "192.0.2.2", UserAgent: "Safari",
+		Created: now, LastSeen: now, Expires: now.Add(time.Hour)}
+	expired := &models.Session{ID: "expired", UserID: 1, Data: []byte{4}, Created: now.Add(-2 * time.Hour),
+		LastSeen: now.Add(-2 * time.Hour), Expires: now.Add(-time.Hour)}
+	for _, s := range []*models.Session{anonymous, laptop, phone, expired} {
+		if err := m.Insert(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// updating changes the data and who it belongs to
+	anonymous.UserID, anonymous.Data = 1, []byte{5}
+	if err := m.Update(ctx, anonymous); err != nil {
+		t.Fatal(err)
+	}
+	s, err := m.Find(ctx, "anonymous")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.UserID != 1 || !bytes.Equal(s.Data, []byte{5}) || !s.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("want the updated session; got %+v", s)
+	}
+
+	if _, err := m.Find(ctx, "expired"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an expired session; got %v", models.ErrRecordNotFound, err)
+	}
+
+	sessions, err := m.ForUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, s := range sessions {
+		ids = append(ids, s.ID)
+	}
+	if len(ids) != 3 || ids[2] != "laptop" {
+		t.Errorf("want the unexpired sessions, least recently active last; got %v", ids)
+	}
+
+	if err := m.Delete(ctx, "phone"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Find(ctx, "phone"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v after deleting; got %v", models.ErrRecordNotFound, err)
+	}
+
+	// a request still holding the deleted session doesn't bring it back
+	phone.LastSeen = now.Add(time.Minute)
+	if err := m.Update(ctx, phone); err != models.ErrRecordNotFound {
+		t.Errorf("want %v updating a deleted session; got %v", models.ErrRecordNotFound, err)
+	}
+	if _, err := m.Find(ctx, "phone"); err != models.ErrRecordNotFound {
+		t.Errorf("want the deleted session to stay deleted; got %v", err)
+	}
+
+	// nor is updating with nothing changed taken for a deleted session
+	if err := m.Update(ctx, anonymous); err != nil {
+		t.Errorf("want an unchanged session updated; got %v", err)
+	}
+
+	// laptop was idle for a minute and times out, a remembered session doesn't
+	m.Insert(ctx, &models.Session{ID: "remembered", UserID: 1, Persistent: true, Data: []byte{6},
+		Created: now, LastSeen: now.Add(-time.Minute), Expires: now.Add(time.Hour)})
+	if err := m.DeleteExpired(ctx, now.Add(-30*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	rows, err := db.Query(`SELECT id FROM sessions ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		left = append(left, id)
+	}
+	rows.Close()
+	if !reflect.DeepEqual(left, []string{"anonymous", "remembered"}) {
+		t.Errorf("want the expired and idle sessions deleted; got %v left", left)
+	}
+
+	if err := m.DeleteForUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := m.ForUser(ctx, 1); len(sessions) != 0 {
+		t.Errorf("want no sessions left; got %d", len(sessions))
+	}
+}
@@ -1,25 +1,222 @@
 package mysql
 
 import (
+	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/base32"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/vandit1604/snipshot/pkg/models"
 )
 
 type SnippetModel struct {
-	DB *sql.DB
+	DB *Cluster
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+
+	insertStmt *sql.Stmt
+	deleteStmt *sql.Stmt
+	hideStmt   *sql.Stmt
+	// primary holds the read statements prepared on the primary, replicas the same statements
+	// prepared on each replica, in the order of DB.Replicas. A replica's are nil until they could
+	// be prepared, see reads.
+	primary   *readStmts
+	replicas  []atomic.Pointer[readStmts]
+	prepareMu sync.Mutex
+}
+
+type readStmts struct {
+	get     *sql.Stmt
+	bySlug  *sql.Stmt
+	latest  *sql.Stmt
+	forUser *sql.Stmt
+	forTeam *sql.Stmt
+	recent  *sql.Stmt
+	find    *sql.Stmt
 }
 
-// This will insert a new snippet into the database.
-func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
-	stmt := `INSERT INTO snippets 
-	(title, content, created, expires)
+// NewSnippetModel prepares the statements used by SnippetModel once, up front, so that requests
+// only ever execute them. The insert, delete and hide statements are prepared on the primary and
+// the read statements on the primary and every healthy replica. A replica which is unhealthy or
+// fails to prepare them isn't an error: it is taken out of rotation and its statements are
+// prepared once it's back. Call Close when the model is no longer needed to release the
+// statements on the servers.
+func NewSnippetModel(db *Cluster, timeout time.Duration) (*SnippetModel, error) {
+	m := &SnippetModel{DB: db, Timeout: timeout, replicas: make([]atomic.Pointer[readStmts], len(db.Replicas))}
+
+	var err error
+	m.insertStmt, err = db.Primary.Prepare(`INSERT INTO snippets 
+	(slug, user_id, team_id, title, content, language, visibility, created, expires)
 	VALUES
-	(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
+	(?, ?, NULLIF(?, 0), ?, ?, ?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`)
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := m.DB.Exec(stmt, title, content, expires)
+	m.deleteStmt, err = db.Primary.Prepare(`DELETE FROM snippets WHERE id = ?`)
 	if err != nil {
-		return 0, err
+		m.Close()
+		return nil, err
+	}
+
+	m.hideStmt, err = db.Primary.Prepare(`UPDATE snippets SET hidden = ? WHERE id = ?`)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	m.primary, err = prepareReads(context.Background(), db.Primary)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	for i, r := range db.Replicas {
+		if r.Healthy() {
+			m.prepareReplica(context.Background(), i)
+		}
+	}
+
+	return m, nil
+}
+
+// snippetColumns are the columns scanned into a models.Snippet by scanSnippet.
+const snippetColumns = `id, slug, user_id, IFNULL(team_id, 0), title, content, language, visibility, created, expires, hidden`
+
+func prepareReads(ctx context.Context, db *sql.DB) (*readStmts, error) {
+	s := &readStmts{}
+
+	stmts := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&s.get, `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND id=?`},
+		{&s.bySlug, `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND slug = ?`},
+		// the home page is for everyone, team snippets stay on the team's page
+		{&s.latest, `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND visibility = 'public' ORDER BY created DESC LIMIT 10`},
+		{&s.forUser, `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND user_id = ? ORDER BY created DESC`},
+		{&s.forTeam, `SELECT ` + snippetColumns + ` FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND hidden = FALSE AND team_id = ? AND visibility != 'private' ORDER BY created DESC`},
+		// the admin area sees hidden snippets too
+		{&s.recent, `SELECT ` + snippetColumns + ` FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT ?`},
+		{&s.find, `SELECT ` + snippetColumns + ` FROM snippets WHERE id = ?`},
+	}
+
+	for _, st := range stmts {
+		stmt, err := db.PrepareContext(ctx, st.query)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		*st.dst = stmt
+	}
+
+	return s, nil
+}
+
+func (s *readStmts) close() error {
+	var errs []error
+	for _, stmt := range []*sql.Stmt{s.get, s.bySlug, s.latest, s.forUser, s.forTeam, s.recent, s.find} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close releases the prepared statements.
+func (m *SnippetModel) Close() error {
+	m.prepareMu.Lock()
+	defer m.prepareMu.Unlock()
+
+	var errs []error
+	for _, stmt := range []*sql.Stmt{m.insertStmt, m.deleteStmt, m.hideStmt} {
+		if stmt != nil {
+			errs = append(errs, stmt.Close())
+		}
+	}
+	if m.primary != nil {
+		errs = append(errs, m.primary.close())
+	}
+	for i := range m.replicas {
+		if s := m.replicas[i].Swap(nil); s != nil {
+			errs = append(errs, s.close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reads picks the statements of the server that should serve a read. A replica back in rotation
+// whose statements haven't been prepared yet gets them now; if that fails it is taken out again
+// until its next health check and the primary serves the read.
+func (m *SnippetModel) reads(ctx context.Context) *readStmts {
+	idx := m.DB.reader(ctx)
+	if idx < 0 {
+		return m.primary
+	}
+	if s := m.replicas[idx].Load(); s != nil {
+		return s
+	}
+	if s := m.prepareReplica(ctx, idx); s != nil {
+		return s
+	}
+	return m.primary
+}
+
+// prepareReplica prepares the read statements on replica idx, unless another call did already.
+// On failure the replica is marked unhealthy and nil returned.
+func (m *SnippetModel) prepareReplica(ctx context.Context, idx int) *readStmts {
+	m.prepareMu.Lock()
+	defer m.prepareMu.Unlock()
+
+	if s := m.replicas[idx].Load(); s != nil {
+		return s
+	}
+
+	s, err := prepareReads(ctx, m.DB.Replicas[idx].DB)
+	if err != nil {
+		m.DB.Replicas[idx].healthy.Store(false)
+		return nil
+	}
+	m.replicas[idx].Store(s)
+	return s
+}
+
+// slugAttempts is how often Insert draws a new slug when the one it made is taken already.
+const slugAttempts = 3
+
+// This will insert a new snippet owned by userID into the database. A teamID of 0 means the
+// snippet doesn't belong to a team. The snippet gets a slug made from its title.
+func (m *SnippetModel) Insert(ctx context.Context, userID, teamID int, title, content, language, visibility, expires string) (_ int, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var result sql.Result
+	for i := 0; i < slugAttempts; i++ {
+		slug, err := newSlug(title)
+		if err != nil {
+			return 0, err
+		}
+
+		result, err = m.insertStmt.ExecContext(ctx, slug, userID, teamID, title, content, language, visibility, expires)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 && i < slugAttempts-1 {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		break
 	}
 
 	id, err := result.LastInsertId()
@@ -30,50 +227,235 @@ func (m *SnippetModel) Insert(title, content, expires string) (int, error) {
 	return int(id), nil
 }
 
-// This will return a specific snippet based on its id.
-func (m *SnippetModel) Get(id int) (*models.Snippet, error) {
-	stmt, err := m.DB.Prepare(`SELECT id, title, content,created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id=?`)
-	if err != nil {
+// This will return a specific snippet based on its id. Hidden snippets aren't returned.
+func (m *SnippetModel) Get(ctx context.Context, id int) (_ *models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Get")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	s, err := scanSnippet(m.reads(ctx).get.QueryRowContext(ctx, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
 		return nil, err
 	}
-	rows := stmt.QueryRow(id)
 
-	s := models.Snippet{}
-	err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
-	if err == sql.ErrNoRows {
+	return s, nil
+}
+
+// GetBySlug returns the snippet with the given slug, like Get. It returns ErrRecordNotFound if
+// there is no such snippet or it is hidden.
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (_ *models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.GetBySlug")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	s, err := scanSnippet(m.reads(ctx).bySlug.QueryRowContext(ctx, slug))
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	return &s, nil
+	return s, nil
+}
+
+// This will return the 10 most recently created public snippets which aren't hidden.
+func (m *SnippetModel) Latest(ctx context.Context) (_ []*models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Latest")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.reads(ctx).latest.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnippets(rows)
 }
 
-// This will return the 10 most recently created snippets.
-func (m *SnippetModel) Latest() ([]*models.Snippet, error) {
-	stmt, err := m.DB.Prepare(`SELECT id, title, content,created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() ORDER BY created DESC LIMIT 10`)
+// ForUser returns the unexpired, unhidden snippets owned by userID, newest first.
+func (m *SnippetModel) ForUser(ctx context.Context, userID int) (_ []*models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.ForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.reads(ctx).forUser.QueryContext(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query()
+	defer rows.Close()
+
+	return scanSnippets(rows)
+}
+
+// ForTeam returns the unexpired, unhidden snippets of a team, public and team only ones, newest
+// first. Private snippets stay with their author.
+func (m *SnippetModel) ForTeam(ctx context.Context, teamID int) (_ []*models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.ForTeam")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.reads(ctx).forTeam.QueryContext(ctx, teamID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanSnippets(rows)
+}
+
+// Recent returns up to n unexpired snippets, hidden ones included, newest first, for the admin
+// area.
+func (m *SnippetModel) Recent(ctx context.Context, n int) (_ []*models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Recent")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.reads(ctx).recent.QueryContext(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSnippets(rows)
+}
+
+// Delete removes a snippet for good. It returns ErrRecordNotFound if there is no such snippet.
+func (m *SnippetModel) Delete(ctx context.Context, id int) (err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Delete")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	res, err := m.deleteStmt.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Find returns a snippet whether it's hidden or expired, for moderation. Everything else should
+// use Get. It reads from the primary, as moderators act on what it returns.
+func (m *SnippetModel) Find(ctx context.Context, id int) (_ *models.Snippet, err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.Find")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	s, err := scanSnippet(m.primary.find.QueryRowContext(ctx, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SetHidden hides a snippet from everyone but the moderators, or shows it again. It returns
+// ErrRecordNotFound if there is no such snippet.
+func (m *SnippetModel) SetHidden(ctx context.Context, id int, hidden bool) (err error) {
+	ctx, end := startSpan(ctx, "SnippetModel.SetHidden")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	res, err := m.hideStmt.ExecContext(ctx, hidden, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// nothing changed, either the snippet is already in that state or it doesn't exist
+	_, err = scanSnippet(m.primary.find.QueryRowContext(ctx, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	}
+	return err
+}
+
+func scanSnippets(rows *sql.Rows) ([]*models.Snippet, error) {
 	var snippets []*models.Snippet
 
 	for rows.Next() {
-		var s models.Snippet
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		s, err := scanSnippet(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if rows.Err() != nil {
-			return nil, err
-		}
+		snippets = append(snippets, s)
+	}
 
-		snippets = append(snippets, &s)
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	return snippets, nil
 }
+
+// scanSnippet reads a row of snippetColumns from a *sql.Row or *sql.Rows.
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*models.Snippet, error) {
+	var s models.Snippet
+	err := row.Scan(&s.ID, &s.Slug, &s.UserID, &s.TeamID, &s.Title, &s.Content, &s.Language, &s.Visibility, &s.Created, &s.Expires, &s.Hidden)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+var (
+	slugSeparatorRX = regexp.MustCompile(`[^a-z0-9]+`)
+	slugEncoding    = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+)
+
+// newSlug makes a slug from the first words of title and 8 random characters, which keep it
+// unique and from ever being all digits like an ID.
+func newSlug(title string) (string, error) {
+	words := strings.Trim(slugSeparatorRX.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(words) > 40 {
+		words = strings.TrimRight(words[:40], "-")
+	}
+	if words == "" {
+		words = "snippet"
+	}
+
+	randomBytes := make([]byte, 5)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	return words + "-" + slugEncoding.EncodeToString(randomBytes), nil
+}
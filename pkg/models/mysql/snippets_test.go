@@ -0,0 +1,320 @@
+package mysql
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// BenchmarkSnippetModelGet compares preparing the lookup statement on every call, which is what
+// SnippetModel.Get used to do, with the statement NewSnippetModel prepares once. Run it with
+//
+//	go test ./pkg/models/mysql -run '^$' -bench SnippetModelGet -benchmem
+func BenchmarkSnippetModelGet(b *testing.B) {
+	if testing.Short() {
+		b.Skip("mysql: skipping integration benchmark")
+	}
+
+	db, teardown := newTestDB(b)
+	defer teardown()
+
+	m, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := context.Background()
+	id, err := m.Insert(ctx, 1, 0, "An old silent pond", "An old silent pond...", "", models.VisibilityPublic, "7")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("PreparePerCall", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stmt, err := db.PrepareContext(ctx, `SELECT id, user_id, title, content, language, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id=?`)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var s models.Snippet
+			err = stmt.QueryRowContext(ctx, id).Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &s.Language, &s.Created, &s.Expires)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			// the old code leaked the statement here; closing it keeps the benchmark from hitting max_prepared_stmt_count
+			stmt.Close()
+		}
+	})
+
+	b.Run("PreparedOnce", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := m.Get(ctx, id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSnippetModelReplicaDown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	// the replica is the test database itself, found unhealthy by the startup check
+	cluster := NewCluster(db, db)
+	cluster.Replicas[0].healthy.Store(false)
+
+	m, err := NewSnippetModel(cluster, 3*time.Second)
+	if err != nil {
+		t.Fatalf("want the model without the replica; got %v", err)
+	}
+	defer m.Close()
+	if m.replicas[0].Load() != nil {
+		t.Error("want no statements prepared on the unhealthy replica")
+	}
+
+	ctx := context.Background()
+	id, err := m.Insert(ctx, 1, 0, "An old silent pond", "An old silent pond...", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, id); err != nil {
+		t.Errorf("want the primary to serve reads; got %v", err)
+	}
+
+	// once it passes a health check its statements are prepared on the first read
+	cluster.Replicas[0].healthy.Store(true)
+	if _, err := m.Get(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if m.replicas[0].Load() == nil {
+		t.Error("want the statements prepared on the replica")
+	}
+}
+
+func TestSnippetModelDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := context.Background()
+	id, err := m.Insert(ctx, 1, 0, "An old silent pond", "An old silent pond...", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recent, err := m.Recent(ctx, 10); err != nil || len(recent) != 1 || recent[0].ID != id {
+		t.Fatalf("want the snippet in the recent ones; got %v, %v", recent, err)
+	}
+
+	if err := m.Delete(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, id); err != models.ErrRecordNotFound {
+		t.Errorf("want %v after deleting; got %v", models.ErrRecordNotFound, err)
+	}
+	if err := m.Delete(ctx, id); err != models.ErrRecordNotFound {
+		t.Errorf("want %v deleting twice; got %v", models.ErrRecordNotFound, err)
+	}
+}
+
+func TestSnippetModelHidden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := context.Background()
+	id, err := m.Insert(ctx, 1, 0, "Cheap pills", "buy now", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.SetHidden(ctx, id, true); err != nil {
+		t.Fatal(err)
+	}
+	// hiding twice changes nothing, which isn't an error
+	if err := m.SetHidden(ctx, id, true); err != nil {
+		t.Errorf("want hiding twice to be fine; got %v", err)
+	}
+
+	if _, err := m.Get(ctx, id); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for a hidden snippet; got %v", models.ErrRecordNotFound, err)
+	}
+	if latest, err := m.Latest(ctx); err != nil || len(latest) != 0 {
+		t.Errorf("want no hidden snippets in the latest; got %v, %v", latest, err)
+	}
+	if mine, err := m.ForUser(ctx, 1); err != nil || len(mine) != 0 {
+		t.Errorf("want no hidden snippets in the owner's list; got %v, %v", mine, err)
+	}
+	if s, err := m.Find(ctx, id); err != nil || !s.Hidden {
+		t.Errorf("want Find to return the hidden snippet; got %v, %v", s, err)
+	}
+	if recent, err := m.Recent(ctx, 10); err != nil || len(recent) != 1 || !recent[0].Hidden {
+		t.Errorf("want the hidden snippet in the recent ones; got %v, %v", recent, err)
+	}
+
+	if err := m.SetHidden(ctx, id, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get(ctx, id); err != nil {
+		t.Errorf("want the snippet back once shown; got %v", err)
+	}
+
+	if err := m.SetHidden(ctx, 99, true); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an unknown snippet; got %v", models.ErrRecordNotFound, err)
+	}
+}
+
+func TestSnippetModelSlug(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := context.Background()
+	id, err := m.Insert(ctx, 1, 0, "Deploy runbook", "make deploy", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.Insert(ctx, 1, 0, "Deploy runbook", "make deploy", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s.Slug, "deploy-runbook-") {
+		t.Errorf("want a slug made from the title; got %q", s.Slug)
+	}
+
+	bySlug, err := m.GetBySlug(ctx, s.Slug)
+	if err != nil || bySlug.ID != id {
+		t.Errorf("want snippet %d by its slug; got %+v, %v", id, bySlug, err)
+	}
+	if o, err := m.Get(ctx, other); err != nil || o.Slug == s.Slug {
+		t.Errorf("want another slug for the same title; got %+v, %v", o, err)
+	}
+
+	if err := m.SetHidden(ctx, id, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetBySlug(ctx, s.Slug); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for a hidden snippet; got %v", models.ErrRecordNotFound, err)
+	}
+	if _, err := m.GetBySlug(ctx, "no-such-snippet"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an unknown slug; got %v", models.ErrRecordNotFound, err)
+	}
+}
+
+func TestNewSlug(t *testing.T) {
+	slugRX := regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*-[a-z2-7]{8}$`)
+
+	tests := []struct {
+		name      string
+		title     string
+		wantWords string
+	}{
+		{"Title", "Deploy runbook", "deploy-runbook"},
+		{"Punctuation", "  main.go: (v2)!  ", "main-go-v2"},
+		{"Long title", strings.Repeat("abcdefghi ", 10), "abcdefghi-abcdefghi-abcdefghi-abcdefghi"},
+		{"Non-ASCII", "Ao Kabhi Haveli Pe? नमस्ते", "ao-kabhi-haveli-pe"},
+		{"Nothing usable", "नमस्ते", "snippet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slug, err := newSlug(tt.title)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slugRX.MatchString(slug) || !strings.HasPrefix(slug, tt.wantWords+"-") || len(slug) != len(tt.wantWords)+9 {
+				t.Errorf("want %q and a random suffix; got %q", tt.wantWords, slug)
+			}
+		})
+	}
+}
+
+func TestSnippetModelTeams(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m, err := NewSnippetModel(NewCluster(db), 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	ctx := context.Background()
+	public, err := m.Insert(ctx, 1, 1, "Runbook", "restart it", "", models.VisibilityPublic, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	private, err := m.Insert(ctx, 1, 1, "Secrets", "hunter2", "", models.VisibilityTeam, "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.Get(ctx, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TeamID != 1 || s.Visibility != models.VisibilityTeam {
+		t.Errorf("want a team only snippet of team 1; got %+v", s)
+	}
+
+	latest, err := m.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 1 || latest[0].ID != public {
+		t.Errorf("want only the public snippet on the home page; got %v", latest)
+	}
+
+	team, err := m.ForTeam(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(team) != 2 {
+		t.Errorf("want both snippets for the team; got %d", len(team))
+	}
+}
@@ -0,0 +1,279 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// TeamModel keeps the teams, who is in them and the invitations to join them. Like API tokens
+// only the SHA-256 hash of an invitation is stored.
+type TeamModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// Insert creates a team with userID as its owner. It returns ErrDuplicateTeam if the slug is
+// taken.
+func (m *TeamModel) Insert(ctx context.Context, userID int, name, slug string) (_ int, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Insert")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO teams (name, slug, created) VALUES (?, ?, UTC_TIMESTAMP())`, name, slug)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return 0, models.ErrDuplicateTeam
+		}
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO team_members (team_id, user_id, role, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	if _, err = tx.ExecContext(ctx, stmt, id, userID, models.TeamOwner); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// Get returns the team with the given slug along with the role userID has in it. It returns
+// ErrRecordNotFound when there is no such team or the user isn't a member, so outsiders can't
+// tell the two apart.
+func (m *TeamModel) Get(ctx context.Context, slug string, userID int) (_ *models.Team, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Get")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	t := &models.Team{}
+	stmt := `SELECT t.id, t.name, t.slug, t.created, m.role FROM teams t
+	JOIN team_members m ON m.team_id = t.id WHERE t.slug = ? AND m.user_id = ?`
+	err = m.DB.QueryRowContext(ctx, stmt, slug, userID).Scan(&t.ID, &t.Name, &t.Slug, &t.Created, &t.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Role returns the role userID has in the team, ErrRecordNotFound if they aren't a member.
+func (m *TeamModel) Role(ctx context.Context, teamID, userID int) (_ string, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Role")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var role string
+	err = m.DB.QueryRowContext(ctx, `SELECT role FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", models.ErrRecordNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
+// ForUser returns the teams userID is a member of, by name.
+func (m *TeamModel) ForUser(ctx context.Context, userID int) (_ []*models.Team, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.ForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT t.id, t.name, t.slug, t.created, m.role FROM teams t
+	JOIN team_members m ON m.team_id = t.id WHERE m.user_id = ? ORDER BY t.name`
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []*models.Team
+	for rows.Next() {
+		t := &models.Team{}
+		if err := rows.Scan(&t.ID, &t.Name, &t.Slug, &t.Created, &t.Role); err != nil {
+			return nil, err
+		}
+		teams = append(teams, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// Members returns the members of a team, owners first.
+func (m *TeamModel) Members(ctx context.Context, teamID int) (_ []*models.Member, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Members")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT u.id, u.name, u.email, m.role, m.created FROM team_members m
+	JOIN users u ON u.id = m.user_id WHERE m.team_id = ? ORDER BY m.role = ? DESC, u.name`
+	rows, err := m.DB.QueryContext(ctx, stmt, teamID, models.TeamOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.Member
+	for rows.Next() {
+		mb := &models.Member{}
+		if err := rows.Scan(&mb.UserID, &mb.Name, &mb.Email, &mb.Role, &mb.Joined); err != nil {
+			return nil, err
+		}
+		members = append(members, mb)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// RemoveMember takes userID out of the team. Only members can be removed, it returns
+// ErrTeamOwner for an owner and ErrRecordNotFound if they weren't in the team.
+func (m *TeamModel) RemoveMember(ctx context.Context, teamID, userID int) (err error) {
+	ctx, end := startSpan(ctx, "TeamModel.RemoveMember")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `DELETE FROM team_members WHERE team_id = ? AND user_id = ? AND role = ?`
+	res, err := m.DB.ExecContext(ctx, stmt, teamID, userID, models.TeamMember)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	var role string
+	err = m.DB.QueryRowContext(ctx, `SELECT role FROM team_members WHERE team_id = ? AND user_id = ?`, teamID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return models.ErrTeamOwner
+}
+
+// Invite creates an invitation for email to join the team with the given role, valid for ttl.
+// Only the user with that address can accept it.
+func (m *TeamModel) Invite(ctx context.Context, teamID int, email, role string, ttl time.Duration) (_ *models.Token, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Invite")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	token, err := generateToken(0, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `INSERT INTO team_invitations (hash, team_id, email, role, created, expires) VALUES (?, ?, ?, ?, UTC_TIMESTAMP(), ?)`
+	if _, err = m.DB.ExecContext(ctx, stmt, token.Hash, teamID, email, role, token.Expires); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Accept makes userID a member of the team an unexpired invitation is for, and returns the
+// team. The invitation must have been sent to email, the user's address, and is used up. A user
+// who is a member already keeps the role they have. ErrRecordNotFound is returned if the
+// invitation is unknown, used, expired or for someone else.
+func (m *TeamModel) Accept(ctx context.Context, plaintext string, userID int, email string) (_ *models.Team, err error) {
+	ctx, end := startSpan(ctx, "TeamModel.Accept")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	var teamID int
+	var invited, role string
+	stmt := `SELECT team_id, email, role FROM team_invitations WHERE hash = ? AND expires > UTC_TIMESTAMP() FOR UPDATE`
+	err = tx.QueryRowContext(ctx, stmt, hash[:]).Scan(&teamID, &invited, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(invited, email) {
+		return nil, models.ErrRecordNotFound
+	}
+
+	stmt = `INSERT IGNORE INTO team_members (team_id, user_id, role, created) VALUES (?, ?, ?, UTC_TIMESTAMP())`
+	if _, err = tx.ExecContext(ctx, stmt, teamID, userID, role); err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM team_invitations WHERE hash = ?`, hash[:]); err != nil {
+		return nil, err
+	}
+
+	t := &models.Team{}
+	stmt = `SELECT t.id, t.name, t.slug, t.created, m.role FROM teams t
+	JOIN team_members m ON m.team_id = t.id WHERE t.id = ? AND m.user_id = ?`
+	if err = tx.QueryRowContext(ctx, stmt, teamID, userID).Scan(&t.ID, &t.Name, &t.Slug, &t.Created, &t.Role); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
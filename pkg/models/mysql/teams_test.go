@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestTeamModel(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	users := UserModel{DB: db}
+	m := TeamModel{DB: db}
+	ctx := context.Background()
+
+	if err := users.Insert(ctx, "Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	teamID, err := m.Insert(ctx, 1, "Platform", "platform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Insert(ctx, 2, "Platform too", "platform"); err != models.ErrDuplicateTeam {
+		t.Errorf("want %v; got %v", models.ErrDuplicateTeam, err)
+	}
+
+	team, err := m.Get(ctx, "platform", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.ID != teamID || team.Name != "Platform" || !team.IsOwner() {
+		t.Errorf("want alice owning Platform; got %+v", team)
+	}
+	// to outsiders the team doesn't exist
+	if _, err := m.Get(ctx, "platform", 2); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for a non-member; got %v", models.ErrRecordNotFound, err)
+	}
+
+	token, err := m.Invite(ctx, teamID, "bob@example.com", models.TeamMember, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only bob can accept it
+	if _, err := m.Accept(ctx, token.Plaintext, 1, "alice@example.com"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for someone else; got %v", models.ErrRecordNotFound, err)
+	}
+	team, err = m.Accept(ctx, token.Plaintext, 2, "Bob@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.ID != teamID || team.Role != models.TeamMember {
+		t.Errorf("want bob a member of Platform; got %+v", team)
+	}
+	if _, err := m.Accept(ctx, token.Plaintext, 2, "bob@example.com"); err != models.ErrRecordNotFound {
+		t.Errorf("want invitations single-use; got %v", err)
+	}
+
+	expired, err := m.Invite(ctx, teamID, "carol@example.com", models.TeamMember, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Accept(ctx, expired.Plaintext, 3, "carol@example.com"); err != models.ErrRecordNotFound {
+		t.Errorf("want %v for an expired invitation; got %v", models.ErrRecordNotFound, err)
+	}
+
+	members, err := m.Members(ctx, teamID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].UserID != 1 || members[1].Email != "bob@example.com" {
+		t.Errorf("want the owner alice, then bob; got %+v", members)
+	}
+
+	teams, err := m.ForUser(ctx, 2)
+	if err != nil || len(teams) != 1 || teams[0].Slug != "platform" {
+		t.Errorf("want bob's team; got %v, %v", teams, err)
+	}
+
+	if err := m.RemoveMember(ctx, teamID, 1); err != models.ErrTeamOwner {
+		t.Errorf("want %v removing the owner; got %v", models.ErrTeamOwner, err)
+	}
+	if role, err := m.Role(ctx, teamID, 1); err != nil || role != models.TeamOwner {
+		t.Errorf("want alice still the owner; got %q, %v", role, err)
+	}
+
+	if err := m.RemoveMember(ctx, teamID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Role(ctx, teamID, 2); err != models.ErrRecordNotFound {
+		t.Errorf("want %v after removing; got %v", models.ErrRecordNotFound, err)
+	}
+	if err := m.RemoveMember(ctx, teamID, 2); err != models.ErrRecordNotFound {
+		t.Errorf("want %v removing twice; got %v", models.ErrRecordNotFound, err)
+	}
+}
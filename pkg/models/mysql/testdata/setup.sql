@@ -1,21 +1,139 @@
 CREATE TABLE snippets (
 id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+slug VARCHAR(50) NOT NULL,
+user_id INTEGER NOT NULL DEFAULT 0,
+team_id INTEGER NULL,
 title VARCHAR(100) NOT NULL,
-content TEXT NOT NULL,created DATETIME NOT NULL,
-expires DATETIME NOT NULL
+content TEXT NOT NULL,
+language VARCHAR(50) NOT NULL DEFAULT '',
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL,
+visibility VARCHAR(20) NOT NULL DEFAULT 'public',
+hidden BOOLEAN NOT NULL DEFAULT FALSE
 );
+ALTER TABLE snippets ADD CONSTRAINT snippets_uc_slug UNIQUE (slug);
 CREATE INDEX idx_snippets_created ON snippets(created);
+CREATE INDEX idx_snippets_user_id ON snippets(user_id);
+CREATE INDEX idx_snippets_team_id ON snippets(team_id);
 CREATE TABLE users (
 id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
 name VARCHAR(255) NOT NULL,
 email VARCHAR(255) NOT NULL,
 hashed_password CHAR(60) NOT NULL,
-created DATETIME NOT NULL
+created DATETIME NOT NULL,
+failed_logins INTEGER NOT NULL DEFAULT 0,
+locked_until DATETIME NULL,
+verified BOOLEAN NOT NULL DEFAULT FALSE,
+password_changed DATETIME NULL,
+totp_secret VARCHAR(64) NULL,
+totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+totp_last_step BIGINT NULL,
+role VARCHAR(20) NOT NULL DEFAULT 'user',
+active BOOLEAN NOT NULL DEFAULT TRUE
 );
 ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
-INSERT INTO users (name, email, hashed_password, created) VALUES (
+CREATE TABLE tokens (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE TABLE recovery_codes (
+user_id INTEGER NOT NULL,
+hash BINARY(32) NOT NULL,
+PRIMARY KEY (user_id, hash)
+);
+CREATE TABLE passkeys (
+id VARBINARY(255) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+name VARCHAR(100) NOT NULL,
+public_key BLOB NOT NULL,
+attestation_type VARCHAR(32) NOT NULL DEFAULT '',
+transports VARCHAR(255) NOT NULL DEFAULT '',
+aaguid VARBINARY(16) NOT NULL,
+sign_count INTEGER UNSIGNED NOT NULL DEFAULT 0,
+backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+created DATETIME NOT NULL,
+last_used DATETIME NULL
+);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
+CREATE TABLE user_identities (
+issuer VARCHAR(255) NOT NULL,
+subject VARCHAR(255) NOT NULL,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE TABLE sessions (
+id CHAR(64) NOT NULL PRIMARY KEY,
+user_id INTEGER NULL,
+persistent BOOLEAN NOT NULL DEFAULT FALSE,
+data BLOB NOT NULL,
+ip VARCHAR(45) NOT NULL DEFAULT '',
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+created DATETIME NOT NULL,
+last_seen DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires ON sessions(expires);
+CREATE TABLE teams (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+name VARCHAR(100) NOT NULL,
+slug VARCHAR(50) NOT NULL,
+created DATETIME NOT NULL,
+CONSTRAINT teams_uc_slug UNIQUE (slug)
+);
+CREATE TABLE team_members (
+team_id INTEGER NOT NULL,
+user_id INTEGER NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+PRIMARY KEY (team_id, user_id)
+);
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+CREATE TABLE team_invitations (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+team_id INTEGER NOT NULL,
+email VARCHAR(255) NOT NULL,
+role VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_team_invitations_team_id ON team_invitations(team_id);
+CREATE TABLE reports (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+snippet_id INTEGER NOT NULL,
+user_id INTEGER NULL,
+reason VARCHAR(20) NOT NULL,
+details TEXT NOT NULL,
+created DATETIME NOT NULL,
+resolved DATETIME NULL
+);
+CREATE INDEX idx_reports_snippet_id ON reports(snippet_id);
+CREATE TABLE password_resets (
+hash BINARY(32) NOT NULL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+created DATETIME NOT NULL,
+expires DATETIME NOT NULL
+);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+CREATE TABLE login_attempts (
+id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+user_id INTEGER NULL,
+email VARCHAR(255) NOT NULL,
+ip VARCHAR(45) NOT NULL,
+user_agent VARCHAR(255) NOT NULL DEFAULT '',
+outcome VARCHAR(20) NOT NULL,
+created DATETIME NOT NULL
+);
+CREATE INDEX idx_login_attempts_user_created ON login_attempts(user_id, created);
+INSERT INTO users (name, email, hashed_password, created, verified) VALUES (
 'Alice Jones',
 'alice@example.com',
 '$2a$12$NuTjWXm3KKntReFwyBVHyuf/to.HEwTy.eS206TNfkGfr6HzGJSWG',
-'2018-12-23 17:25:22'
+'2018-12-23 17:25:22',
+TRUE
 );
@@ -1,2 +1,13 @@
+DROP TABLE reports;
+DROP TABLE team_invitations;
+DROP TABLE team_members;
+DROP TABLE teams;
+DROP TABLE sessions;
+DROP TABLE user_identities;
+DROP TABLE passkeys;
+DROP TABLE recovery_codes;
+DROP TABLE password_resets;
+DROP TABLE login_attempts;
+DROP TABLE tokens;
 DROP TABLE users;
 DROP TABLE snippets;
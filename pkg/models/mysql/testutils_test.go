@@ -6,7 +6,7 @@ import (
 	"testing"
 )
 
-func newTestDB(t *testing.T) (*sql.DB, func()) {
+func newTestDB(t testing.TB) (*sql.DB, func()) {
 	// Establish a sql.DB connection pool for our test database. Because our setup and teardown
 	// scripts contains multiple SQL statements, we need to use the 'multiStatements=true' parameter
 	// in our DSN. This instructs our MySQL database driver to support executing multiple SQL
@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+type TokenModel struct {
+	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+}
+
+// New generates a random API token for userID which is valid for ttl. Only the
+// SHA-256 hash of the token is written to the database.
+func (m *TokenModel) New(ctx context.Context, userID int, ttl time.Duration) (_ *models.Token, err error) {
+	ctx, end := startSpan(ctx, "TokenModel.New")
+	defer func() { end(err) }()
+
+	token, err := generateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `INSERT INTO tokens (hash, user_id, created, expires) VALUES (?, ?, UTC_TIMESTAMP(), ?)`
+
+	_, err = m.DB.ExecContext(ctx, stmt, token.Hash, token.UserID, token.Expires)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Authenticate looks up the user owning an unexpired token. It returns
+// ErrInvalidCredenetials if the token is unknown or has expired.
+func (m *TokenModel) Authenticate(ctx context.Context, plaintext string) (_ int, err error) {
+	ctx, end := startSpan(ctx, "TokenModel.Authenticate")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	var userID int
+	stmt := `SELECT user_id FROM tokens WHERE hash = ? AND expires > UTC_TIMESTAMP()`
+	err = m.DB.QueryRowContext(ctx, stmt, hash[:]).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, models.ErrInvalidCredenetials
+		}
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// DeleteForUser revokes every API token of a user.
+func (m *TokenModel) DeleteForUser(ctx context.Context, userID int) (err error) {
+	ctx, end := startSpan(ctx, "TokenModel.DeleteForUser")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ?`, userID)
+	return err
+}
+
+// generateToken makes a random token for userID along with the SHA-256 hash that gets stored in
+// its place.
+func generateToken(userID int, ttl time.Duration) (*models.Token, error) {
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	token := &models.Token{
+		Plaintext: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes),
+		UserID:    userID,
+		Expires:   time.Now().UTC().Add(ttl).Truncate(time.Second),
+	}
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
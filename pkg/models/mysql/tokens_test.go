@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestTokenModelDeleteForUser(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := TokenModel{DB: db}
+	ctx := context.Background()
+
+	alice, err := m.New(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.New(ctx, 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.DeleteForUser(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Authenticate(ctx, alice.Plaintext); err != models.ErrInvalidCredenetials {
+		t.Errorf("want %v for a revoked token; got %v", models.ErrInvalidCredenetials, err)
+	}
+	if userID, err := m.Authenticate(ctx, other.Plaintext); err != nil || userID != 2 {
+		t.Errorf("want the other user's token kept; got %d, %v", userID, err)
+	}
+}
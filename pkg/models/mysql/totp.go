@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// EnableTOTP turns on two-factor authentication for the user with the given TOTP secret. The
+// recovery codes replace any the user had, only their SHA-256 hashes are stored: they are
+// random enough that a slow hash isn't needed.
+func (m *UserModel) EnableTOTP(ctx context.Context, id int, secret string, recoveryCodes []string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.EnableTOTP")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users SET totp_secret = ?, totp_enabled = TRUE, totp_last_step = NULL WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, stmt, secret, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+
+	for _, code := range recoveryCodes {
+		hash := hashRecoveryCode(code)
+		if _, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, id, hash[:]); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP turns two-factor authentication off, dropping the secret and recovery codes.
+func (m *UserModel) DisableTOTP(ctx context.Context, id int) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.DisableTOTP")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, stmt, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TOTPSecret returns the secret codes of the user are checked against. It returns
+// ErrRecordNotFound if the user doesn't have two-factor authentication enabled, and
+// ErrAccountLocked while the account is locked after too many wrong passwords or codes.
+func (m *UserModel) TOTPSecret(ctx context.Context, id int) (_ string, err error) {
+	ctx, end := startSpan(ctx, "UserModel.TOTPSecret")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var secret string
+	var lockedUntil sql.NullTime
+	stmt := `SELECT totp_secret, locked_until FROM users WHERE id = ? AND totp_enabled`
+	err = m.DB.QueryRowContext(ctx, stmt, id).Scan(&secret, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", models.ErrRecordNotFound
+	} else if err != nil {
+		return "", err
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now().UTC()) {
+		return "", models.ErrAccountLocked
+	}
+
+	return secret, nil
+}
+
+// UseTOTPStep records that the user logged in with the code of a time step, which resets their
+// failed logins. A code can't be used twice: ErrInvalidCredenetials is returned for a step
+// which isn't later than the last one used.
+func (m *UserModel) UseTOTPStep(ctx context.Context, id int, step int64) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.UseTOTPStep")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `UPDATE users SET totp_last_step = ?, failed_logins = 0, locked_until = NULL
+	WHERE id = ? AND totp_enabled AND (totp_last_step IS NULL OR totp_last_step < ?)`
+	res, err := m.DB.ExecContext(ctx, stmt, step, id, step)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredenetials
+	}
+
+	return nil
+}
+
+// UseRecoveryCode checks a recovery code of the user and uses it up, which resets their failed
+// logins. It returns ErrInvalidCredenetials if the code is unknown or has been used already, and
+// ErrAccountLocked while the account is locked.
+func (m *UserModel) UseRecoveryCode(ctx context.Context, id int, code string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.UseRecoveryCode")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var lockedUntil sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT locked_until FROM users WHERE id = ? FOR UPDATE`, id).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrInvalidCredenetials
+	} else if err != nil {
+		return err
+	}
+	if lockedUntil.Valid && lockedUntil.Time.After(time.Now().UTC()) {
+		return models.ErrAccountLocked
+	}
+
+	hash := hashRecoveryCode(code)
+	res, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`, id, hash[:])
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrInvalidCredenetials
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SecondFactorFailed counts a wrong two-factor code against the account like a wrong password,
+// so codes can't be guessed from many addresses at once.
+func (m *UserModel) SecondFactorFailed(ctx context.Context, id int) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.SecondFactorFailed")
+	defer func() { end(err) }()
+
+	queryCtx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var failures int
+	err = m.DB.QueryRowContext(queryCtx, `SELECT failed_logins FROM users WHERE id = ?`, id).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return m.countFailure(ctx, id, failures, time.Now().UTC())
+}
+
+// hashRecoveryCode ignores case and dashes, which users may or may not type.
+func hashRecoveryCode(code string) [32]byte {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return sha256.Sum256([]byte(code))
+}
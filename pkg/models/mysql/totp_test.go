@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+func TestUserModelTOTP(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+
+	if _, err := m.TOTPSecret(ctx, 1); err != models.ErrRecordNotFound {
+		t.Errorf("want %v before enabling; got %v", models.ErrRecordNotFound, err)
+	}
+
+	if err := m.EnableTOTP(ctx, 1, "JBSWY3DPEHPK3PXP", []string{"ABCDE-FGHIJ", "KLMNO-PQRST"}); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := m.TOTPSecret(ctx, 1)
+	if err != nil || secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("want %q; got %q, %v", "JBSWY3DPEHPK3PXP", secret, err)
+	}
+
+	user, err := m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.TOTPEnabled {
+		t.Error("want TOTPEnabled set")
+	}
+
+	// codes work once, typed in any case and with or without the dash
+	if err := m.UseRecoveryCode(ctx, 1, "abcdefghij"); err != nil {
+		t.Errorf("want nil; got %v", err)
+	}
+	if err := m.UseRecoveryCode(ctx, 1, "ABCDE-FGHIJ"); err != models.ErrInvalidCredenetials {
+		t.Errorf("want %v reusing a code; got %v", models.ErrInvalidCredenetials, err)
+	}
+
+	// a code's time step is good once, earlier ones not at all
+	if err := m.UseTOTPStep(ctx, 1, 1000); err != nil {
+		t.Errorf("want nil; got %v", err)
+	}
+	for _, step := range []int64{1000, 999} {
+		if err := m.UseTOTPStep(ctx, 1, step); err != models.ErrInvalidCredenetials {
+			t.Errorf("step %d: want %v; got %v", step, models.ErrInvalidCredenetials, err)
+		}
+	}
+	if err := m.UseTOTPStep(ctx, 1, 1001); err != nil {
+		t.Errorf("want the next step accepted; got %v", err)
+	}
+
+	if err := m.DisableTOTP(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UseRecoveryCode(ctx, 1, "KLMNO-PQRST"); err != models.ErrInvalidCredenetials {
+		t.Errorf("want recovery codes dropped on disable; got %v", err)
+	}
+}
+
+func TestUserModelSecondFactorLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db, Lockout: Lockout{Threshold: 2, Duration: time.Minute}}
+	ctx := context.Background()
+
+	if err := m.EnableTOTP(ctx, 1, "JBSWY3DPEHPK3PXP", []string{"ABCDE-FGHIJ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the right password doesn't clear wrong codes, or it could be used to guess them forever
+	if err := m.SecondFactorFailed(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, "alice@example.com", "pa55word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SecondFactorFailed(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.TOTPSecret(ctx, 1); err != models.ErrAccountLocked {
+		t.Errorf("want %v for the secret; got %v", models.ErrAccountLocked, err)
+	}
+	if err := m.UseRecoveryCode(ctx, 1, "ABCDE-FGHIJ"); err != models.ErrAccountLocked {
+		t.Errorf("want %v for a recovery code; got %v", models.ErrAccountLocked, err)
+	}
+	if _, err := m.Authenticate(ctx, "alice@example.com", "pa55word"); err != models.ErrAccountLocked {
+		t.Errorf("want %v for the password; got %v", models.ErrAccountLocked, err)
+	}
+
+	// a code which gets in clears the count
+	if _, err := db.ExecContext(ctx, `UPDATE users SET locked_until = NULL WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.UseRecoveryCode(ctx, 1, "ABCDE-FGHIJ"); err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	if err := db.QueryRowContext(ctx, `SELECT failed_logins FROM users WHERE id = 1`).Scan(&failures); err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 {
+		t.Errorf("want the failed logins reset; got %d", failures)
+	}
+}
@@ -1,8 +1,10 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/vandit1604/snipshot/pkg/models"
@@ -11,18 +13,54 @@ import (
 
 type UserModel struct {
 	DB *sql.DB
+	// Timeout is the deadline applied to every query on top of the caller's context.
+	Timeout time.Duration
+	Lockout Lockout
+}
+
+// Lockout locks an account once Threshold logins in a row have failed. The first lock lasts
+// Duration and every further failure doubles it, up to MaxDuration. A zero Threshold disables it.
+type Lockout struct {
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// until is when an account with the given number of consecutive failures unlocks, the zero time
+// if it isn't locked.
+func (l Lockout) until(failures int, now time.Time) time.Time {
+	if l.Threshold <= 0 || failures < l.Threshold {
+		return time.Time{}
+	}
+
+	d := l.Duration
+	for i := l.Threshold; i < failures && (l.MaxDuration <= 0 || d < l.MaxDuration); i++ {
+		d *= 2
+	}
+	if l.MaxDuration > 0 && d > l.MaxDuration {
+		d = l.MaxDuration
+	}
+
+	return now.Add(d)
 }
 
 // We'll use the Insert method to add a new record to the users table.
-func (m *UserModel) Insert(name, email, password string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.Insert")
+	defer func() { end(err) }()
+
+	hashedPassword, err := hashPassword(ctx, password)
 	if err != nil {
 		return err
 	}
 
+	// the deadline starts after hashing so bcrypt's cost doesn't eat into the query's budget
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
 	stmt := `INSERT INTO users(name, email, hashed_password,created) VALUES(?,?,?,UTC_TIMESTAMP())`
 
-	_, err = m.DB.Exec(stmt, name, email, string(hashedPassword))
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
 	if err != nil {
 		// here we're type asserting the err and if it is correct then we're using the struct values to check what kind of mysql error was thrown
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
@@ -30,19 +68,31 @@ func (m *UserModel) Insert(name, email, password string) error {
 				return models.ErrDuplicateEmail
 			}
 		}
+		return err
 	}
 
 	return nil
 }
 
 // Authenticate verifies a user exists with the provided email address and password.
-// If the user exists the relevant user ID is returned.
-func (u *UserModel) Authenticate(email, password string) (int, error) {
-	var id int
+// If the user exists the relevant user ID is returned, unless the account was deactivated in
+// which case it is ErrAccountInactive. Failures are counted against the account,
+// which gets locked according to the Lockout policy, and a successful login resets the count.
+// For users with two-factor authentication that waits for their code, see UseTOTPStep.
+func (u *UserModel) Authenticate(ctx context.Context, email, password string) (_ int, err error) {
+	ctx, end := startSpan(ctx, "UserModel.Authenticate")
+	defer func() { end(err) }()
+
+	queryCtx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var id, failures int
 	var hashedPw []byte
-	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
-	row := u.DB.QueryRow(stmt, email)
-	err := row.Scan(&id, &hashedPw)
+	var lockedUntil sql.NullTime
+	var active, totpEnabled bool
+	stmt := `SELECT id, hashed_password, failed_logins, locked_until, active, totp_enabled FROM users WHERE email = ?`
+	row := u.DB.QueryRowContext(queryCtx, stmt, email)
+	err = row.Scan(&id, &hashedPw, &failures, &lockedUntil, &active, &totpEnabled)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return 0, models.ErrInvalidCredenetials
@@ -52,33 +102,283 @@ func (u *UserModel) Authenticate(email, password string) (int, error) {
 	}
 
 	// Check whether the hashed password and plain-text password provided match.
-	// If they don't, we return the ErrInvalidCredentials error.
-	err = bcrypt.CompareHashAndPassword(hashedPw, []byte(password))
+	// If they don't, we return the ErrInvalidCredentials error. The password is checked even
+	// when the account is locked so that locked accounts don't answer any faster.
+	err = comparePassword(ctx, hashedPw, password)
+	now := time.Now().UTC()
+	if lockedUntil.Valid && lockedUntil.Time.After(now) {
+		return 0, models.ErrAccountLocked
+	}
 	if err != nil {
-		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return 0, models.ErrInvalidCredenetials
-		} else {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
 			return 0, err
 		}
+
+		if err := u.countFailure(ctx, id, failures, now); err != nil {
+			return 0, err
+		}
+
+		return 0, models.ErrInvalidCredenetials
+	}
+
+	// the password alone doesn't clear wrong two-factor codes, or knowing it would allow
+	// guessing codes forever
+	if failures > 0 && !totpEnabled {
+		ctx, cancel := withTimeout(ctx, u.Timeout)
+		defer cancel()
+
+		stmt := `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = ?`
+		if _, err := u.DB.ExecContext(ctx, stmt, id); err != nil {
+			return 0, err
+		}
+	}
+
+	// only someone who knows the password gets told the account was deactivated
+	if !active {
+		return 0, models.ErrAccountInactive
 	}
 
 	// Otherwise, the password is correct, so return the userID.
 	return id, nil
 }
 
+// countFailure records another failed login on top of failures, locking the account according
+// to the Lockout policy.
+func (u *UserModel) countFailure(ctx context.Context, id, failures int, now time.Time) error {
+	ctx, cancel := withTimeout(ctx, u.Timeout)
+	defer cancel()
+
+	var until sql.NullTime
+	if t := u.Lockout.until(failures+1, now); !t.IsZero() {
+		until = sql.NullTime{Time: t, Valid: true}
+	}
+	stmt := `UPDATE users SET failed_logins = failed_logins + 1, locked_until = ? WHERE id = ?`
+	_, err := u.DB.ExecContext(ctx, stmt, until, id)
+	return err
+}
+
 // We'll use the Get method to fetch details for a specific user based
 // on their user ID.
-func (m *UserModel) Get(id int) (*models.User, error) {
+func (m *UserModel) Get(ctx context.Context, id int) (_ *models.User, err error) {
+	ctx, end := startSpan(ctx, "UserModel.Get")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
 	user := &models.User{}
 
-	stmt := `SELECT id,name,email,created FROM users WHERE id=?`
+	stmt := `SELECT id,name,email,created,verified,password_changed,totp_enabled,role,active FROM users WHERE id=?`
 
-	err := m.DB.QueryRow(stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created)
-	if err == models.ErrRecordNotFound {
+	var passwordChanged sql.NullTime
+	err = m.DB.QueryRowContext(ctx, stmt, id).Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Verified, &passwordChanged, &user.TOTPEnabled, &user.Role, &user.Active)
+	if errors.Is(err, sql.ErrNoRows) {
 		return nil, models.ErrRecordNotFound
 	} else if err != nil {
 		return nil, err
 	}
+	user.PasswordChanged = passwordChanged.Time
 
 	return user, nil
 }
+
+// List returns every user, oldest first, for the admin area.
+func (m *UserModel) List(ctx context.Context) (_ []*models.User, err error) {
+	ctx, end := startSpan(ctx, "UserModel.List")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `SELECT id,name,email,created,verified,password_changed,totp_enabled,role,active FROM users ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		var passwordChanged sql.NullTime
+		err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Created, &user.Verified, &passwordChanged, &user.TOTPEnabled, &user.Role, &user.Active)
+		if err != nil {
+			return nil, err
+		}
+		user.PasswordChanged = passwordChanged.Time
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SetActive deactivates the user, or activates them again. It returns ErrRecordNotFound if there
+// is no such user. Logging out the sessions of a deactivated user is up to the caller.
+func (m *UserModel) SetActive(ctx context.Context, id int, active bool) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.SetActive")
+	defer func() { end(err) }()
+
+	return m.update(ctx, `UPDATE users SET active = ? WHERE id = ?`, active, id)
+}
+
+// SetRole changes the role of the user. It returns ErrRecordNotFound if there is no such user.
+func (m *UserModel) SetRole(ctx context.Context, id int, role string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.SetRole")
+	defer func() { end(err) }()
+
+	return m.update(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, id)
+}
+
+// update runs an UPDATE of a single user, the id being the last argument.
+func (m *UserModel) update(ctx context.Context, stmt string, args ...interface{}) error {
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+
+	// MySQL only counts the rows that changed, nothing changes either when the user already had
+	// the value or when there is no such user
+	var exists bool
+	err = m.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, args[len(args)-1]).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Verify marks the user with the given email address as verified. It returns ErrRecordNotFound
+// when there is no such user waiting to be verified, which makes the links in verification
+// emails single-use.
+func (m *UserModel) Verify(ctx context.Context, email string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.Verify")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	stmt := `UPDATE users SET verified = TRUE WHERE email = ? AND verified = FALSE`
+
+	res, err := m.DB.ExecContext(ctx, stmt, email)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return models.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UpdateProfile changes the user's name and email address. A new address has to be verified
+// again. It returns ErrDuplicateEmail if the address belongs to another user.
+func (m *UserModel) UpdateProfile(ctx context.Context, id int, name, email string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.UpdateProfile")
+	defer func() { end(err) }()
+
+	ctx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// MySQL assigns left to right, so the comparison sees the old address
+	stmt := `UPDATE users SET name = ?, verified = verified AND email = ?, email = ? WHERE id = ?`
+
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, email, id)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return models.ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ChangePassword sets a new password after checking the current one, returning
+// ErrInvalidCredenetials if it is wrong. The time of the change is recorded, which logs out the
+// user's other sessions, and their API tokens are deleted, as a password is usually changed
+// because someone else may know it.
+func (m *UserModel) ChangePassword(ctx context.Context, id int, current, password string) (err error) {
+	ctx, end := startSpan(ctx, "UserModel.ChangePassword")
+	defer func() { end(err) }()
+
+	queryCtx, cancel := withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var hashedPw []byte
+	err = m.DB.QueryRowContext(queryCtx, `SELECT hashed_password FROM users WHERE id = ?`, id).Scan(&hashedPw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ErrRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	err = comparePassword(ctx, hashedPw, current)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return models.ErrInvalidCredenetials
+	} else if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel = withTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users SET hashed_password = ?, password_changed = UTC_TIMESTAMP() WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, stmt, string(hashedPassword), id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// hashPassword and comparePassword wrap bcrypt in spans of their own, as with the default cost
+// they easily take longer than the queries around them.
+func hashPassword(ctx context.Context, password string) ([]byte, error) {
+	_, span := tracer.Start(ctx, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+func comparePassword(ctx context.Context, hashedPassword []byte, password string) error {
+	_, span := tracer.Start(ctx, "bcrypt.CompareHashAndPassword")
+	defer span.End()
+
+	return bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"reflect"
 	"testing"
 	"time"
@@ -50,11 +51,11 @@ func TestUserModelGet(t *testing.T) {
 			defer teardown()
 
 			// Create a new instance of the UserModel.
-			m := UserModel{db}
+			m := UserModel{DB: db}
 
 			// Call the UserModel.Get() method and check that the return value and error match
 			// the expected values for the sub-test.
-			user, err := m.Get(tt.userID)
+			user, err := m.Get(context.Background(), tt.userID)
 
 			t.Logf("testing %q for want-user %v and want-error %v", tt.name, tt.wantUser,
 				tt.wantError)
@@ -69,3 +70,253 @@ func TestUserModelGet(t *testing.T) {
 		})
 	}
 }
+
+func TestLockoutUntil(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := Lockout{Threshold: 3, Duration: time.Minute, MaxDuration: 5 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{60, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := l.until(tt.failures, now)
+		if tt.want == 0 {
+			if !got.IsZero() {
+				t.Errorf("%d failures: want no lock; got %v", tt.failures, got)
+			}
+			continue
+		}
+		if got.Sub(now) != tt.want {
+			t.Errorf("%d failures: want locked for %v; got %v", tt.failures, tt.want, got.Sub(now))
+		}
+	}
+
+	if got := (Lockout{}).until(100, now); !got.IsZero() {
+		t.Errorf("want a zero policy to never lock; got %v", got)
+	}
+}
+
+func TestUserModelAuthenticateLockout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db, Lockout: Lockout{Threshold: 2, Duration: time.Minute}}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.Authenticate(ctx, "alice@example.com", "wrong"); err != models.ErrInvalidCredenetials {
+			t.Fatalf("attempt %d: want %v; got %v", i+1, models.ErrInvalidCredenetials, err)
+		}
+	}
+
+	// locked now, even with the right password
+	if _, err := m.Authenticate(ctx, "alice@example.com", "pa55word"); err != models.ErrAccountLocked {
+		t.Fatalf("want %v; got %v", models.ErrAccountLocked, err)
+	}
+
+	if _, err := db.Exec(`UPDATE users SET locked_until = UTC_TIMESTAMP() - INTERVAL 1 SECOND`); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.Authenticate(ctx, "alice@example.com", "pa55word")
+	if err != nil || id != 1 {
+		t.Fatalf("want user 1 once the lock expired; got %d, %v", id, err)
+	}
+
+	var failures int
+	if err := db.QueryRow(`SELECT failed_logins FROM users WHERE id = 1`).Scan(&failures); err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 {
+		t.Errorf("want failures reset after a successful login; got %d", failures)
+	}
+}
+
+func TestUserModelVerify(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.Insert(ctx, "Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Verify(ctx, "bob@example.com"); err != nil {
+		t.Fatalf("want nil; got %v", err)
+	}
+
+	// links are single-use, and already verified users can't be verified again
+	for _, email := range []string{"bob@example.com", "alice@example.com", "nobody@example.com"} {
+		if err := m.Verify(ctx, email); err != models.ErrRecordNotFound {
+			t.Errorf("%s: want %v; got %v", email, models.ErrRecordNotFound, err)
+		}
+	}
+}
+
+func TestUserModelUpdateProfile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.Insert(ctx, "Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.UpdateProfile(ctx, 1, "Alice", "bob@example.com"); err != models.ErrDuplicateEmail {
+		t.Errorf("want %v; got %v", models.ErrDuplicateEmail, err)
+	}
+
+	// keeping the address keeps it verified
+	if err := m.UpdateProfile(ctx, 1, "Alice Smith", "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "Alice Smith" || !user.Verified {
+		t.Errorf("want name changed and still verified; got %q, %v", user.Name, user.Verified)
+	}
+
+	if err := m.UpdateProfile(ctx, 1, "Alice Smith", "alice.smith@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	user, err = m.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "alice.smith@example.com" || user.Verified {
+		t.Errorf("want new address waiting for verification; got %q, %v", user.Email, user.Verified)
+	}
+}
+
+func TestUserModelChangePassword(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	tokens := TokenModel{DB: db}
+	ctx := context.Background()
+
+	token, err := tokens.New(ctx, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ChangePassword(ctx, 1, "wrong", "newPa$$word1"); err != models.ErrInvalidCredenetials {
+		t.Errorf("want %v; got %v", models.ErrInvalidCredenetials, err)
+	}
+	if _, err := tokens.Authenticate(ctx, token.Plaintext); err != nil {
+		t.Errorf("want the API token kept after a wrong password; got %v", err)
+	}
+
+	if err := m.ChangePassword(ctx, 1, "pa55word", "newPa$$word1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Authenticate(ctx, "alice@example.com", "newPa$$word1"); err != nil {
+		t.Errorf("want the new password to work; got %v", err)
+	}
+	// a stolen API token doesn't outlive the password either
+	if _, err := tokens.Authenticate(ctx, token.Plaintext); err != models.ErrInvalidCredenetials {
+		t.Errorf("want %v for an API token from before the change; got %v", models.ErrInvalidCredenetials, err)
+	}
+}
+
+func TestUserModelSetActive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.SetActive(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, "alice@example.com", "pa55word"); err != models.ErrAccountInactive {
+		t.Errorf("want %v; got %v", models.ErrAccountInactive, err)
+	}
+	// the password is still checked first
+	if _, err := m.Authenticate(ctx, "alice@example.com", "wrong"); err != models.ErrInvalidCredenetials {
+		t.Errorf("want %v with the wrong password; got %v", models.ErrInvalidCredenetials, err)
+	}
+
+	// setting what the user already has isn't mistaken for a missing user
+	if err := m.SetActive(ctx, 1, false); err != nil {
+		t.Errorf("want nil deactivating twice; got %v", err)
+	}
+	if err := m.SetActive(ctx, 2, false); err != models.ErrRecordNotFound {
+		t.Errorf("want %v; got %v", models.ErrRecordNotFound, err)
+	}
+
+	if err := m.SetActive(ctx, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Authenticate(ctx, "alice@example.com", "pa55word"); err != nil {
+		t.Errorf("want the account back; got %v", err)
+	}
+}
+
+func TestUserModelSetRole(t *testing.T) {
+	if testing.Short() {
+		t.Skip("mysql: skipping integration test")
+	}
+
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	m := UserModel{DB: db}
+	ctx := context.Background()
+
+	if err := m.Insert(ctx, "Bob", "bob@example.com", "validPa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetRole(ctx, 1, models.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetRole(ctx, 3, models.RoleAdmin); err != models.ErrRecordNotFound {
+		t.Errorf("want %v; got %v", models.ErrRecordNotFound, err)
+	}
+
+	users, err := m.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Role != models.RoleAdmin || users[1].Role != models.RoleUser || !users[1].Active {
+		t.Errorf("want alice an admin and bob an active user; got %+v", users)
+	}
+}
@@ -0,0 +1,180 @@
+// Package ratelimit implements token bucket rate limiting with in-process and Redis backed stores.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Policy allows bursts of up to Burst requests, refilled at Rate requests per second.
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+// ParsePolicy reads a policy written as requests per unit, e.g. "5/m", with an optional burst
+// after a colon, e.g. "5/m:10". The unit is s, m or h and the burst defaults to the number of
+// requests. "0" or "" disables limiting and yields the zero Policy.
+func ParsePolicy(s string) (Policy, error) {
+	if s == "" || s == "0" {
+		return Policy{}, nil
+	}
+
+	spec, burstStr, hasBurst := strings.Cut(s, ":")
+	countStr, unit, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, want requests/unit[:burst]", s)
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count < 1 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, request count must be a positive number", s)
+	}
+
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Policy{}, fmt.Errorf("invalid rate limit %q, unit must be s, m or h", s)
+	}
+
+	burst := count
+	if hasBurst {
+		burst, err = strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return Policy{}, fmt.Errorf("invalid rate limit %q, burst must be a positive number", s)
+		}
+	}
+
+	return Policy{Rate: float64(count) / per.Seconds(), Burst: burst}, nil
+}
+
+// Enabled reports whether the policy limits anything.
+func (p Policy) Enabled() bool {
+	return p.Rate > 0 && p.Burst > 0
+}
+
+// Store keeps the buckets. Take removes a token from the bucket under key, creating a full one
+// if there is none, and when the bucket is empty reports how long until the next token arrives.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// retryAfter is how long an empty bucket takes to refill a single token.
+func retryAfter(tokens float64, p Policy) time.Duration {
+	return time.Duration(math.Ceil((1 - tokens) / p.Rate * float64(time.Second)))
+}
+
+// Memory is a Store local to the process. Buckets that have refilled completely are dropped on
+// the next sweep, which runs at most once a minute.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	policy Policy
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, p Policy) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Burst), last: now, policy: p}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(p.Burst), b.tokens+now.Sub(b.last).Seconds()*p.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, retryAfter(b.tokens, p), nil
+	}
+
+	b.tokens--
+	return true, 0, nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.policy.Rate >= float64(b.policy.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// Redis is a Store shared by every instance talking to the same Redis compatible server, so the
+// limits hold across replicas of the app.
+type Redis struct {
+	Client *redis.Client
+	// Prefix is prepended to every key so the buckets can share a database with other data.
+	Prefix string
+}
+
+// takeScript refills and takes from the bucket atomically. The bucket is a hash of the remaining
+// tokens and the time of the last refill in microseconds, taken from the server's clock so that
+// instances with skewed clocks agree. It returns {allowed, tokens * 1000}.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + (now - last) / 1000000 * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000))
+return {allowed, math.floor(tokens * 1000)}
+`)
+
+func (s *Redis) Take(ctx context.Context, key string, p Policy) (bool, time.Duration, error) {
+	res, err := takeScript.Run(ctx, s.Client, []string{s.Prefix + key}, p.Rate, p.Burst).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if res[0] == 1 {
+		return true, 0, nil
+	}
+
+	return false, retryAfter(float64(res[1])/1000, p), nil
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		want      Policy
+		wantError bool
+	}{
+		{"Disabled", "0", Policy{}, false},
+		{"Empty", "", Policy{}, false},
+		{"Per Minute", "6/m", Policy{Rate: 0.1, Burst: 6}, false},
+		{"Per Second With Burst", "2/s:10", Policy{Rate: 2, Burst: 10}, false},
+		{"Per Hour", "36/h", Policy{Rate: 0.01, Burst: 36}, false},
+		{"Missing Unit", "5", Policy{}, true},
+		{"Unknown Unit", "5/d", Policy{}, true},
+		{"Zero Count", "0/m", Policy{}, true},
+		{"Bad Burst", "5/m:x", Policy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(tt.spec)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("want error %v; got %v", tt.wantError, err)
+			}
+			if p != tt.want {
+				t.Errorf("want %+v; got %+v", tt.want, p)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	now := time.Now()
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	p := Policy{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := m.Take(ctx, "a", p); !ok {
+			t.Fatalf("request %d: want allowed", i+1)
+		}
+	}
+
+	ok, retry, _ := m.Take(ctx, "a", p)
+	if ok {
+		t.Fatal("want the third request limited")
+	}
+	if retry != time.Second {
+		t.Errorf("want retry after %v; got %v", time.Second, retry)
+	}
+
+	// other keys have their own bucket
+	if ok, _, _ := m.Take(ctx, "b", p); !ok {
+		t.Error("want another key allowed")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, retry, _ := m.Take(ctx, "a", p); retry != 500*time.Millisecond {
+		t.Errorf("want retry after %v; got %v", 500*time.Millisecond, retry)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _, _ := m.Take(ctx, "a", p); !ok {
+		t.Error("want allowed once a token has refilled")
+	}
+
+	now = now.Add(time.Hour)
+	m.Take(ctx, "c", p)
+	if _, ok := m.buckets["b"]; ok {
+		t.Error("want full buckets swept")
+	}
+}
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	s := &Redis{Client: client, Prefix: "test:"}
+	p := Policy{Rate: 0.1, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := s.Take(ctx, "a", p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("request %d: want allowed", i+1)
+		}
+	}
+
+	ok, retry, err := s.Take(ctx, "a", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("want the third request limited")
+	}
+	if retry <= 0 || retry > 10*time.Second {
+		t.Errorf("want retry after at most 10s; got %v", retry)
+	}
+
+	if !mr.Exists("test:a") {
+		t.Error("want the bucket stored under the prefixed key")
+	}
+	if ttl := mr.TTL("test:a"); ttl <= 0 || ttl > 20*time.Second {
+		t.Errorf("want the bucket to expire once full again; got ttl %v", ttl)
+	}
+}
@@ -0,0 +1,176 @@
+// Package secrets finds credentials pasted into snippets by mistake, such as cloud keys, private
+// keys and tokens.
+package secrets
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Action is what happens to a snippet a secret is found in.
+type Action string
+
+const (
+	// ActionBlock refuses the snippet until the secret is taken out.
+	ActionBlock Action = "block"
+	// ActionPrivate stores the snippet for its author's eyes only.
+	ActionPrivate Action = "private"
+	// ActionRedact stores the snippet with the secrets replaced.
+	ActionRedact Action = "redact"
+	// ActionOff doesn't scan snippets at all.
+	ActionOff Action = "off"
+)
+
+// ParseAction reads an action as given on the command line.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionBlock, ActionPrivate, ActionRedact, ActionOff:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid secrets action %q, want block, private, redact or off", s)
+	}
+}
+
+// Finding is a secret found in some content, at content[Start:End].
+type Finding struct {
+	// Kind says what the secret looks like, e.g. "AWS access key".
+	Kind  string
+	Line  int
+	Start int
+	End   int
+}
+
+// patterns are the credentials with a recognisable format. The private key comes first so the
+// base64 inside it isn't reported a second time as a high entropy string.
+var patterns = []struct {
+	kind string
+	rx   *regexp.Regexp
+}{
+	// an END line missing from a key which got cut off doesn't make it any less secret
+	{"private key", regexp.MustCompile(`(?s)-----BEGIN[A-Z ]* PRIVATE KEY-----.*?(?:-----END[A-Z ]* PRIVATE KEY-----|\z)`)},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{"JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+}
+
+// candidateRX matches the runs of base64 and URL safe characters checked for entropy.
+var candidateRX = regexp.MustCompile(`[A-Za-z0-9+/_-]{20,}={0,2}`)
+
+// Checksums are as random looking as keys but public, and pasted a lot with go.sum and lockfiles.
+// checksumRX matches a run of base64 which is one, labelled by the hash like subresource
+// integrity ("sha512-..."), and checksumPrefixRX the labels in front of one, like the "h1:" of
+// go.sum.
+var (
+	checksumRX       = regexp.MustCompile(`^(?:sha1|sha256|sha384|sha512)-`)
+	checksumPrefixRX = regexp.MustCompile(`\b(?:h1|md5|sha1|sha256|sha384|sha512):$`)
+)
+
+// Scanner looks for secrets. The zero Scanner only looks for the known formats.
+type Scanner struct {
+	// MinEntropy is the Shannon entropy, in bits per character, from which a run of 20 or more
+	// base64 characters mixing upper and lower case letters and digits is taken for a secret. 0
+	// turns the check off. Hex strings, which are mostly commit hashes and checksums, and base64
+	// checksums labelled as such, like those of go.sum and package-lock.json, are never flagged
+	// for their entropy.
+	MinEntropy float64
+}
+
+// Scan returns the secrets found in content, in the order they appear in. They don't overlap.
+func (s *Scanner) Scan(content string) []Finding {
+	var findings []Finding
+
+	for _, p := range patterns {
+		for _, m := range p.rx.FindAllStringIndex(content, -1) {
+			if !overlaps(findings, m[0], m[1]) {
+				findings = append(findings, Finding{Kind: p.kind, Start: m[0], End: m[1]})
+			}
+		}
+	}
+
+	if s.MinEntropy > 0 {
+		for _, m := range candidateRX.FindAllStringIndex(content, -1) {
+			word := content[m[0]:m[1]]
+			if overlaps(findings, m[0], m[1]) || !mixed(word) || checksum(content[:m[0]], word) || entropy(word) < s.MinEntropy {
+				continue
+			}
+			findings = append(findings, Finding{Kind: "high entropy string", Start: m[0], End: m[1]})
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	for i := range findings {
+		findings[i].Line = strings.Count(content[:findings[i].Start], "\n") + 1
+	}
+
+	return findings
+}
+
+// Redact replaces each of the findings of Scan in content with a note of what was there.
+func Redact(content string, findings []Finding) string {
+	var b strings.Builder
+	last := 0
+	for _, f := range findings {
+		b.WriteString(content[last:f.Start])
+		b.WriteString("[redacted " + f.Kind + "]")
+		last = f.End
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func overlaps(findings []Finding, start, end int) bool {
+	for _, f := range findings {
+		if start < f.End && f.Start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// checksum reports whether word, found after before, is a labelled checksum.
+func checksum(before, word string) bool {
+	if len(before) > 8 {
+		before = before[len(before)-8:]
+	}
+	return checksumRX.MatchString(word) || checksumPrefixRX.MatchString(before)
+}
+
+// mixed reports whether s has upper and lower case letters and digits, as generated keys do and
+// words and hex strings don't.
+func mixed(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var h float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,504 @@
+// Package session keeps HTTP sessions on the server, in MySQL or in memory, so they can be
+// listed and revoked. The cookie only carries a random token identifying the session.
+//
+// Manager has the same methods as github.com/golangcollege/sessions, which kept everything in
+// an encrypted cookie and couldn't take back a stolen one.
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+const cookieName = "session"
+
+// touchInterval is how often the last activity of a session is written back when nothing in it
+// changed, so merely browsing doesn't write to the store on every request. It is shorter with a
+// short IdleTimeout.
+const touchInterval = time.Minute
+
+// Manager loads the session of every request from the Store and saves it once the handler is
+// done. Values are encoded with encoding/gob, types other than the basic ones have to be
+// registered with gob.Register.
+type Manager struct {
+	Store Store
+	// Lifetime is how long a session lasts from when it was created, however active it is. Its
+	// cookie is gone when the browser is closed.
+	Lifetime time.Duration
+	// IdleTimeout ends sessions which weren't used for this long, 0 to only rely on Lifetime.
+	IdleTimeout time.Duration
+	// RememberLifetime is how long sessions last which the user asked to be remembered with
+	// RememberMe. Their cookie outlives the browser and they don't time out when idle.
+	RememberLifetime time.Duration
+	Secure           bool
+	SameSite         http.SameSite
+	// UserKey is the key the ID of the logged in user is put under. Sessions are listed and
+	// revoked per user by it.
+	UserKey string
+	// ClientIP returns the address recorded for the session, the remote address if nil.
+	ClientIP func(*http.Request) string
+	// ErrorHandler is called when the session can't be loaded or saved. The default responds
+	// with a bare 500.
+	ErrorHandler func(http.ResponseWriter, *http.Request, error)
+}
+
+func New(store Store) *Manager {
+	return &Manager{
+		Store:            store,
+		Lifetime:         24 * time.Hour,
+		RememberLifetime: 30 * 24 * time.Hour,
+		SameSite:         http.SameSiteLaxMode,
+		UserKey:          "userID",
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		},
+	}
+}
+
+type contextKey struct{}
+
+// state is the session of a single request.
+type state struct {
+	mu sync.Mutex
+	// record is the stored session, nil until something is put in a new one.
+	record   *models.Session
+	values   map[string]interface{}
+	modified bool
+	// renew gets the session a new token, and persistent decides its lifetime when it does.
+	renew      bool
+	persistent bool
+	// deleted are sessions to remove from the store when the request is done.
+	deleted []string
+}
+
+// hash turns the token in the cookie into the ID the session is stored under.
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Enable loads and saves the session around next. The response is buffered until the handler
+// returns, so that the session can still be saved and its cookie set.
+func (m *Manager) Enable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(contextKey{}).(*state); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		st, err := m.load(r)
+		if err != nil {
+			m.ErrorHandler(w, r, err)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, st))
+
+		bw := &bufferedResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, r)
+
+		if err := m.save(w, r, st); err != nil {
+			m.ErrorHandler(w, r, err)
+			return
+		}
+
+		if bw.code != 0 {
+			w.WriteHeader(bw.code)
+		}
+		w.Write(bw.buf.Bytes())
+	})
+}
+
+func (m *Manager) load(r *http.Request) (*state, error) {
+	st := &state{values: map[string]interface{}{}}
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return st, nil
+	}
+
+	record, err := m.Store.Find(r.Context(), hash(cookie.Value))
+	if errors.Is(err, models.ErrRecordNotFound) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if m.idle(record, time.Now()) {
+		st.deleted = append(st.deleted, record.ID)
+		return st, nil
+	}
+
+	// a session that can't be decoded any more, e.g. after a type was renamed, starts over
+	if err := gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&st.values); err != nil {
+		st.values = map[string]interface{}{}
+		st.deleted = append(st.deleted, record.ID)
+		return st, nil
+	}
+	st.record = record
+	st.persistent = record.Persistent
+
+	return st, nil
+}
+
+// idle reports whether s timed out for being unused.
+func (m *Manager) idle(s *models.Session, now time.Time) bool {
+	return m.IdleTimeout > 0 && !s.Persistent && now.Sub(s.LastSeen) >= m.IdleTimeout
+}
+
+func (m *Manager) touchInterval() time.Duration {
+	if m.IdleTimeout > 0 && m.IdleTimeout/2 < touchInterval {
+		return m.IdleTimeout / 2
+	}
+	return touchInterval
+}
+
+func (m *Manager) save(w http.ResponseWriter, r *http.Request, st *state) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, id := range st.deleted {
+		if err := m.Store.Delete(r.Context(), id); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	if st.renew && st.record != nil {
+		if err := m.Store.Delete(r.Context(), st.record.ID); err != nil {
+			return err
+		}
+		st.record = nil
+	}
+
+	switch {
+	// an emptied session, e.g. once the flash of an anonymous visitor was shown, isn't kept
+	case st.modified && len(st.values) == 0:
+		if st.record != nil {
+			if err := m.Store.Delete(r.Context(), st.record.ID); err != nil {
+				return err
+			}
+		}
+		if _, err := r.Cookie(cookieName); err == nil {
+			m.setCookie(w, "", nil)
+		}
+		return nil
+
+	case st.modified:
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(st.values); err != nil {
+			return err
+		}
+
+		var token string
+		insert := st.record == nil
+		if insert {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				return err
+			}
+			token = base64.RawURLEncoding.EncodeToString(b)
+			lifetime := m.Lifetime
+			if st.persistent {
+				lifetime = m.RememberLifetime
+			}
+			st.record = &models.Session{ID: hash(token), Persistent: st.persistent, Created: now, Expires: now.Add(lifetime)}
+		}
+		st.record.Data = buf.Bytes()
+		st.record.UserID, _ = st.values[m.UserKey].(int)
+		m.seen(r, st.record, now)
+		if insert {
+			if err := m.Store.Insert(r.Context(), st.record); err != nil {
+				return err
+			}
+		} else if err := m.update(w, r, st); err != nil {
+			return err
+		}
+
+		// the token of an existing session doesn't change, its cookie is still good
+		if token != "" {
+			m.setCookie(w, token, st.record)
+		}
+		return nil
+
+	case st.record != nil && now.Sub(st.record.LastSeen) >= m.touchInterval():
+		m.seen(r, st.record, now)
+		return m.update(w, r, st)
+	}
+
+	return nil
+}
+
+// update writes back the session the request loaded. If it was revoked in the meantime, say
+// by logging out everywhere, it stays revoked and the cookie is removed.
+func (m *Manager) update(w http.ResponseWriter, r *http.Request, st *state) error {
+	err := m.Store.Update(r.Context(), st.record)
+	if errors.Is(err, models.ErrRecordNotFound) {
+		st.record = nil
+		m.setCookie(w, "", nil)
+		return nil
+	}
+	return err
+}
+
+// seen records the activity of a session, from where and what browser.
+func (m *Manager) seen(r *http.Request, s *models.Session, now time.Time) {
+	s.LastSeen = now
+	s.UserAgent = r.UserAgent()
+	if m.ClientIP != nil {
+		s.IP = m.ClientIP(r)
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		s.IP = host
+	} else {
+		s.IP = r.RemoteAddr
+	}
+}
+
+// setCookie sets the session cookie to the token of s, or removes it if token is empty. Only
+// persistent sessions get a cookie which outlives the browser.
+func (m *Manager) setCookie(w http.ResponseWriter, token string, s *models.Session) {
+	cookie := &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   m.Secure,
+		HttpOnly: true,
+		SameSite: m.SameSite,
+	}
+	if token == "" {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else if s.Persistent {
+		// round up to the second, the cookie shouldn't go before the session does
+		cookie.Expires = time.Unix(s.Expires.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(s.Expires).Seconds() + 1)
+	}
+
+	w.Header().Add("Vary", "Cookie")
+	http.SetCookie(w, cookie)
+}
+
+// Cleanup deletes expired sessions from the store every interval. It blocks until ctx is done,
+// so run it in its own goroutine. Failures are left for the next round.
+func (m *Manager) Cleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var idleSince time.Time
+			if m.IdleTimeout > 0 {
+				idleSince = time.Now().Add(-m.IdleTimeout)
+			}
+			m.Store.DeleteExpired(ctx, idleSince)
+		}
+	}
+}
+
+func stateFor(r *http.Request) *state {
+	st, ok := r.Context().Value(contextKey{}).(*state)
+	if !ok {
+		panic("session: Enable middleware not used")
+	}
+	return st
+}
+
+// ID returns the ID of the session of r, as stored and listed by the Store, or "" if it hasn't
+// been saved yet.
+func (m *Manager) ID(r *http.Request) string {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.record == nil {
+		return ""
+	}
+	return st.record.ID
+}
+
+// ForUser returns the sessions the user is logged in with, most recently active first, leaving
+// out the ones which timed out but weren't cleaned up yet.
+func (m *Manager) ForUser(ctx context.Context, userID int) ([]*models.Session, error) {
+	sessions, err := m.Store.ForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := sessions[:0]
+	for _, s := range sessions {
+		if !m.idle(s, now) {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+// RenewToken gives the session a new token, keeping what's in it. Call it whenever the user's
+// privileges change, like logging in, so that a token someone planted in their browser before
+// is no good afterwards.
+func (m *Manager) RenewToken(r *http.Request) {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.renew = true
+	st.modified = true
+}
+
+// RememberMe renews the session like RenewToken, lasting for RememberLifetime instead of
+// Lifetime if remember is set.
+func (m *Manager) RememberMe(r *http.Request, remember bool) {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.persistent = remember
+	st.renew = true
+	st.modified = true
+}
+
+func (m *Manager) Put(r *http.Request, key string, val interface{}) {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.values[key] = val
+	st.modified = true
+}
+
+func (m *Manager) Get(r *http.Request, key string) interface{} {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.values[key]
+}
+
+// Pop returns the value under key and removes it from the session.
+func (m *Manager) Pop(r *http.Request, key string) interface{} {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	val, ok := st.values[key]
+	if !ok {
+		return nil
+	}
+	delete(st.values, key)
+	st.modified = true
+	return val
+}
+
+func (m *Manager) Remove(r *http.Request, key string) {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, ok := st.values[key]; !ok {
+		return
+	}
+	delete(st.values, key)
+	st.modified = true
+}
+
+func (m *Manager) Exists(r *http.Request, key string) bool {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	_, ok := st.values[key]
+	return ok
+}
+
+// Destroy deletes the session from the store and empties it. Anything put afterwards goes into
+// a new session with a new token.
+func (m *Manager) Destroy(r *http.Request) {
+	st := stateFor(r)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.record != nil {
+		st.deleted = append(st.deleted, st.record.ID)
+		st.record = nil
+	}
+	st.values = map[string]interface{}{}
+	st.modified = true
+	st.persistent = false
+}
+
+// The typed getters return the zero value if there is nothing under key, or something of
+// another type.
+
+func (m *Manager) GetString(r *http.Request, key string) string {
+	s, _ := m.Get(r, key).(string)
+	return s
+}
+
+func (m *Manager) GetBool(r *http.Request, key string) bool {
+	b, _ := m.Get(r, key).(bool)
+	return b
+}
+
+func (m *Manager) GetInt(r *http.Request, key string) int {
+	i, _ := m.Get(r, key).(int)
+	return i
+}
+
+func (m *Manager) GetBytes(r *http.Request, key string) []byte {
+	b, _ := m.Get(r, key).([]byte)
+	return b
+}
+
+func (m *Manager) GetTime(r *http.Request, key string) time.Time {
+	t, _ := m.Get(r, key).(time.Time)
+	return t
+}
+
+func (m *Manager) PopString(r *http.Request, key string) string {
+	s, _ := m.Pop(r, key).(string)
+	return s
+}
+
+func (m *Manager) PopInt(r *http.Request, key string) int {
+	i, _ := m.Pop(r, key).(int)
+	return i
+}
+
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	buf  bytes.Buffer
+	code int
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.buf.Write(b)
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	if bw.code == 0 {
+		bw.code = code
+	}
+}
+
+func (bw *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := bw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hj.Hijack()
+}
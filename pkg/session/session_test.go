@@ -0,0 +1,270 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// client keeps the session cookie between requests to a handler wrapped by Enable.
+type client struct {
+	handler http.Handler
+	cookie  *http.Cookie
+}
+
+func (c *client) do(path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("User-Agent", "Test Browser")
+	if c.cookie != nil {
+		r.AddCookie(c.cookie)
+	}
+
+	rr := httptest.NewRecorder()
+	c.handler.ServeHTTP(rr, r)
+
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == cookieName {
+			if cookie.MaxAge < 0 {
+				c.cookie = nil
+			} else {
+				c.cookie = cookie
+			}
+		}
+	}
+	return rr
+}
+
+func newTestManager() (*Manager, http.Handler) {
+	m := New(NewMemory())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		m.Put(r, "userID", 1)
+		m.Put(r, "flash", "Welcome")
+	})
+	mux.HandleFunc("/flash", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(m.PopString(r, "flash")))
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if m.GetInt(r, "userID") == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	mux.HandleFunc("/renew", func(w http.ResponseWriter, r *http.Request) {
+		m.RenewToken(r)
+		m.Put(r, "userID", 2)
+	})
+	mux.HandleFunc("/remember", func(w http.ResponseWriter, r *http.Request) {
+		m.RememberMe(r, true)
+		m.Put(r, "userID", 1)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		m.Destroy(r)
+	})
+	mux.HandleFunc("/logout/flash", func(w http.ResponseWriter, r *http.Request) {
+		m.Destroy(r)
+		m.Put(r, "flash", "Bye")
+	})
+	return m, m.Enable(mux)
+}
+
+func TestManager(t *testing.T) {
+	m, handler := newTestManager()
+	c := &client{handler: handler}
+
+	if c.do("/user"); c.cookie != nil {
+		t.Error("want no session for a visitor who didn't put anything")
+	}
+
+	c.do("/login")
+	if c.cookie == nil {
+		t.Fatal("want a session cookie after logging in")
+	}
+	if !c.cookie.HttpOnly {
+		t.Errorf("want an HttpOnly cookie; got %v", c.cookie)
+	}
+	token := c.cookie.Value
+
+	if body := c.do("/flash").Body.String(); body != "Welcome" {
+		t.Errorf("want the flash; got %q", body)
+	}
+	if body := c.do("/flash").Body.String(); body != "" {
+		t.Errorf("want the flash only once; got %q", body)
+	}
+	if c.cookie == nil || c.cookie.Value != token {
+		t.Error("want the token to stay the same while the session changes")
+	}
+
+	sessions, _ := m.Store.ForUser(context.Background(), 1)
+	if len(sessions) != 1 || sessions[0].ID == token || sessions[0].IP != "192.0.2.1" || sessions[0].UserAgent != "Test Browser" {
+		t.Fatalf("want one session stored under the hash of its token; got %+v", sessions)
+	}
+
+	// revoking the session on the server is enough, the cookie is useless without it
+	m.Store.DeleteForUser(context.Background(), 1)
+	if code := c.do("/user").Code; code != http.StatusUnauthorized {
+		t.Errorf("want %d with a revoked session; got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestManagerDestroy(t *testing.T) {
+	m, handler := newTestManager()
+	c := &client{handler: handler}
+
+	c.do("/login")
+	stolen := *c.cookie
+
+	c.do("/logout")
+	if c.cookie != nil {
+		t.Error("want the cookie removed")
+	}
+	if sessions, _ := m.Store.ForUser(context.Background(), 1); len(sessions) != 0 {
+		t.Errorf("want the session deleted; got %d", len(sessions))
+	}
+
+	c.cookie = &stolen
+	if code := c.do("/user").Code; code != http.StatusUnauthorized {
+		t.Errorf("want %d for the old cookie; got %d", http.StatusUnauthorized, code)
+	}
+
+	c.do("/login")
+	c.do("/logout/flash")
+	if c.cookie == nil || c.cookie.Value == stolen.Value {
+		t.Fatal("want a new session for what's put after destroying")
+	}
+	if body := c.do("/flash").Body.String(); body != "Bye" {
+		t.Errorf("want the flash put after destroying; got %q", body)
+	}
+}
+
+func TestManagerExpiry(t *testing.T) {
+	m, handler := newTestManager()
+	m.Lifetime = time.Millisecond
+	c := &client{handler: handler}
+
+	c.do("/login")
+	time.Sleep(5 * time.Millisecond)
+
+	if code := c.do("/user").Code; code != http.StatusUnauthorized {
+		t.Errorf("want %d for an expired session; got %d", http.StatusUnauthorized, code)
+	}
+
+	m.Store.DeleteExpired(context.Background(), time.Time{})
+	if n := len(m.Store.(*Memory).sessions); n != 0 {
+		t.Errorf("want expired sessions deleted; got %d", n)
+	}
+}
+
+func TestManagerRenewToken(t *testing.T) {
+	m, handler := newTestManager()
+	c := &client{handler: handler}
+
+	c.do("/login")
+	planted := *c.cookie
+
+	c.do("/renew")
+	if c.cookie == nil || c.cookie.Value == planted.Value {
+		t.Fatal("want a new token")
+	}
+	if body := c.do("/flash").Body.String(); body != "Welcome" {
+		t.Errorf("want the data kept; got %q", body)
+	}
+	if sessions, _ := m.ForUser(context.Background(), 2); len(sessions) != 1 {
+		t.Errorf("want a single session; got %d", len(sessions))
+	}
+
+	// whoever planted the old token doesn't share the session
+	c.cookie = &planted
+	if code := c.do("/user").Code; code != http.StatusUnauthorized {
+		t.Errorf("want %d with the old token; got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestManagerIdleTimeout(t *testing.T) {
+	m, handler := newTestManager()
+	m.IdleTimeout = 200 * time.Millisecond
+	c := &client{handler: handler}
+
+	c.do("/login")
+	if c.cookie.MaxAge != 0 {
+		t.Errorf("want a cookie gone with the browser; got MaxAge %d", c.cookie.MaxAge)
+	}
+
+	// staying active keeps it going past the idle timeout
+	for i := 0; i < 4; i++ {
+		time.Sleep(60 * time.Millisecond)
+		if code := c.do("/user").Code; code != http.StatusOK {
+			t.Fatalf("want %d while active; got %d", http.StatusOK, code)
+		}
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if sessions, _ := m.ForUser(context.Background(), 1); len(sessions) != 0 {
+		t.Errorf("want the idle session left out; got %d", len(sessions))
+	}
+	if code := c.do("/user").Code; code != http.StatusUnauthorized {
+		t.Errorf("want %d when idle; got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestManagerRememberMe(t *testing.T) {
+	m, handler := newTestManager()
+	m.IdleTimeout = 10 * time.Millisecond
+	c := &client{handler: handler}
+
+	c.do("/remember")
+	if c.cookie == nil || c.cookie.MaxAge < int((29*24*time.Hour).Seconds()) {
+		t.Fatalf("want a cookie lasting RememberLifetime; got %v", c.cookie)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	m.Store.DeleteExpired(context.Background(), time.Now().Add(-m.IdleTimeout))
+	if code := c.do("/user").Code; code != http.StatusOK {
+		t.Errorf("want a remembered session to survive being idle; got %d", code)
+	}
+
+	c.do("/logout")
+	c.do("/login")
+	if c.cookie == nil || c.cookie.MaxAge != 0 {
+		t.Errorf("want the next session forgotten again; got %v", c.cookie)
+	}
+}
+
+func TestManagerRevokedWhileHeld(t *testing.T) {
+	store := NewMemory()
+	m := New(store)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		m.Put(r, "userID", 1)
+	})
+	// the user logs out everywhere from another device while these requests are being handled
+	mux.HandleFunc("/revoked/modify", func(w http.ResponseWriter, r *http.Request) {
+		m.Store.DeleteForUser(r.Context(), 1)
+		m.Put(r, "flash", "Saved")
+	})
+	mux.HandleFunc("/revoked/touch", func(w http.ResponseWriter, r *http.Request) {
+		m.Store.DeleteForUser(r.Context(), 1)
+	})
+	c := &client{handler: m.Enable(mux)}
+
+	for _, path := range []string{"/revoked/modify", "/revoked/touch"} {
+		c.do("/login")
+		// long enough ago for the last activity to be written back
+		for id, s := range store.sessions {
+			s.LastSeen = s.LastSeen.Add(-time.Hour)
+			store.sessions[id] = s
+		}
+
+		if code := c.do(path).Code; code != http.StatusOK {
+			t.Errorf("%s: want %d; got %d", path, http.StatusOK, code)
+		}
+		if c.cookie != nil {
+			t.Errorf("%s: want the cookie of the revoked session removed", path)
+		}
+		if n := len(store.sessions); n != 0 {
+			t.Errorf("%s: want the revoked session to stay revoked; got %d sessions", path, n)
+		}
+	}
+}
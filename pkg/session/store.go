@@ -0,0 +1,126 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vandit1604/snipshot/pkg/models"
+)
+
+// Store keeps the sessions. mysql.SessionModel is the one shared by every instance of the app.
+type Store interface {
+	// Find returns the session with the given ID, or models.ErrRecordNotFound if there is none
+	// or it has expired.
+	Find(ctx context.Context, id string) (*models.Session, error)
+	// Insert stores a new session.
+	Insert(ctx context.Context, s *models.Session) error
+	// Update changes the data, user and last activity of a stored session. It returns
+	// models.ErrRecordNotFound if the session is gone, e.g. because it was revoked while a
+	// request held it, and never brings it back.
+	Update(ctx context.Context, s *models.Session) error
+	Delete(ctx context.Context, id string) error
+	// ForUser returns the unexpired sessions the user is logged in with, most recently active first.
+	ForUser(ctx context.Context, userID int) ([]*models.Session, error)
+	// DeleteForUser logs the user out everywhere.
+	DeleteForUser(ctx context.Context, userID int) error
+	// DeleteExpired deletes expired sessions, and sessions which aren't persistent and weren't
+	// active since idleSince unless it's zero.
+	DeleteExpired(ctx context.Context, idleSince time.Time) error
+}
+
+// Memory is a Store local to the process, for development and single instances. Sessions are
+// lost when the process restarts.
+type Memory struct {
+	mu       sync.Mutex
+	sessions map[string]models.Session
+}
+
+func NewMemory() *Memory {
+	return &Memory{sessions: map[string]models.Session{}}
+}
+
+func (m *Memory) Find(ctx context.Context, id string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || !time.Now().Before(s.Expires) {
+		return nil, models.ErrRecordNotFound
+	}
+	return &s, nil
+}
+
+func (m *Memory) Insert(ctx context.Context, s *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// copied, so the caller changing theirs doesn't change the stored one
+	m.sessions[s.ID] = *s
+	return nil
+}
+
+func (m *Memory) Update(ctx context.Context, s *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.sessions[s.ID]
+	if !ok {
+		return models.ErrRecordNotFound
+	}
+	stored.UserID, stored.Data, stored.IP, stored.UserAgent, stored.LastSeen = s.UserID, s.Data, s.IP, s.UserAgent, s.LastSeen
+	m.sessions[s.ID] = stored
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *Memory) ForUser(ctx context.Context, userID int) ([]*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := []*models.Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID && now.Before(s.Expires) {
+			s := s
+			sessions = append(sessions, &s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+func (m *Memory) DeleteForUser(ctx context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteExpired(ctx context.Context, idleSince time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range m.sessions {
+		if !now.Before(s.Expires) || (!idleSince.IsZero() && !s.Persistent && s.LastSeen.Before(idleSince)) {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
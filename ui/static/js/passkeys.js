@@ -0,0 +1,101 @@
+// The WebAuthn options and responses carry binary fields, sent as unpadded base64url in JSON.
+function decode(value) {
+	var s = atob(value.replace(/-/g, "+").replace(/_/g, "/"));
+	var bytes = new Uint8Array(s.length);
+	for (var i = 0; i < s.length; i++) {
+		bytes[i] = s.charCodeAt(i);
+	}
+	return bytes.buffer;
+}
+
+function encode(buffer) {
+	var bytes = new Uint8Array(buffer);
+	var s = "";
+	for (var i = 0; i < bytes.length; i++) {
+		s += String.fromCharCode(bytes[i]);
+	}
+	return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function post(path, csrfToken, body) {
+	return fetch(path, {
+		method: "POST",
+		headers: {"Content-Type": "application/json", "X-CSRF-Token": csrfToken},
+		body: body === undefined ? undefined : JSON.stringify(body)
+	}).then(function (resp) {
+		return resp.json().then(function (data) {
+			if (!resp.ok) {
+				throw new Error(typeof data.error == "string" ? data.error : "Something went wrong, please try again");
+			}
+			return data;
+		});
+	});
+}
+
+function showError(err) {
+	var el = document.getElementById("passkey-error");
+	el.textContent = err.message;
+	el.hidden = false;
+}
+
+var registerButton = document.getElementById("passkey-register");
+if (registerButton && window.PublicKeyCredential) {
+	registerButton.addEventListener("click", function () {
+		var csrfToken = registerButton.dataset.csrfToken;
+		post("/user/passkeys/begin", csrfToken).then(function (options) {
+			var publicKey = options.publicKey;
+			publicKey.challenge = decode(publicKey.challenge);
+			publicKey.user.id = decode(publicKey.user.id);
+			(publicKey.excludeCredentials || []).forEach(function (c) {
+				c.id = decode(c.id);
+			});
+			return navigator.credentials.create({publicKey: publicKey});
+		}).then(function (credential) {
+			return post("/user/passkeys/finish", csrfToken, {
+				name: document.getElementById("passkey-name").value,
+				credential: {
+					id: credential.id,
+					rawId: encode(credential.rawId),
+					type: credential.type,
+					response: {
+						clientDataJSON: encode(credential.response.clientDataJSON),
+						attestationObject: encode(credential.response.attestationObject),
+						transports: credential.response.getTransports ? credential.response.getTransports() : []
+					}
+				}
+			});
+		}).then(function (data) {
+			window.location = data.redirect;
+		}).catch(showError);
+	});
+} else if (registerButton) {
+	showError(new Error("Your browser doesn't support passkeys."));
+	registerButton.disabled = true;
+}
+
+var loginButton = document.getElementById("passkey-login");
+if (loginButton && window.PublicKeyCredential) {
+	loginButton.hidden = false;
+	loginButton.addEventListener("click", function () {
+		var csrfToken = loginButton.dataset.csrfToken;
+		post("/user/login/passkey/begin", csrfToken).then(function (options) {
+			var publicKey = options.publicKey;
+			publicKey.challenge = decode(publicKey.challenge);
+			return navigator.credentials.get({publicKey: publicKey});
+		}).then(function (credential) {
+			return post("/user/login/passkey/finish", csrfToken, {
+				id: credential.id,
+				rawId: encode(credential.rawId),
+				type: credential.type,
+				response: {
+					clientDataJSON: encode(credential.response.clientDataJSON),
+					authenticatorData: encode(credential.response.authenticatorData),
+					signature: encode(credential.response.signature),
+					userHandle: credential.response.userHandle ? encode(credential.response.userHandle) : null
+				}
+			});
+		}).then(function (data) {
+			window.location = data.redirect;
+		}).catch(showError);
+	});
+}